@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+// APIKeys handles api/v0/api-keys route
+func (s *Server) APIKeys(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+		WriteAPIResponse(response, 200, s.apiKeyService.ListAPIKeys(organizationID(request)))
+	case "POST":
+		s.createAPIKey(response, request)
+	default:
+		writeMethodNotAllowed(response, "GET", "POST")
+	}
+}
+
+// APIKeyRevoke handles api/v0/api-keys/{id}/revoke route
+func (s *Server) APIKeyRevoke(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writeMethodNotAllowed(response, "POST")
+		return
+	}
+
+	apiKey, err := s.apiKeyService.RevokeAPIKey(organizationID(request), actor(request), mux.Vars(request)["id"])
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 200, apiKey)
+}
+
+// APIKeyCertificate handles api/v0/api-keys/{id}/certificate route
+func (s *Server) APIKeyCertificate(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "PUT" {
+		writeMethodNotAllowed(response, "PUT")
+		return
+	}
+
+	var params bindCertificateParams
+	read, _ := io.ReadAll(request.Body)
+	err := json.Unmarshal(read, &params)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	id := mux.Vars(request)["id"]
+	apiKey, err := s.apiKeyService.BindCertificateSubject(organizationID(request), actor(request), id, params.Subject)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 200, apiKey)
+}
+
+type bindCertificateParams struct {
+	Subject string `json:"subject"`
+}
+
+// APIKeyDevices handles api/v0/api-keys/{id}/devices route
+func (s *Server) APIKeyDevices(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "PUT" {
+		writeMethodNotAllowed(response, "PUT")
+		return
+	}
+
+	var params grantDevicesParams
+	read, _ := io.ReadAll(request.Body)
+	err := json.Unmarshal(read, &params)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	id := mux.Vars(request)["id"]
+	apiKey, err := s.apiKeyService.GrantDevices(organizationID(request), actor(request), id, params.DeviceIDs)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 200, apiKey)
+}
+
+type grantDevicesParams struct {
+	DeviceIDs []string `json:"device_ids"`
+}
+
+type createAPIKeyParams struct {
+	OrganizationID string   `json:"organization_id"`
+	Name           string   `json:"name"`
+	Roles          []string `json:"roles"`
+}
+
+func (s *Server) createAPIKey(response http.ResponseWriter, request *http.Request) {
+	var params createAPIKeyParams
+	read, _ := io.ReadAll(request.Body)
+	err := json.Unmarshal(read, &params)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	// only the operator may issue API keys for other organizations
+	keyOrganizationID := organizationID(request)
+	if params.OrganizationID != "" && params.OrganizationID != keyOrganizationID {
+		if !s.organizationService.IsOperator(keyOrganizationID) {
+			WriteErrorResponse(response, 403, []string{"API keys can only be created for the own organization"})
+			return
+		}
+		if _, found := s.organizationService.GetOrganization(params.OrganizationID); !found {
+			WriteErrorResponse(response, 400, []string{"unknown organization"})
+			return
+		}
+		keyOrganizationID = params.OrganizationID
+	}
+
+	apiKey, err := s.apiKeyService.CreateAPIKey(keyOrganizationID, actor(request), params.Name, params.Roles)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 201, apiKey)
+}
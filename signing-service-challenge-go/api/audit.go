@@ -0,0 +1,62 @@
+package api
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Audit handles api/v0/audit route.
+// Entries can be filtered by the actor, action, target, since and until query parameters.
+func (s *Server) Audit(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writeMethodNotAllowed(response, "GET")
+		return
+	}
+
+	filter, err := parseAuditFilter(request.URL.Query())
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 200, s.auditLog.Entries(organizationID(request), filter))
+}
+
+// AuditVerify handles api/v0/audit/verify route
+func (s *Server) AuditVerify(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writeMethodNotAllowed(response, "GET")
+		return
+	}
+
+	verification, err := s.auditLog.Verify(organizationID(request))
+	if err != nil {
+		WriteInternalError(response)
+		return
+	}
+
+	WriteAPIResponse(response, 200, verification)
+}
+
+func parseAuditFilter(query url.Values) (domain.AuditFilter, error) {
+	filter := domain.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: domain.AuditAction(query.Get("action")),
+		Target: query.Get("target"),
+	}
+
+	var err error
+	if since := query.Get("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return domain.AuditFilter{}, domain.ValidationError{Field: "since", Message: "must be an RFC 3339 timestamp"}
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return domain.AuditFilter{}, domain.ValidationError{Field: "until", Message: "must be an RFC 3339 timestamp"}
+		}
+	}
+	return filter, nil
+}
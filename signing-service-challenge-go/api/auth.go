@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"net/http"
+	"strings"
+)
+
+type apiKeyContextKey struct{}
+
+// methodPermissions maps HTTP methods of a route to the permission they require.
+// Methods that are not listed require credential management, which only admins hold.
+type methodPermissions map[string]domain.Permission
+
+// Authenticated wraps handler with API key authentication and per-method permission checks.
+// A verified TLS client certificate takes precedence over a bearer token,
+// which is tried when the certificate's subject isn't bound to an active API key.
+// Bodies of authorized requests are validated against the OpenAPI document before reaching handler.
+func (s *Server) Authenticated(permissions methodPermissions, handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		subject, hasCertificate := clientCertificateSubject(request)
+		token, hasToken := bearerToken(request)
+		if !hasCertificate && !hasToken {
+			response.Header().Set("WWW-Authenticate", `Bearer realm="signing-service"`)
+			WriteErrorResponse(response, http.StatusUnauthorized, []string{"missing bearer token"})
+			return
+		}
+
+		var apiKey domain.APIKey
+		err := domain.ErrUnauthenticated
+		if hasCertificate {
+			apiKey, err = s.apiKeyService.AuthenticateCertificate(subject)
+		}
+		if errors.Is(err, domain.ErrUnauthenticated) && hasToken {
+			apiKey, err = s.apiKeyService.Authenticate(token)
+		}
+		if err != nil {
+			response.Header().Set("WWW-Authenticate", `Bearer realm="signing-service", error="invalid_token"`)
+			WriteErrorResponse(response, http.StatusUnauthorized, []string{err.Error()})
+			return
+		}
+
+		permission, found := permissions[request.Method]
+		if !found {
+			permission = domain.PermissionManageAPIKeys
+		}
+		if !apiKey.Can(permission) {
+			WriteErrorResponse(response, http.StatusForbidden, []string{"API key lacks permission " + string(permission)})
+			return
+		}
+
+		request = request.WithContext(context.WithValue(request.Context(), apiKeyContextKey{}, apiKey))
+		if !validatedRequest(response, request) {
+			return
+		}
+		handler(response, request)
+	}
+}
+
+// APIKeyFromContext returns the API key that authenticated the request.
+func APIKeyFromContext(ctx context.Context) (domain.APIKey, bool) {
+	apiKey, found := ctx.Value(apiKeyContextKey{}).(domain.APIKey)
+	return apiKey, found
+}
+
+// OperatorOnly wraps an authenticated handler and rejects API keys of non-operator organizations.
+// It answers with 404, so tenants can't discover operator routes.
+func (s *Server) OperatorOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if !s.organizationService.IsOperator(organizationID(request)) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{"not found"})
+			return
+		}
+		handler(response, request)
+	}
+}
+
+// organizationID returns the organization of the API key that authenticated the request.
+func organizationID(request *http.Request) string {
+	apiKey, _ := APIKeyFromContext(request.Context())
+	return apiKey.OrganizationID
+}
+
+// actor identifies the API key that authenticated the request in the audit log.
+func actor(request *http.Request) string {
+	apiKey, _ := APIKeyFromContext(request.Context())
+	return apiKey.ID
+}
+
+func clientCertificateSubject(request *http.Request) (pkix.Name, bool) {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		return pkix.Name{}, false
+	}
+	return request.TLS.VerifiedChains[0][0].Subject, true
+}
+
+func bearerToken(request *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveAs handles a request authenticated with token
+func serveAs(handler http.Handler, token string, method string, path string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// createdID returns the field of the created resource in the response envelope
+func createdID(t *testing.T, recorder *httptest.ResponseRecorder, field string) string {
+	var envelope struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf(err.Error())
+	}
+	id, _ := envelope.Data[field].(string)
+	if id == "" {
+		t.Fatalf("response %d %s has no %s", recorder.Code, recorder.Body.String(), field)
+	}
+	return id
+}
+
+// withClientCertificate marks the request as sent over mutual TLS with a verified certificate for subject
+func withClientCertificate(t *testing.T, request *http.Request, subject pkix.Name) *http.Request {
+	certificate := issueTestCertificate(t, subject, nil, 1).certificate
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+	return request
+}
+
+func TestAuthenticated_BearerTokens(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+	viewer := serveAs(handler, contractTestToken, "POST", "/api/v0/api-keys", `{"name": "dashboard", "roles": ["viewer"]}`)
+	viewerToken := createdID(t, viewer, "token")
+	revoked := serveAs(handler, contractTestToken, "POST", "/api/v0/api-keys", `{"name": "old till", "roles": ["signer"]}`)
+	revokedToken := createdID(t, revoked, "token")
+	if recorder := serveAs(handler, contractTestToken, "POST", "/api/v0/api-keys/"+createdID(t, revoked, "id")+"/revoke", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("revoking answered %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		method        string
+		path          string
+		status        int
+		challenge     string
+	}{
+		{"missing token", "", "GET", "/api/v0/devices", http.StatusUnauthorized, `Bearer realm="signing-service"`},
+		{"other scheme", "Basic dXNlcjpwYXNz", "GET", "/api/v0/devices", http.StatusUnauthorized, `Bearer realm="signing-service"`},
+		{"empty token", "Bearer ", "GET", "/api/v0/devices", http.StatusUnauthorized, `Bearer realm="signing-service"`},
+		{"unknown token", "Bearer ssk_unknown", "GET", "/api/v0/devices", http.StatusUnauthorized, `Bearer realm="signing-service", error="invalid_token"`},
+		{"revoked token", "Bearer " + revokedToken, "GET", "/api/v0/devices", http.StatusUnauthorized, `Bearer realm="signing-service", error="invalid_token"`},
+		{"scheme is case insensitive", "bearer " + viewerToken, "GET", "/api/v0/devices", http.StatusOK, ""},
+		{"missing permission", "Bearer " + viewerToken, "POST", "/api/v0/devices", http.StatusForbidden, ""},
+		{"missing credential management permission", "Bearer " + viewerToken, "GET", "/api/v0/api-keys", http.StatusForbidden, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader(`{"algorithm": "ECC"}`))
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("status = %v, want %v: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != test.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, test.challenge)
+			}
+		})
+	}
+}
+
+func TestAuthenticated_ClientCertificateAndBearerToken(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+	admin, err := server.apiKeyService.Authenticate(contractTestToken)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	organizationID := admin.OrganizationID
+
+	viewer, err := server.apiKeyService.CreateAPIKey(organizationID, admin.ID, "till", []string{"viewer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bound := pkix.Name{CommonName: "till-1", Organization: []string{organizationID}}
+	if _, err = server.apiKeyService.BindCertificateSubject(organizationID, admin.ID, viewer.ID, bound.String()); err != nil {
+		t.Fatalf(err.Error())
+	}
+	unbound := pkix.Name{CommonName: "till-2", Organization: []string{organizationID}}
+
+	// the viewer may list devices but not API keys, which tells which key authenticated a request
+	tests := []struct {
+		name        string
+		certificate *pkix.Name
+		token       string
+		path        string
+		status      int
+	}{
+		{"certificate only", &bound, "", "/api/v0/devices", http.StatusOK},
+		{"bearer token only", nil, contractTestToken, "/api/v0/api-keys", http.StatusOK},
+		{"certificate takes precedence", &bound, contractTestToken, "/api/v0/api-keys", http.StatusForbidden},
+		{"unbound certificate falls back to the token", &unbound, contractTestToken, "/api/v0/api-keys", http.StatusOK},
+		{"unbound certificate without token", &unbound, "", "/api/v0/devices", http.StatusUnauthorized},
+		{"unbound certificate with invalid token", &unbound, "invalid", "/api/v0/devices", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.certificate != nil {
+				request = withClientCertificate(t, request, *test.certificate)
+			}
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("status = %v, want %v: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestSignTransaction_RequiresDeviceGrant(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+	deviceID := createdID(t, serveAs(handler, contractTestToken, "POST", "/api/v0/devices", `{"algorithm": "ECC"}`), "uuid")
+	created := serveAs(handler, contractTestToken, "POST", "/api/v0/api-keys", `{"name": "till", "roles": ["signer"]}`)
+	signerID, signerToken := createdID(t, created, "id"), createdID(t, created, "token")
+
+	tests := []struct {
+		name   string
+		grants string
+		status int
+	}{
+		{"without grants", "", http.StatusForbidden},
+		{"other device granted", `["8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1"]`, http.StatusForbidden},
+		{"device granted", `["` + deviceID + `"]`, http.StatusOK},
+		{"every device granted", `["*"]`, http.StatusOK},
+		{"grants revoked", `[]`, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if test.grants != "" {
+			body := `{"device_ids": ` + test.grants + `}`
+			if recorder := serveAs(handler, contractTestToken, "PUT", "/api/v0/api-keys/"+signerID+"/devices", body); recorder.Code != http.StatusOK {
+				t.Fatalf("%s: granting answered %d %s", test.name, recorder.Code, recorder.Body.String())
+			}
+		}
+		recorder := serveAs(handler, signerToken, "POST", "/api/v0/devices/"+deviceID+"/sign", `{"data": "receipt"}`)
+		if recorder.Code != test.status {
+			t.Errorf("%s: status = %v, want %v: %s", test.name, recorder.Code, test.status, recorder.Body.String())
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 	"github.com/gorilla/mux"
 	"io"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 )
 
 // Devices handles api/v0/devices route
@@ -16,7 +21,7 @@ func (s *Server) Devices(response http.ResponseWriter, request *http.Request) {
 	case "POST":
 		s.createSignatureDevice(response, request)
 	default:
-		WriteErrorResponse(response, 404, []string{"not found"})
+		writeMethodNotAllowed(response, "GET", "POST")
 	}
 }
 
@@ -25,8 +30,12 @@ func (s *Server) Device(response http.ResponseWriter, request *http.Request) {
 	switch request.Method {
 	case "GET":
 		s.getSignatureDevice(response, request)
+	case "PUT":
+		s.createSignatureDeviceWithID(response, request)
+	case "PATCH":
+		s.updateSignatureDevice(response, request)
 	default:
-		WriteErrorResponse(response, 404, []string{"not found"})
+		writeMethodNotAllowed(response, "GET", "PUT", "PATCH")
 	}
 }
 
@@ -36,13 +45,88 @@ func (s *Server) DeviceSign(response http.ResponseWriter, request *http.Request)
 	case "POST":
 		s.signDataWithDevice(response, request)
 	default:
-		WriteErrorResponse(response, 404, []string{"not found"})
+		writeMethodNotAllowed(response, "POST")
 	}
 }
 
-func (s *Server) getAllSignatureDevices(response http.ResponseWriter, _ *http.Request) {
-	devices := s.devicesRepository.GetAll()
-	WriteAPIResponse(response, 200, devices)
+// DeviceSuspend handles api/v0/devices/{id}/suspend route
+func (s *Server) DeviceSuspend(response http.ResponseWriter, request *http.Request) {
+	s.changeSignatureDeviceStatus(response, request, s.deviceService.SuspendSignatureDevice)
+}
+
+// DeviceResume handles api/v0/devices/{id}/resume route
+func (s *Server) DeviceResume(response http.ResponseWriter, request *http.Request) {
+	s.changeSignatureDeviceStatus(response, request, s.deviceService.ResumeSignatureDevice)
+}
+
+// DeviceDecommission handles api/v0/devices/{id}/decommission route
+func (s *Server) DeviceDecommission(response http.ResponseWriter, request *http.Request) {
+	s.changeSignatureDeviceStatus(response, request, s.deviceService.DecommissionSignatureDevice)
+}
+
+// getAllSignatureDevices lists a page of devices.
+// Query parameters: algorithm, label_prefix, status, tag, sort, order (asc or desc), limit and cursor.
+func (s *Server) getAllSignatureDevices(response http.ResponseWriter, request *http.Request) {
+	query, err := parseDeviceQuery(request.URL.Query())
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	page, err := s.deviceService.ListSignatureDevices(request.Context(), organizationID(request), query)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+	WriteAPIPage(response, 200, page.Devices, Pagination{NextCursor: page.NextCursor})
+}
+
+func parseDeviceQuery(values url.Values) (domain.DeviceQuery, error) {
+	query := domain.DeviceQuery{
+		DeviceFilter: domain.DeviceFilter{
+			LabelPrefix: values.Get("label_prefix"),
+			Tag:         values.Get("tag"),
+		},
+	}
+
+	var err error
+	if algorithm := values.Get("algorithm"); algorithm != "" {
+		if query.Algorithm, err = domain.ParseAlgorithm(algorithm); err != nil {
+			return domain.DeviceQuery{}, err
+		}
+	}
+	if s := values.Get("status"); s != "" {
+		status, err := domain.ParseStatus(s)
+		if err != nil {
+			return domain.DeviceQuery{}, domain.ValidationError{Field: "status", Message: err.Error()}
+		}
+		query.Status = &status
+	}
+	if sortBy := values.Get("sort"); sortBy != "" {
+		if query.SortBy, err = domain.ParseDeviceSortField(sortBy); err != nil {
+			return domain.DeviceQuery{}, domain.ValidationError{Field: "sort", Message: err.Error()}
+		}
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return domain.DeviceQuery{}, domain.ValidationError{Field: "order", Message: "must be asc or desc"}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 {
+			return domain.DeviceQuery{}, domain.ValidationError{Field: "limit", Message: "must be a positive number"}
+		}
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		after, err := domain.ParseDeviceCursor(cursor)
+		if err != nil {
+			return domain.DeviceQuery{}, err
+		}
+		query.After = &after
+	}
+	return query, nil
 }
 
 type createSignatureDeviceParams struct {
@@ -55,22 +139,52 @@ func (s *Server) createSignatureDevice(response http.ResponseWriter, request *ht
 	read, _ := io.ReadAll(request.Body)
 	err := json.Unmarshal(read, &params)
 	if err != nil {
-		WriteErrorResponse(response, 400, []string{err.Error()})
+		WriteError(response, request, err)
 		return
 	}
 
-	device, err := domain.CreateSignatureDevice(params.Algorithm, params.Label, s.devicesRepository)
+	device, err := s.deviceService.CreateSignatureDevice(request.Context(), organizationID(request), actor(request), params.Algorithm, params.Label)
 	if err != nil {
-		WriteErrorResponse(response, 400, []string{err.Error()})
+		WriteError(response, request, err)
 		return
 	}
 
 	WriteAPIResponse(response, 200, device)
 }
 
+func (s *Server) createSignatureDeviceWithID(response http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["uuid"]
+	var params createSignatureDeviceParams
+	read, _ := io.ReadAll(request.Body)
+	err := json.Unmarshal(read, &params)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	device, created, err := s.deviceService.CreateSignatureDeviceWithID(
+		request.Context(),
+		organizationID(request),
+		actor(request),
+		id,
+		params.Algorithm,
+		params.Label,
+	)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	if created {
+		WriteAPIResponse(response, 201, device)
+		return
+	}
+	WriteAPIResponse(response, 200, device)
+}
+
 func (s *Server) getSignatureDevice(response http.ResponseWriter, request *http.Request) {
 	id := mux.Vars(request)["uuid"]
-	device, found := s.devicesRepository.Get(id)
+	device, found := s.deviceService.GetSignatureDevice(request.Context(), organizationID(request), id)
 
 	if !found {
 		WriteErrorResponse(response, 404, []string{"not found"})
@@ -80,6 +194,86 @@ func (s *Server) getSignatureDevice(response http.ResponseWriter, request *http.
 	WriteAPIResponse(response, 200, device)
 }
 
+type updateSignatureDeviceParams struct {
+	Version  *int               `json:"version"`
+	Label    *string            `json:"label"`
+	Metadata map[string]*string `json:"metadata"`
+	Tags     *[]string          `json:"tags"`
+}
+
+// immutableDeviceFields can be read from a device but never patched
+var immutableDeviceFields = map[string]bool{
+	"uuid":              true,
+	"algorithm":         true,
+	"public_key":        true,
+	"private_key":       true,
+	"signature_counter": true,
+	"status":            true,
+	"status_changed_at": true,
+	"created_at":        true,
+}
+
+var mutableDeviceFields = map[string]bool{
+	"version":  true,
+	"label":    true,
+	"metadata": true,
+	"tags":     true,
+}
+
+func (s *Server) updateSignatureDevice(response http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["uuid"]
+	read, _ := io.ReadAll(request.Body)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(read, &fields); err != nil {
+		WriteError(response, request, err)
+		return
+	}
+	var fieldErrors []string
+	for field := range fields {
+		if immutableDeviceFields[field] {
+			fieldErrors = append(fieldErrors, fmt.Sprintf("field %q can't be modified", field))
+		} else if !mutableDeviceFields[field] {
+			fieldErrors = append(fieldErrors, fmt.Sprintf("unknown field %q", field))
+		}
+	}
+	if len(fieldErrors) > 0 {
+		sort.Strings(fieldErrors)
+		WriteErrorResponse(response, 400, fieldErrors)
+		return
+	}
+
+	var params updateSignatureDeviceParams
+	if err := json.Unmarshal(read, &params); err != nil {
+		WriteError(response, request, err)
+		return
+	}
+	if params.Version == nil {
+		WriteErrorResponse(response, 400, []string{"version is required"})
+		return
+	}
+
+	if _, found := s.deviceService.GetSignatureDevice(request.Context(), organizationID(request), id); !found {
+		WriteErrorResponse(response, 404, []string{"not found"})
+		return
+	}
+
+	device, err := s.deviceService.UpdateSignatureDevice(request.Context(), organizationID(request), actor(request), id, domain.SignatureDeviceUpdate{
+		Version:  *params.Version,
+		Label:    params.Label,
+		Metadata: params.Metadata,
+		Tags:     params.Tags,
+	})
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 200, device)
+}
+
+const maxIdempotencyKeyLength = 255
+
 type signDataWithDeviceParams struct {
 	Data string `json:"data"`
 }
@@ -89,11 +283,69 @@ func (s *Server) signDataWithDevice(response http.ResponseWriter, request *http.
 	var params signDataWithDeviceParams
 	read, _ := io.ReadAll(request.Body)
 	err := json.Unmarshal(read, &params)
-	signedData, err := domain.SignTransaction(id, params.Data, s.devicesRepository)
 	if err != nil {
-		WriteErrorResponse(response, 400, []string{err.Error()})
+		WriteError(response, request, err)
+		return
+	}
+	if _, found := s.deviceService.GetSignatureDevice(request.Context(), organizationID(request), id); !found {
+		WriteErrorResponse(response, 404, []string{"not found"})
+		return
+	}
+	if apiKey, _ := APIKeyFromContext(request.Context()); !apiKey.CanSignWith(id) {
+		WriteErrorResponse(response, 403, []string{"API key isn't granted to sign with this device"})
+		return
+	}
+
+	var signedData domain.SignatureResponse
+	idempotencyKey := request.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			WriteErrorResponse(response, 400, []string{"Idempotency-Key header is too long"})
+			return
+		}
+		var replayed bool
+		signedData, replayed, err = s.deviceService.SignTransactionIdempotently(
+			request.Context(),
+			organizationID(request),
+			id,
+			params.Data,
+			idempotencyKey,
+		)
+		if replayed {
+			response.Header().Set("Idempotent-Replayed", "true")
+		}
+	} else {
+		signedData, err = s.deviceService.SignTransaction(request.Context(), organizationID(request), id, params.Data)
+	}
+	if err != nil {
+		WriteError(response, request, err)
 		return
 	}
 
 	WriteAPIResponse(response, 200, signedData)
 }
+
+func (s *Server) changeSignatureDeviceStatus(
+	response http.ResponseWriter,
+	request *http.Request,
+	change func(ctx context.Context, organizationID string, actor string, id string) (domain.SignatureDevice, error),
+) {
+	if request.Method != "POST" {
+		writeMethodNotAllowed(response, "POST")
+		return
+	}
+
+	id := mux.Vars(request)["uuid"]
+	if _, found := s.deviceService.GetSignatureDevice(request.Context(), organizationID(request), id); !found {
+		WriteErrorResponse(response, 404, []string{"not found"})
+		return
+	}
+
+	device, err := change(request.Context(), organizationID(request), actor(request), id)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 200, device)
+}
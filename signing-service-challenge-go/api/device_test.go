@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// yieldingDevicesRepository lets other goroutines run after every read and signature write,
+// so concurrent requests interleave around storing a device even on a single CPU
+type yieldingDevicesRepository struct {
+	*persistence.InMemoryDevicesRepository
+}
+
+func (repo yieldingDevicesRepository) Get(ctx context.Context, organizationID string, uuid string) (domain.SignatureDevice, bool) {
+	device, found := repo.InMemoryDevicesRepository.Get(ctx, organizationID, uuid)
+	runtime.Gosched()
+	return device, found
+}
+
+func (repo yieldingDevicesRepository) IncrementCounter(ctx context.Context, device domain.SignatureDevice, events ...domain.Event) error {
+	err := repo.InMemoryDevicesRepository.IncrementCounter(ctx, device, events...)
+	runtime.Gosched()
+	return err
+}
+
+func TestConcurrentSignsOfOneDeviceSucceed(t *testing.T) {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	repo := yieldingDevicesRepository{persistence.NewInMemoryDevicesRepository()}
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	deviceService := domain.NewDeviceService(
+		repo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "till", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	device, err := deviceService.CreateSignatureDevice(context.Background(), "organization", "admin", domain.ECC, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	handler := NewServer("", deviceService, apiKeyService, nil, auditLog, nil, domain.NewEventStream(repo)).Handler()
+
+	const requests = 8
+	counters := make(chan int, requests)
+	var wg sync.WaitGroup
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			defer wg.Done()
+			recorder := serveAs(handler, apiKey.Token, "POST", "/api/v0/devices/"+device.UUID+"/sign", `{"data": "receipt"}`)
+			if recorder.Code != http.StatusOK {
+				t.Errorf("status = %v, want %v: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+				return
+			}
+			var envelope struct {
+				Data struct {
+					SignatureCounter int `json:"signature_counter"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+				t.Errorf(err.Error())
+				return
+			}
+			counters <- envelope.Data.SignatureCounter
+		}()
+	}
+	wg.Wait()
+	close(counters)
+
+	signed := make(map[int]bool)
+	for counter := range counters {
+		if signed[counter] {
+			t.Errorf("signature counter %d was used twice", counter)
+		}
+		signed[counter] = true
+	}
+	if len(signed) != requests {
+		t.Errorf("got %d distinct signature counters, want %d", len(signed), requests)
+	}
+}
@@ -1,25 +1,162 @@
 package api
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Version is the release of the service, set with
+// -ldflags "-X github.com/fiskaly/coding-challenges/signing-service-challenge/api.Version=1.2.0".
+// Without it the version is taken from the build information.
+var Version = ""
+
+// apiVersion is the public version of the API, it only changes with incompatible changes
+const apiVersion = "0"
+
+// healthContentType is the media type of the health check response format draft
+const healthContentType = "application/health+json"
 
 type HealthResponse struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
 }
 
+// HealthCheckResult is a health check response of the draft "Health Check Response Format for HTTP APIs".
+type HealthCheckResult struct {
+	// Status is pass or fail
+	Status    string `json:"status"`
+	Version   string `json:"version"`
+	ReleaseID string `json:"releaseId"`
+	// Checks are keyed by "component:measurement"
+	Checks map[string][]ComponentCheck `json:"checks,omitempty"`
+	Output string                      `json:"output,omitempty"`
+}
+
+// ComponentCheck is the status of a component the service depends on.
+type ComponentCheck struct {
+	ComponentID   string    `json:"componentId,omitempty"`
+	ComponentType string    `json:"componentType"`
+	ObservedValue float64   `json:"observedValue"`
+	ObservedUnit  string    `json:"observedUnit"`
+	Status        string    `json:"status"`
+	Time          time.Time `json:"time"`
+	Output        string    `json:"output,omitempty"`
+}
+
+// releaseID is Version, the module version or the VCS revision the binary was built from
+var releaseID = sync.OnceValue(func() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+})
+
 // Health evaluates the health of the service and writes a standardized response.
+//
+// Deprecated: probes should use HealthLive and HealthReady.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		writeMethodNotAllowed(response, http.MethodGet)
 		return
 	}
 
 	health := HealthResponse{
 		Status:  "pass",
-		Version: "v0",
+		Version: releaseID(),
 	}
 
 	WriteAPIResponse(response, http.StatusOK, health)
 }
+
+// HealthLive handles api/v0/health/live, it passes as long as the process serves requests
+func (s *Server) HealthLive(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeMethodNotAllowed(response, http.MethodGet)
+		return
+	}
+	writeHealth(response, HealthCheckResult{Status: "pass", Version: apiVersion, ReleaseID: releaseID()})
+}
+
+// HealthReady handles api/v0/health/ready, it fails with 503 unless every dependency passes its check
+func (s *Server) HealthReady(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeMethodNotAllowed(response, http.MethodGet)
+		return
+	}
+
+	health := HealthCheckResult{
+		Status:    "pass",
+		Version:   apiVersion,
+		ReleaseID: releaseID(),
+		Checks:    make(map[string][]ComponentCheck),
+	}
+	select {
+	case <-s.shutdown:
+		health.Status = "fail"
+		health.Output = "server is shutting down"
+	default:
+	}
+	for _, check := range s.deviceService.CheckHealth() {
+		component := ComponentCheck{
+			ComponentID:   check.ComponentID,
+			ComponentType: check.ComponentType,
+			ObservedValue: float64(check.Duration.Microseconds()) / 1000,
+			ObservedUnit:  "ms",
+			Status:        "pass",
+			Time:          check.Time.UTC(),
+		}
+		if check.Err != nil {
+			component.Status = "fail"
+			component.Output = check.Err.Error()
+			health.Status = "fail"
+		}
+		key := check.Component + ":responseTime"
+		health.Checks[key] = append(health.Checks[key], component)
+	}
+	writeHealth(response, health)
+}
+
+func writeHealth(response http.ResponseWriter, health HealthCheckResult) {
+	status := http.StatusOK
+	if health.Status != "pass" {
+		status = http.StatusServiceUnavailable
+	}
+	bytes, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		WriteInternalError(response)
+		return
+	}
+	response.Header().Set("Content-Type", healthContentType)
+	// probes must see the current state
+	response.Header().Set("Cache-Control", "no-store")
+	response.WriteHeader(status)
+	response.Write(bytes)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// unreachableDevicesRepository fails its health check like a database that went away
+type unreachableDevicesRepository struct {
+	*persistence.InMemoryDevicesRepository
+}
+
+func (unreachableDevicesRepository) CheckHealth() error {
+	return errors.New("connection refused")
+}
+
+func getHealth(t *testing.T, repo domain.DevicesRepository, policy domain.KeyPolicy, path string) (int, HealthCheckResult) {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	deviceService := domain.NewDeviceService(
+		repo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		policy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	server := NewServer("", deviceService, nil, nil, auditLog, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	if recorder.Header().Get("Content-Type") != healthContentType {
+		t.Errorf("GET %s answered %q, want %q", path, recorder.Header().Get("Content-Type"), healthContentType)
+	}
+	var health HealthCheckResult
+	if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return recorder.Code, health
+}
+
+func TestHealthReadyChecksEveryEnabledAlgorithm(t *testing.T) {
+	status, health := getHealth(t, persistence.NewInMemoryDevicesRepository(), domain.DefaultKeyPolicy, "/api/v0/health/ready")
+	if status != http.StatusOK || health.Status != "pass" || health.ReleaseID == "" {
+		t.Errorf("readiness = %d %+v, want 200 and pass with a release", status, health)
+	}
+
+	signers := health.Checks[domain.ComponentSigner+":responseTime"]
+	if len(signers) != 2 || signers[0].ComponentID != "ECC" || signers[1].ComponentID != "RSA" {
+		t.Errorf("signer checks = %+v, want a self-test of ECC and RSA", signers)
+	}
+	for _, component := range []string{domain.ComponentDevicesRepository, domain.ComponentKeyStore} {
+		checks := health.Checks[component+":responseTime"]
+		if len(checks) != 1 || checks[0].Status != "pass" || checks[0].ComponentType != "datastore" {
+			t.Errorf("%s checks = %+v, want one passing datastore check", component, checks)
+		}
+	}
+}
+
+func TestHealthReadyFailsWithUnreachableRepository(t *testing.T) {
+	repo := unreachableDevicesRepository{persistence.NewInMemoryDevicesRepository()}
+	policy := domain.KeyPolicy{Algorithms: []domain.Algorithm{domain.ECC}, RSAKeyBits: domain.DefaultKeyPolicy.RSAKeyBits}
+	status, health := getHealth(t, repo, policy, "/api/v0/health/ready")
+	if status != http.StatusServiceUnavailable || health.Status != "fail" {
+		t.Errorf("readiness = %d %s, want 503 and fail", status, health.Status)
+	}
+	checks := health.Checks[domain.ComponentDevicesRepository+":responseTime"]
+	if len(checks) != 1 || checks[0].Status != "fail" || checks[0].Output != "connection refused" {
+		t.Errorf("repository checks = %+v, want the failure", checks)
+	}
+	if signers := health.Checks[domain.ComponentSigner+":responseTime"]; len(signers) != 1 || signers[0].Status != "pass" {
+		t.Errorf("signer checks = %+v, want only the enabled ECC", signers)
+	}
+
+	// liveness doesn't depend on the repository
+	if status, health = getHealth(t, repo, policy, "/api/v0/health/live"); status != http.StatusOK || len(health.Checks) != 0 {
+		t.Errorf("liveness = %d %+v, want 200 without checks", status, health)
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader carries the ID correlating the log records of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLogging gives every request an ID and logs it once it is handled. The ID a client sends in
+// X-Request-ID is used if it is valid, otherwise one is generated. The ID is echoed in the response and
+// carried by the context of the request, so the domain logs with it too.
+func RequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		response.Header().Set(RequestIDHeader, id)
+		ctx := logging.WithRequestID(request.Context(), id)
+
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		// the query string isn't logged, it may carry cursors and filters of customers
+		slog.InfoContext(ctx, "Handled request",
+			"method", request.Method,
+			"path", request.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// statusRecorder remembers the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(bytes []byte) (int, error) {
+	recorder.wroteHeader = true
+	return recorder.ResponseWriter.Write(bytes)
+}
+
+// Flush keeps event streams working, they require an http.Flusher
+func (recorder *statusRecorder) Flush() {
+	_ = http.NewResponseController(recorder.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the deadlines of the connection
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// captureLogs makes the default logger write JSON records to the returned buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buffer bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buffer
+}
+
+// newRequest returns a request authenticated with the admin key of the contract test server
+func newRequest(method string, path string, body string) *http.Request {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+contractTestToken)
+	return request
+}
+
+// serve handles a request synchronously, so everything it logs is in the log once it returns
+func serve(handler http.Handler, method string, path string, body string, requestID string) *httptest.ResponseRecorder {
+	request := newRequest(method, path, body)
+	if requestID != "" {
+		request.Header.Set(RequestIDHeader, requestID)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequestLoggingAssignsRequestIDs(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+	tests := []struct {
+		name      string
+		requestID string
+		echoed    bool
+	}{
+		{"client ID", "till-7/receipt-42", true},
+		{"missing ID", "", false},
+		{"ID forging log lines", "till-7\nlevel=ERROR", false},
+		{"overlong ID", strings.Repeat("a", logging.MaxRequestIDLength+1), false},
+	}
+	for _, test := range tests {
+		logs := captureLogs(t)
+		response := serve(handler, "GET", "/api/v0/devices", "", test.requestID)
+		id := response.Header().Get(RequestIDHeader)
+		if test.echoed && id != test.requestID {
+			t.Errorf("%s: response has request ID %q, want %q", test.name, id, test.requestID)
+		}
+		if !test.echoed && (id == test.requestID || !logging.ValidRequestID(id)) {
+			t.Errorf("%s: response has request ID %q, want a generated one", test.name, id)
+		}
+		if !strings.Contains(logs.String(), `"request_id":"`+id+`"`) {
+			t.Errorf("%s: request isn't logged with its ID: %s", test.name, logs.String())
+		}
+	}
+}
+
+func TestSigningKeepsDataAndKeysOutOfLogs(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+	logs := captureLogs(t)
+
+	response := serve(handler, "PUT", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1", `{"algorithm": "ECC"}`, "")
+	if response.Code != 201 {
+		t.Fatalf("PUT answered %d %s", response.Code, response.Body)
+	}
+	response = serve(handler, "POST", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1/sign", `{"data": "receipt-4711"}`, "till-7")
+	if response.Code != 200 {
+		t.Fatalf("POST answered %d %s", response.Code, response.Body)
+	}
+
+	for _, leaked := range []string{"receipt-4711", "PRIVATE KEY"} {
+		if strings.Contains(logs.String(), leaked) {
+			t.Errorf("log contains %q: %s", leaked, logs.String())
+		}
+	}
+	// the request ID reaches the records of the domain
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, `"msg":"Signed transaction"`) {
+			if !strings.Contains(line, `"request_id":"till-7"`) {
+				t.Errorf("signature is logged without the request ID: %s", line)
+			}
+			return
+		}
+	}
+	t.Errorf("signature isn't logged: %s", logs.String())
+}
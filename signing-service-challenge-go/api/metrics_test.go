@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// failingDevicesRepository fails every counter update like a lost database connection
+type failingDevicesRepository struct {
+	*persistence.InMemoryDevicesRepository
+}
+
+func (failingDevicesRepository) IncrementCounter(context.Context, domain.SignatureDevice, ...domain.Event) error {
+	return errors.New("connection reset")
+}
+
+type metricsTestServer struct {
+	url        string
+	metricsURL string
+	token      string
+	devices    *domain.DeviceService
+	dispatcher *domain.EventDispatcher
+}
+
+// newMetricsTestServer serves with a write timeout, so streams only work if the middleware lets them clear it
+func newMetricsTestServer(t *testing.T, repo domain.DevicesRepository, history *persistence.InMemoryDevicesRepository) *metricsTestServer {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	deviceService := domain.NewDeviceService(
+		repo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "till", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	registry := metrics.NewRegistry(deviceService)
+	deviceService.SetMetrics(registry)
+	eventStream := domain.NewEventStream(history)
+	server := NewServer("", deviceService, apiKeyService, nil, auditLog, nil, eventStream)
+	server.EnableMetrics(registry)
+	listener := httptest.NewUnstartedServer(server.Handler())
+	listener.Config.WriteTimeout = 100 * time.Millisecond
+	listener.Start()
+	t.Cleanup(listener.Close)
+	metricsListener := httptest.NewServer(server.MetricsHandler())
+	t.Cleanup(metricsListener.Close)
+	return &metricsTestServer{
+		url:        listener.URL,
+		metricsURL: metricsListener.URL,
+		token:      apiKey.Token,
+		devices:    deviceService,
+		dispatcher: domain.NewEventDispatcher(history, 10, eventStream),
+	}
+}
+
+func (server *metricsTestServer) do(t *testing.T, method string, path string, body string) *http.Response {
+	request, err := http.NewRequest(method, server.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	request.Header.Set("Authorization", "Bearer "+server.token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return response
+}
+
+// scrape returns the lines of the exposition format from the metrics listener
+func (server *metricsTestServer) scrape(t *testing.T) string {
+	response, err := http.Get(server.metricsURL + "/metrics")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != 200 {
+		t.Fatalf("GET /metrics answered %d %s", response.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestMetricsRecordRequestsAndSignatures(t *testing.T) {
+	repo := persistence.NewInMemoryDevicesRepository()
+	server := newMetricsTestServer(t, repo, repo)
+	response := server.do(t, "PUT", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1", `{"algorithm": "RSA"}`)
+	response.Body.Close()
+	for i := 0; i < 2; i++ {
+		response = server.do(t, "POST", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1/sign", `{"data": "receipt"}`)
+		response.Body.Close()
+	}
+	response = server.do(t, "GET", "/unknown/8f14e45f", "")
+	response.Body.Close()
+
+	scraped := server.scrape(t)
+	for _, want := range []string{
+		`signing_service_http_requests_total{method="POST",route="/api/v0/devices/{uuid}/sign",status="200"} 2`,
+		`signing_service_http_requests_total{method="PUT",route="/api/v0/devices/{uuid}",status="201"} 1`,
+		`signing_service_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`signing_service_http_request_duration_seconds_count{method="POST",route="/api/v0/devices/{uuid}/sign",status="200"} 2`,
+		`signing_service_sign_duration_seconds_count{algorithm="RSA"} 2`,
+		`signing_service_key_generation_duration_seconds_count{algorithm="RSA"} 1`,
+		`signing_service_devices{algorithm="RSA",status="active"} 1`,
+	} {
+		if !strings.Contains(scraped, want+"\n") {
+			t.Errorf("metrics don't contain %s", want)
+		}
+	}
+	if strings.Contains(scraped, `route="/metrics"`) {
+		t.Errorf("scrapes are recorded as requests")
+	}
+}
+
+func TestMetricsArentServedByTheAPI(t *testing.T) {
+	repo := persistence.NewInMemoryDevicesRepository()
+	server := newMetricsTestServer(t, repo, repo)
+	response := server.do(t, "GET", "/metrics", "")
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /metrics on the API listener answered %d, want %d", response.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestMetricsCountRepositoryErrors(t *testing.T) {
+	repo := persistence.NewInMemoryDevicesRepository()
+	server := newMetricsTestServer(t, failingDevicesRepository{repo}, repo)
+	response := server.do(t, "PUT", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1", `{"algorithm": "ECC"}`)
+	response.Body.Close()
+	// creating again conflicts, which isn't a repository error
+	response = server.do(t, "PUT", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1", `{"algorithm": "RSA"}`)
+	response.Body.Close()
+	response = server.do(t, "POST", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1/sign", `{"data": "receipt"}`)
+	response.Body.Close()
+
+	scraped := server.scrape(t)
+	if !strings.Contains(scraped, `signing_service_repository_errors_total{operation="increment_counter"} 1`+"\n") {
+		t.Errorf("failed counter update isn't counted")
+	}
+	if strings.Contains(scraped, `operation="create"`) {
+		t.Errorf("conflicting device creation is counted as repository error")
+	}
+}
+
+func TestMetricsMiddlewareKeepsEventStreamsWorking(t *testing.T) {
+	repo := persistence.NewInMemoryDevicesRepository()
+	server := newMetricsTestServer(t, repo, repo)
+	response := server.do(t, "GET", "/api/v0/events", "")
+	defer response.Body.Close()
+	if response.StatusCode != 200 || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /api/v0/events answered %d %q", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	// past the write timeout, events still reach the stream
+	time.Sleep(300 * time.Millisecond)
+	device, err := server.devices.CreateSignatureDevice(context.Background(), "organization", "admin", domain.ECC, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = server.dispatcher.Dispatch(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	read := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "event: ") {
+				read <- scanner.Text()
+				return
+			}
+		}
+		close(read)
+	}()
+	select {
+	case _, ok := <-read:
+		if !ok {
+			t.Errorf("stream ended before the event of device %s", device.UUID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("event of device %s wasn't streamed", device.UUID)
+	}
+}
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIDocument is the published API contract, served as is at api/v0/openapi.json
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPI is the parsed openAPIDocument
+var openAPI = mustParseOpenAPI(openAPIDocument)
+
+// OpenAPI holds the parts of an OpenAPI 3 document needed to validate requests and responses.
+type OpenAPI struct {
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema         `json:"schemas"`
+		Responses map[string]OpenAPIResponse `json:"responses"`
+	} `json:"components"`
+}
+
+// OpenAPIPathItem lists the operations of a path template.
+type OpenAPIPathItem struct {
+	Get    *OpenAPIOperation `json:"get"`
+	Put    *OpenAPIOperation `json:"put"`
+	Post   *OpenAPIOperation `json:"post"`
+	Patch  *OpenAPIOperation `json:"patch"`
+	Delete *OpenAPIOperation `json:"delete"`
+}
+
+// Operation returns the operation handling method, nil if the path doesn't support it
+func (item OpenAPIPathItem) Operation(method string) *OpenAPIOperation {
+	switch method {
+	case "GET":
+		return item.Get
+	case "PUT":
+		return item.Put
+	case "POST":
+		return item.Post
+	case "PATCH":
+		return item.Patch
+	case "DELETE":
+		return item.Delete
+	default:
+		return nil
+	}
+}
+
+// OpenAPIOperation describes the request body and responses of one method of a path.
+type OpenAPIOperation struct {
+	OperationID string `json:"operationId"`
+	RequestBody *struct {
+		Required bool                        `json:"required"`
+		Content  map[string]OpenAPIMediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIResponse is a documented response, either inline or referencing a shared one.
+type OpenAPIResponse struct {
+	Ref     string                      `json:"$ref"`
+	Content map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIMediaType holds the schema of a body.
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of the OpenAPI schema object the API contract uses.
+type Schema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Nullable             bool                  `json:"nullable"`
+	Enum                 []interface{}         `json:"enum"`
+	Properties           map[string]*Schema    `json:"properties"`
+	Required             []string              `json:"required"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties"`
+	Items                *Schema               `json:"items"`
+	MinLength            *int                  `json:"minLength"`
+	Minimum              *float64              `json:"minimum"`
+}
+
+// AdditionalProperties is either a boolean or the schema of properties that aren't listed.
+type AdditionalProperties struct {
+	Forbidden bool
+	Schema    *Schema
+}
+
+// UnmarshalJSON accepts both forms of additionalProperties
+func (additional *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		additional.Forbidden = !allowed
+		return nil
+	}
+	return json.Unmarshal(data, &additional.Schema)
+}
+
+func mustParseOpenAPI(document []byte) *OpenAPI {
+	var spec OpenAPI
+	if err := json.Unmarshal(document, &spec); err != nil {
+		panic("invalid OpenAPI document: " + err.Error())
+	}
+	return &spec
+}
+
+// OpenAPIDocument handles api/v0/openapi.json route
+func (s *Server) OpenAPIDocument(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writeMethodNotAllowed(response, "GET")
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(openAPIDocument)
+}
+
+// validatedRequest checks the body of request against the schema of its operation.
+// It writes a problem and returns false if the body doesn't match.
+func validatedRequest(response http.ResponseWriter, request *http.Request) bool {
+	route := mux.CurrentRoute(request)
+	if route == nil {
+		return true
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return true
+	}
+	operation := openAPI.Paths[template].Operation(request.Method)
+	if operation == nil || operation.RequestBody == nil {
+		return true
+	}
+
+	read, err := io.ReadAll(request.Body)
+	if err != nil {
+		WriteError(response, request, err)
+		return false
+	}
+	request.Body = io.NopCloser(bytes.NewReader(read))
+
+	if len(read) == 0 {
+		if operation.RequestBody.Required {
+			WriteErrorResponse(response, 400, []string{"request body is required"})
+			return false
+		}
+		return true
+	}
+	var body interface{}
+	if err := json.Unmarshal(read, &body); err != nil {
+		WriteError(response, request, err)
+		return false
+	}
+
+	invalidParams := openAPI.validate(operation.RequestBody.Content["application/json"].Schema, body, "")
+	if len(invalidParams) > 0 {
+		details := make([]string, 0, len(invalidParams))
+		for _, invalidParam := range invalidParams {
+			details = append(details, invalidParam.Name+": "+invalidParam.Reason)
+		}
+		problem := NewProblem(http.StatusBadRequest, CodeValidationFailed, details...)
+		problem.InvalidParams = invalidParams
+		WriteProblem(response, problem)
+		return false
+	}
+	return true
+}
+
+// validateResponse checks a response of the operation against the documented one.
+// Streamed responses are not validated.
+func (spec *OpenAPI) validateResponse(method string, template string, status int, body []byte) error {
+	operation := spec.Paths[template].Operation(method)
+	if operation == nil {
+		return fmt.Errorf("%s %s is not documented", method, template)
+	}
+	documented, found := operation.Responses[strconv.Itoa(status)]
+	if !found {
+		documented, found = operation.Responses["default"]
+	}
+	if !found {
+		return fmt.Errorf("%s %s doesn't document status %d", method, template, status)
+	}
+	if documented.Ref != "" {
+		documented = spec.Components.Responses[strings.TrimPrefix(documented.Ref, "#/components/responses/")]
+	}
+
+	if len(documented.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s answered %d with a body, documented without", method, template, status)
+		}
+		return nil
+	}
+	for contentType, mediaType := range documented.Content {
+		if contentType == "text/event-stream" {
+			return nil
+		}
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return fmt.Errorf("%s %s answered %d with invalid JSON: %w", method, template, status, err)
+		}
+		if invalidParams := spec.validate(mediaType.Schema, value, ""); len(invalidParams) > 0 {
+			return fmt.Errorf("%s %s answered %d drifting from the schema: %+v", method, template, status, invalidParams)
+		}
+	}
+	return nil
+}
+
+// validate returns where value violates schema, path locates value in the body
+func (spec *OpenAPI) validate(schema *Schema, value interface{}, path string) []InvalidParam {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		return spec.validate(spec.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")], value, path)
+	}
+	invalid := func(format string, args ...interface{}) []InvalidParam {
+		name := path
+		if name == "" {
+			name = "body"
+		}
+		return []InvalidParam{{Name: name, Reason: fmt.Sprintf(format, args...)}}
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return invalid("must not be null")
+	}
+	if len(schema.Enum) > 0 && !containsValue(schema.Enum, value) {
+		return invalid("must be one of %v", schema.Enum)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return invalid("must be an object")
+		}
+		return spec.validateObject(schema, object, path)
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return invalid("must be an array")
+		}
+		var invalidParams []InvalidParam
+		for i, item := range array {
+			invalidParams = append(invalidParams, spec.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return invalidParams
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return invalid("must be a string")
+		}
+		if schema.MinLength != nil && len(s) < *schema.MinLength {
+			return invalid("must be at least %d characters", *schema.MinLength)
+		}
+		if reason := validateFormat(schema.Format, s); reason != "" {
+			return invalid(reason)
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return invalid("must be a %s", schema.Type)
+		}
+		if schema.Type == "integer" && number != float64(int64(number)) {
+			return invalid("must be an integer")
+		}
+		if schema.Minimum != nil && number < *schema.Minimum {
+			return invalid("must be at least %v", *schema.Minimum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return invalid("must be a boolean")
+		}
+	}
+	return nil
+}
+
+func (spec *OpenAPI) validateObject(schema *Schema, object map[string]interface{}, path string) []InvalidParam {
+	var invalidParams []InvalidParam
+	for _, required := range schema.Required {
+		if _, found := object[required]; !found {
+			invalidParams = append(invalidParams, InvalidParam{Name: joinPath(path, required), Reason: "is required"})
+		}
+	}
+
+	// sorted for stable problem details
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, found := schema.Properties[name]
+		if !found && schema.AdditionalProperties != nil {
+			if schema.AdditionalProperties.Forbidden {
+				invalidParams = append(invalidParams, InvalidParam{Name: joinPath(path, name), Reason: "is not a known field"})
+				continue
+			}
+			property = schema.AdditionalProperties.Schema
+		}
+		invalidParams = append(invalidParams, spec.validate(property, object[name], joinPath(path, name))...)
+	}
+	return invalidParams
+}
+
+func validateFormat(format string, s string) string {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, s)
+	case "uuid":
+		_, err = uuid.Parse(s)
+	case "byte":
+		_, err = base64.StdEncoding.DecodeString(s)
+	case "base64url":
+		_, err = base64.URLEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return "must be a valid " + format
+	}
+	return ""
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
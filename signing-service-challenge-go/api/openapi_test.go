@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+const contractTestToken = "ssk_contract-test-admin-token-0123456789"
+
+// contractTestResolver resolves every host to the public address of example.com, so webhooks need no DNS
+type contractTestResolver struct{}
+
+func (contractTestResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}}, nil
+}
+
+func newContractTestServer(t *testing.T) (*Server, *httptest.Server) {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	devicesRepo := persistence.NewInMemoryDevicesRepository()
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	organizationService := domain.NewOrganizationService(
+		persistence.NewInMemoryOrganizationsRepository(),
+		auditLog,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	webhookService := domain.NewWebhookService(
+		persistence.NewInMemoryWebhooksRepository(),
+		auditLog,
+		http.DefaultClient,
+		domain.DefaultWebhookRetryPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	webhookService.SetAddressPolicy(domain.WebhookAddressPolicy{Resolver: contractTestResolver{}})
+	deviceService := domain.NewDeviceService(
+		devicesRepo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+
+	operator, err := organizationService.CreateOperatorOrganization("operator")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = apiKeyService.ImportAPIKey(operator.ID, "admin", contractTestToken, []domain.Role{domain.RoleAdmin}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	server := NewServer(
+		"",
+		deviceService,
+		apiKeyService,
+		organizationService,
+		auditLog,
+		webhookService,
+		domain.NewEventStream(devicesRepo),
+	)
+	listener := httptest.NewServer(server.Handler())
+	t.Cleanup(listener.Close)
+	return server, listener
+}
+
+func TestOpenAPIDocumentsAllRoutes(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	routed := make(map[string]bool)
+	err := server.router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		routed[template] = true
+		return err
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for template := range routed {
+		if _, found := openAPI.Paths[template]; !found {
+			t.Errorf("route %s is missing from openapi.json", template)
+		}
+	}
+	for template := range openAPI.Paths {
+		if !routed[template] {
+			t.Errorf("openapi.json documents %s, which isn't routed", template)
+		}
+	}
+}
+
+func TestRoutesAllowTheDocumentedMethods(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	err := server.router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		item := openAPI.Paths[template]
+		for _, method := range []string{"GET", "PUT", "POST", "PATCH", "DELETE"} {
+			routed := false
+			for _, allowed := range methods {
+				routed = routed || allowed == method
+			}
+			if documented := item.Operation(method) != nil; routed != documented {
+				t.Errorf("%s %s is routed %t, documented %t", method, template, routed, documented)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// TestResponsesMatchOpenAPI calls every documented operation and fails when a response drifts from its schema.
+func TestResponsesMatchOpenAPI(t *testing.T) {
+	_, listener := newContractTestServer(t)
+	// values of path parameters captured from earlier responses, they are replaced in paths and bodies
+	captured := map[string]string{"{delivery_id}": "00000000-0000-0000-0000-000000000000"}
+
+	tests := []struct {
+		method   string
+		template string
+		body     string
+		status   int
+		capture  map[string]string
+	}{
+		{"GET", "/api/v0/health", "", 200, nil},
+		{"GET", "/api/v0/health/live", "", 200, nil},
+		{"GET", "/api/v0/health/ready", "", 200, nil},
+		{"GET", "/api/v0/openapi.json", "", 200, nil},
+		{"POST", "/api/v0/devices", `{"algorithm": "ECC", "label": "till"}`, 200, map[string]string{"{uuid}": "uuid"}},
+		{"PUT", "/api/v0/devices/{uuid}", `{"algorithm": "ECC", "label": "till"}`, 200, nil},
+		{"GET", "/api/v0/devices/{uuid}", "", 200, nil},
+		{"PATCH", "/api/v0/devices/{uuid}", `{"version": 0, "label": "front till", "metadata": {"store": "berlin"}}`, 200, nil},
+		{"POST", "/api/v0/devices/{uuid}/sign", `{"data": "receipt"}`, 200, nil},
+		{"GET", "/api/v0/devices", "", 200, nil},
+		{"POST", "/api/v0/devices/{uuid}/suspend", "", 200, nil},
+		{"POST", "/api/v0/devices/{uuid}/sign", `{"data": "receipt"}`, 409, nil},
+		{"POST", "/api/v0/devices/{uuid}/resume", "", 200, nil},
+		{"POST", "/api/v0/devices/{uuid}/decommission", "", 200, nil},
+		{"POST", "/api/v0/api-keys", `{"name": "till", "roles": ["signer"]}`, 201, map[string]string{"{id}": "id", "{organization_id}": "organization_id"}},
+		{"GET", "/api/v0/api-keys", "", 200, nil},
+		{"PUT", "/api/v0/api-keys/{id}/devices", `{"device_ids": []}`, 200, nil},
+		{"PUT", "/api/v0/api-keys/{id}/certificate", `{"subject": "CN=till,O={organization_id}"}`, 200, nil},
+		{"POST", "/api/v0/api-keys/{id}/revoke", "", 200, nil},
+		{"GET", "/api/v0/audit", "", 200, nil},
+		{"GET", "/api/v0/audit/verify", "", 200, nil},
+		{"POST", "/api/v0/organizations", `{"name": "shop"}`, 201, nil},
+		{"GET", "/api/v0/organizations", "", 200, nil},
+		{
+			"POST",
+			"/api/v0/webhooks",
+			`{"url": "https://example.com/hook", "event_types": ["signature.created"], "secret": "0123456789abcdef"}`,
+			201,
+			map[string]string{"{id}": "id"},
+		},
+		{"GET", "/api/v0/webhooks", "", 200, nil},
+		{"GET", "/api/v0/webhooks/{id}", "", 200, nil},
+		{"GET", "/api/v0/webhooks/{id}/deliveries", "", 200, nil},
+		{"POST", "/api/v0/webhooks/{id}/deliveries/{delivery_id}/redeliver", "", 404, nil},
+		{"DELETE", "/api/v0/webhooks/{id}", "", 204, nil},
+		{"GET", "/api/v0/devices/{uuid}", "", 200, nil},
+	}
+
+	called := make(map[string]bool)
+	for _, test := range tests {
+		path, requestBody := test.template, test.body
+		for placeholder, value := range captured {
+			path = strings.ReplaceAll(path, placeholder, value)
+			requestBody = strings.ReplaceAll(requestBody, placeholder, value)
+		}
+		request, _ := http.NewRequest(test.method, listener.URL+path, strings.NewReader(requestBody))
+		request.Header.Set("Authorization", "Bearer "+contractTestToken)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		operation := test.method + " " + test.template
+		called[operation] = true
+		if response.StatusCode != test.status {
+			t.Errorf("%s answered %d %s, want %d", operation, response.StatusCode, body, test.status)
+			continue
+		}
+		if err = openAPI.validateResponse(test.method, test.template, response.StatusCode, body); err != nil {
+			t.Errorf(err.Error())
+		}
+
+		var envelope struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(body, &envelope)
+		for placeholder, field := range test.capture {
+			captured[placeholder], _ = envelope.Data[field].(string)
+		}
+	}
+
+	// streams are covered by stream_test.go
+	called["GET /api/v0/events"] = true
+	called["GET /api/v0/devices/{uuid}/events"] = true
+	var uncalled []string
+	for template, item := range openAPI.Paths {
+		for _, method := range []string{"GET", "PUT", "POST", "PATCH", "DELETE"} {
+			if item.Operation(method) != nil && !called[method+" "+template] {
+				uncalled = append(uncalled, method+" "+template)
+			}
+		}
+	}
+	sort.Strings(uncalled)
+	if len(uncalled) > 0 {
+		t.Errorf("operations without a contract test: %v", uncalled)
+	}
+}
+
+func TestRequestsAreValidatedAgainstOpenAPI(t *testing.T) {
+	_, listener := newContractTestServer(t)
+	tests := []struct {
+		name   string
+		body   string
+		params []string
+	}{
+		{"wrong type", `{"algorithm": 1}`, []string{"algorithm"}},
+		{"missing field", `{"label": "till"}`, []string{"algorithm"}},
+		{"unknown field", `{"algorithm": "ECC", "colour": "red"}`, []string{"colour"}},
+		{"not an object", `[]`, []string{"body"}},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest("POST", listener.URL+"/api/v0/devices", strings.NewReader(test.body))
+		request.Header.Set("Authorization", "Bearer "+contractTestToken)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var problem Problem
+		json.NewDecoder(response.Body).Decode(&problem)
+		response.Body.Close()
+
+		var params []string
+		for _, invalidParam := range problem.InvalidParams {
+			params = append(params, invalidParam.Name)
+		}
+		if response.StatusCode != 400 || problem.Code != CodeValidationFailed || strings.Join(params, ",") != strings.Join(test.params, ",") {
+			t.Errorf("%s: answered %d %+v, want validation failure of %v", test.name, response.StatusCode, problem, test.params)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Organizations handles api/v0/organizations route
+func (s *Server) Organizations(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+		WriteAPIResponse(response, 200, s.organizationService.ListOrganizations())
+	case "POST":
+		s.createOrganization(response, request)
+	default:
+		writeMethodNotAllowed(response, "GET", "POST")
+	}
+}
+
+type createOrganizationParams struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) createOrganization(response http.ResponseWriter, request *http.Request) {
+	var params createOrganizationParams
+	read, _ := io.ReadAll(request.Body)
+	err := json.Unmarshal(read, &params)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	organization, err := s.organizationService.CreateOrganization(actor(request), params.Name)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 201, organization)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newTenant onboards an organization on the contract test server and returns the token of its admin key
+func newTenant(t *testing.T, server *Server, name string) string {
+	organization, err := server.organizationService.CreateOrganization("operator", name)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	apiKey, err := server.apiKeyService.CreateAPIKey(organization.ID, "operator", "admin", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return apiKey.Token
+}
+
+func TestOrganizationsAreOperatorOnly(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+	tenantToken := newTenant(t, server, "shop")
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		body   string
+		status int
+	}{
+		{"operator lists", contractTestToken, "GET", "", http.StatusOK},
+		{"operator onboards", contractTestToken, "POST", `{"name": "bakery"}`, http.StatusCreated},
+		{"operator onboards without name", contractTestToken, "POST", `{"name": " "}`, http.StatusBadRequest},
+		{"tenant admin lists", tenantToken, "GET", "", http.StatusNotFound},
+		{"tenant admin onboards", tenantToken, "POST", `{"name": "bakery"}`, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serveAs(handler, test.token, test.method, "/api/v0/organizations", test.body)
+			if recorder.Code != test.status {
+				t.Errorf("status = %v, want %v: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+		})
+	}
+
+	listed := serveAs(handler, contractTestToken, "GET", "/api/v0/organizations", "").Body.String()
+	if !strings.Contains(listed, `"shop"`) || !strings.Contains(listed, `"bakery"`) {
+		t.Errorf("organizations = %s, want the onboarded ones", listed)
+	}
+}
+
+func TestTenantsCantAccessEachOthersResources(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+	tokenA, tokenB := newTenant(t, server, "shop A"), newTenant(t, server, "shop B")
+	tenantB, err := server.apiKeyService.Authenticate(tokenB)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	deviceID := createdID(t, serveAs(handler, tokenA, "POST", "/api/v0/devices", `{"algorithm": "ECC", "label": "till"}`), "uuid")
+	apiKeyID := createdID(t, serveAs(handler, tokenA, "POST", "/api/v0/api-keys", `{"name": "till", "roles": ["signer"]}`), "id")
+	webhook := `{"url": "https://example.com/hook", "event_types": ["signature.created"], "secret": "0123456789abcdef"}`
+	webhookID := createdID(t, serveAs(handler, tokenA, "POST", "/api/v0/webhooks", webhook), "id")
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/api/v0/devices/" + deviceID, ""},
+		{"PATCH", "/api/v0/devices/" + deviceID, `{"version": 0, "label": "stolen"}`},
+		{"POST", "/api/v0/devices/" + deviceID + "/sign", `{"data": "receipt"}`},
+		{"POST", "/api/v0/devices/" + deviceID + "/suspend", ""},
+		{"POST", "/api/v0/devices/" + deviceID + "/decommission", ""},
+		{"PUT", "/api/v0/api-keys/" + apiKeyID + "/devices", `{"device_ids": ["*"]}`},
+		{"PUT", "/api/v0/api-keys/" + apiKeyID + "/certificate", `{"subject": "CN=till,O=` + tenantB.OrganizationID + `"}`},
+		{"POST", "/api/v0/api-keys/" + apiKeyID + "/revoke", ""},
+		{"GET", "/api/v0/webhooks/" + webhookID, ""},
+		{"GET", "/api/v0/webhooks/" + webhookID + "/deliveries", ""},
+		{"DELETE", "/api/v0/webhooks/" + webhookID, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			recorder := serveAs(handler, tokenB, test.method, test.path, test.body)
+			if recorder.Code != http.StatusNotFound {
+				t.Errorf("status = %v, want %v: %s", recorder.Code, http.StatusNotFound, recorder.Body.String())
+			}
+		})
+	}
+
+	for _, path := range []string{"/api/v0/devices", "/api/v0/api-keys", "/api/v0/webhooks"} {
+		listed := serveAs(handler, tokenB, "GET", path, "").Body.String()
+		for _, id := range []string{deviceID, apiKeyID, webhookID} {
+			if strings.Contains(listed, id) {
+				t.Errorf("%s of tenant B lists %s of tenant A", path, id)
+			}
+		}
+	}
+	// tenant A still owns everything
+	if recorder := serveAs(handler, tokenA, "GET", "/api/v0/devices/"+deviceID, ""); recorder.Code != http.StatusOK {
+		t.Errorf("tenant A lost its device: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"log/slog"
+	"net/http"
+)
+
+// ProblemContentType is the media type of error responses (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix turns a problem code into the URI identifying the problem type
+const problemTypePrefix = "urn:signing-service:problem:"
+
+// Stable problem codes clients can switch on, they never change once released.
+const (
+	CodeInvalidRequest          = "invalid_request"
+	CodeValidationFailed        = "validation_failed"
+	CodeInvalidAlgorithm        = "invalid_algorithm"
+	CodeUnauthenticated         = "unauthenticated"
+	CodeForbidden               = "forbidden"
+	CodeNotFound                = "not_found"
+	CodeMethodNotAllowed        = "method_not_allowed"
+	CodeConflict                = "conflict"
+	CodeDeviceConflict          = "device_conflict"
+	CodeDeviceSuspended         = "device_suspended"
+	CodeDeviceDecommissioned    = "device_decommissioned"
+	CodeInvalidStatusTransition = "invalid_status_transition"
+	CodeVersionConflict         = "version_conflict"
+	CodeAPIKeyRevoked           = "api_key_revoked"
+	CodeIdempotencyKeyMismatch  = "idempotency_key_mismatch"
+	CodeEventsExpired           = "events_expired"
+	CodeInternalError           = "internal_error"
+)
+
+// Problem is the machine-readable error response container (RFC 7807).
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Code          string         `json:"code"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+	// Errors repeats the details as the {"errors": [...]} body clients used before problem details
+	Errors []string `json:"errors"`
+}
+
+// InvalidParam names a request parameter rejected by validation and why.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// NewProblem creates a Problem with the type and title derived from code and status.
+func NewProblem(status int, code string, details ...string) Problem {
+	problem := Problem{
+		Type:   problemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Errors: details,
+	}
+	if len(details) == 1 {
+		problem.Detail = details[0]
+	}
+	if problem.Errors == nil {
+		problem.Errors = []string{}
+	}
+	return problem
+}
+
+// sentinelProblems maps domain sentinel errors to their HTTP status and problem code
+var sentinelProblems = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{domain.ErrDeviceSuspended, http.StatusConflict, CodeDeviceSuspended},
+	{domain.ErrDeviceDecommissioned, http.StatusConflict, CodeDeviceDecommissioned},
+	{domain.ErrVersionConflict, http.StatusConflict, CodeVersionConflict},
+	{domain.ErrDeviceConflict, http.StatusConflict, CodeDeviceConflict},
+	{domain.ErrDeviceExists, http.StatusConflict, CodeDeviceConflict},
+	{domain.ErrAPIKeyRevoked, http.StatusConflict, CodeAPIKeyRevoked},
+	{domain.ErrCertificateSubjectBound, http.StatusConflict, CodeConflict},
+	{domain.ErrDeliveryNotDead, http.StatusConflict, CodeConflict},
+	{domain.ErrSubscriptionDeleted, http.StatusConflict, CodeConflict},
+	{domain.ErrIdempotencyKeyMismatch, http.StatusUnprocessableEntity, CodeIdempotencyKeyMismatch},
+	{domain.ErrUnauthenticated, http.StatusUnauthorized, CodeUnauthenticated},
+	{domain.ErrEventsExpired, http.StatusGone, CodeEventsExpired},
+}
+
+// ProblemFor maps err to the Problem describing it.
+// Errors the domain doesn't define become internal errors without leaking their message.
+func ProblemFor(err error) Problem {
+	for _, sentinel := range sentinelProblems {
+		if errors.Is(err, sentinel.err) {
+			return NewProblem(sentinel.status, sentinel.code, err.Error())
+		}
+	}
+
+	var notFound domain.NotFoundError
+	var validation domain.ValidationError
+	var invalidAlgorithm domain.InvalidAlgorithmError
+	var transition domain.StatusTransitionError
+	var syntax *json.SyntaxError
+	var unmarshalType *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &notFound):
+		return NewProblem(http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.As(err, &validation):
+		problem := NewProblem(http.StatusBadRequest, CodeValidationFailed, err.Error())
+		problem.InvalidParams = []InvalidParam{{Name: validation.Field, Reason: validation.Message}}
+		return problem
+	case errors.As(err, &invalidAlgorithm):
+		problem := NewProblem(http.StatusBadRequest, CodeInvalidAlgorithm, err.Error())
+		problem.InvalidParams = []InvalidParam{{Name: "algorithm", Reason: err.Error()}}
+		return problem
+	case errors.As(err, &transition):
+		return NewProblem(http.StatusConflict, CodeInvalidStatusTransition, err.Error())
+	case errors.As(err, &syntax), errors.As(err, &unmarshalType):
+		return NewProblem(http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	default:
+		return NewProblem(
+			http.StatusInternalServerError,
+			CodeInternalError,
+			http.StatusText(http.StatusInternalServerError),
+		)
+	}
+}
+
+// codeForStatus is the problem code of errors that only carry an HTTP status
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	default:
+		return CodeInternalError
+	}
+}
+
+// WriteError writes err as problem details, the HTTP status follows from the error type.
+// Unexpected errors are logged with the request ID of request, as their message isn't part of the response.
+func WriteError(w http.ResponseWriter, request *http.Request, err error) {
+	problem := ProblemFor(err)
+	if problem.Code == CodeInternalError {
+		slog.ErrorContext(request.Context(), "Unexpected error", "error", err)
+	}
+	WriteProblem(w, problem)
+}
+
+// WriteProblem writes problem as an application/problem+json response.
+func WriteProblem(w http.ResponseWriter, problem Problem) {
+	bytes, err := json.MarshalIndent(problem, "", "  ")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(bytes)
+}
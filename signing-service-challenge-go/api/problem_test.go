@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"not found", domain.NotFoundError{Resource: "signature device", ID: "id"}, 404, CodeNotFound},
+		{"validation", domain.ValidationError{Field: "label", Message: "too long"}, 400, CodeValidationFailed},
+		{"invalid algorithm", domain.InvalidAlgorithmError{Algorithm: "dsa"}, 400, CodeInvalidAlgorithm},
+		{"suspended", domain.ErrDeviceSuspended, 409, CodeDeviceSuspended},
+		{"decommissioned", domain.ErrDeviceDecommissioned, 409, CodeDeviceDecommissioned},
+		{"transition", domain.StatusTransitionError{From: domain.DeviceActive, To: domain.DeviceActive}, 409, CodeInvalidStatusTransition},
+		{"wrapped conflict", fmt.Errorf("device exists: %w", domain.ErrDeviceConflict), 409, CodeDeviceConflict},
+		{"version conflict", domain.ErrVersionConflict, 409, CodeVersionConflict},
+		{"certificate subject", domain.ErrCertificateSubjectBound, 409, CodeConflict},
+		{"delivery not dead", fmt.Errorf("webhook delivery is pending: %w", domain.ErrDeliveryNotDead), 409, CodeConflict},
+		{"subscription deleted", domain.ErrSubscriptionDeleted, 409, CodeConflict},
+		{"idempotency", domain.ErrIdempotencyKeyMismatch, 422, CodeIdempotencyKeyMismatch},
+		{"malformed json", json.Unmarshal([]byte("{"), &struct{}{}), 400, CodeInvalidRequest},
+		{"unexpected", errors.New("disk on fire"), 500, CodeInternalError},
+	}
+	for _, test := range tests {
+		problem := ProblemFor(test.err)
+		if problem.Status != test.status || problem.Code != test.code {
+			t.Errorf("%s: ProblemFor() = %d %s, want %d %s", test.name, problem.Status, problem.Code, test.status, test.code)
+		}
+		if problem.Type != problemTypePrefix+test.code {
+			t.Errorf("%s: type = %q, want it derived from the code", test.name, problem.Type)
+		}
+	}
+
+	if problem := ProblemFor(errors.New("disk on fire")); strings.Contains(problem.Detail, "disk") {
+		t.Errorf("internal error detail %q leaks the error", problem.Detail)
+	}
+}
+
+func TestCreateDeviceWithInvalidAlgorithmWritesProblem(t *testing.T) {
+	server := newStreamTestServer(t, 0)
+	admin, err := server.apiKeys.CreateAPIKey("organization", "admin", "admin", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	request, _ := http.NewRequest("POST", server.url+"/api/v0/devices", strings.NewReader(`{"algorithm": "DSA"}`))
+	request.Header.Set("Authorization", "Bearer "+admin.Token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer response.Body.Close()
+
+	var problem Problem
+	if err = json.NewDecoder(response.Body).Decode(&problem); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if response.Header.Get("Content-Type") != ProblemContentType {
+		t.Errorf("Content-Type = %q, want %q", response.Header.Get("Content-Type"), ProblemContentType)
+	}
+	if response.StatusCode != 400 || problem.Code != CodeInvalidAlgorithm || problem.Status != 400 {
+		t.Errorf("POST with algorithm DSA answered %d %+v, want 400 %s", response.StatusCode, problem, CodeInvalidAlgorithm)
+	}
+}
+
+func TestWriteErrorResponseKeepsErrors(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	WriteErrorResponse(recorder, 403, []string{"API key lacks permission devices:manage"})
+
+	var problem Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if problem.Code != CodeForbidden || len(problem.Errors) != 1 || problem.Detail != problem.Errors[0] {
+		t.Errorf("WriteErrorResponse() wrote %s, want forbidden problem keeping the errors", recorder.Body)
+	}
+}
+
+func TestUnsupportedMethodsAreNotAllowed(t *testing.T) {
+	server, listener := newContractTestServer(t)
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{"DELETE", "/api/v0/devices", "GET, POST"},
+		{"POST", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1", "GET, PUT, PATCH"},
+		{"GET", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1/sign", "POST"},
+		{"PATCH", "/api/v0/api-keys", "GET, POST"},
+		{"PUT", "/api/v0/webhooks/id", "GET, DELETE"},
+		{"POST", "/api/v0/events", "GET"},
+		{"DELETE", "/api/v0/organizations", "GET, POST"},
+		{"POST", "/api/v0/openapi.json", "GET"},
+		{"POST", "/api/v0/health/ready", "GET"},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(test.method, listener.URL+test.path, nil)
+		request.Header.Set("Authorization", "Bearer "+contractTestToken)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var problem Problem
+		json.NewDecoder(response.Body).Decode(&problem)
+		response.Body.Close()
+		if response.StatusCode != 405 || problem.Code != CodeMethodNotAllowed || response.Header.Get("Content-Type") != ProblemContentType {
+			t.Errorf("%s %s answered %d %+v, want 405 %s", test.method, test.path, response.StatusCode, problem, CodeMethodNotAllowed)
+		}
+		if allow := response.Header.Get("Allow"); allow != test.allow {
+			t.Errorf("%s %s: Allow = %q, want %q", test.method, test.path, allow, test.allow)
+		}
+	}
+
+	// handlers reject unsupported methods themselves too, whatever router they are mounted on
+	recorder := httptest.NewRecorder()
+	server.Webhooks(recorder, httptest.NewRequest("DELETE", "/api/v0/webhooks", nil))
+	if recorder.Code != 405 || recorder.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("Webhooks() answered DELETE with %d, Allow %q", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
+
+func TestUnknownPathsWriteProblem(t *testing.T) {
+	_, listener := newContractTestServer(t)
+	response, err := http.Get(listener.URL + "/api/v0/unknown")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer response.Body.Close()
+
+	var problem Problem
+	if err = json.NewDecoder(response.Body).Decode(&problem); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if response.StatusCode != 404 || problem.Code != CodeNotFound || response.Header.Get("Content-Type") != ProblemContentType {
+		t.Errorf("GET of an unknown path answered %d %+v, want 404 %s", response.StatusCode, problem, CodeNotFound)
+	}
+}
@@ -1,79 +1,304 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Response is the generic API response container.
 type Response struct {
-	Data interface{} `json:"data"`
+	Data       interface{} `json:"data"`
+	Pagination *Pagination `json:"pagination,omitempty"`
 }
 
-// ErrorResponse is the generic error API response container.
-type ErrorResponse struct {
-	Errors []string `json:"errors"`
+// Pagination is attached to responses listing one page of a collection.
+type Pagination struct {
+	// NextCursor requests the following page, it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
-	listenAddress     string
-	devicesRepository domain.DevicesRepository
+	listenAddress       string
+	deviceService       *domain.DeviceService
+	apiKeyService       *domain.APIKeyService
+	organizationService *domain.OrganizationService
+	auditLog            *domain.AuditLog
+	webhookService      *domain.WebhookService
+	eventStream         *domain.EventStream
+	// shutdown is closed when the server shuts down, so event streams end instead of holding up the shutdown
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	// metrics is nil unless EnableMetrics was called
+	metrics *metrics.Registry
+	// tracer is nil unless EnableTracing was called
+	tracer trace.Tracer
+}
+
+// Timeouts bound how long the server waits for clients, zero disables a timeout.
+type Timeouts struct {
+	// Read covers reading a request including its body, Write covers handling it and writing the response
+	Read  time.Duration
+	Write time.Duration
+	// Idle is how long a keep-alive connection waits for the next request
+	Idle time.Duration
+	// Shutdown is how long in-flight requests may take to finish on shutdown
+	Shutdown time.Duration
+}
+
+// DefaultTimeouts are generous enough for RSA key generation on a busy server
+var DefaultTimeouts = Timeouts{
+	Read:     10 * time.Second,
+	Write:    30 * time.Second,
+	Idle:     2 * time.Minute,
+	Shutdown: 30 * time.Second,
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string, devicesRepository domain.DevicesRepository) *Server {
+func NewServer(
+	listenAddress string,
+	deviceService *domain.DeviceService,
+	apiKeyService *domain.APIKeyService,
+	organizationService *domain.OrganizationService,
+	auditLog *domain.AuditLog,
+	webhookService *domain.WebhookService,
+	eventStream *domain.EventStream,
+) *Server {
 	return &Server{
-		listenAddress:     listenAddress,
-		devicesRepository: devicesRepository,
+		listenAddress:       listenAddress,
+		deviceService:       deviceService,
+		apiKeyService:       apiKeyService,
+		organizationService: organizationService,
+		auditLog:            auditLog,
+		webhookService:      webhookService,
+		eventStream:         eventStream,
+		shutdown:            make(chan struct{}),
 	}
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
-	router := mux.NewRouter()
+// Run starts the Server on a plain HTTP listener and serves until ctx is done, see Serve.
+func (s *Server) Run(ctx context.Context, timeouts Timeouts) error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener, timeouts)
+}
 
-	router.Handle("/api/v0/health", http.HandlerFunc(s.Health))
-	router.Handle("/api/v0/devices/{uuid}/sign", http.HandlerFunc(s.DeviceSign))
-	router.Handle("/api/v0/devices/{uuid}", http.HandlerFunc(s.Device))
-	router.Handle("/api/v0/devices", http.HandlerFunc(s.Devices))
+// RunTLS starts the Server on a TLS listener with certificates served by reloader and serves until ctx is done,
+// see Serve.
+func (s *Server) RunTLS(ctx context.Context, reloader *CertificateReloader, timeouts Timeouts) error {
+	server := s.httpServer(timeouts)
+	server.Addr = s.listenAddress
+	server.TLSConfig = reloader.TLSConfig()
+	return s.serveUntilDone(ctx, server, timeouts.Shutdown, func() error {
+		return server.ListenAndServeTLS("", "")
+	})
+}
 
-	return http.ListenAndServe(s.listenAddress, router)
+// Serve serves plain HTTP on listener until ctx is done. Then it stops accepting connections, ends event streams
+// and waits up to timeouts.Shutdown for in-flight requests, so no signature gets lost halfway.
+// It returns nil once all requests finished.
+func (s *Server) Serve(ctx context.Context, listener net.Listener, timeouts Timeouts) error {
+	server := s.httpServer(timeouts)
+	return s.serveUntilDone(ctx, server, timeouts.Shutdown, func() error {
+		return server.Serve(listener)
+	})
 }
 
-// WriteInternalError writes a default internal error message as an HTTP response.
-func WriteInternalError(w http.ResponseWriter) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+func (s *Server) httpServer(timeouts Timeouts) *http.Server {
+	server := &http.Server{
+		Handler:      s.Handler(),
+		ReadTimeout:  timeouts.Read,
+		WriteTimeout: timeouts.Write,
+		IdleTimeout:  timeouts.Idle,
+	}
+	server.RegisterOnShutdown(func() {
+		s.shutdownOnce.Do(func() { close(s.shutdown) })
+	})
+	return server
 }
 
-// WriteErrorResponse takes an HTTP status code and a slice of errors
-// and writes those as an HTTP error response in a structured format.
-func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
-	w.WriteHeader(code)
+func (s *Server) serveUntilDone(
+	ctx context.Context,
+	server *http.Server,
+	shutdownTimeout time.Duration,
+	serve func() error,
+) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- serve()
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
 
-	errorResponse := ErrorResponse{
-		Errors: errors,
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("in-flight requests didn't finish within %s: %w", shutdownTimeout, err)
 	}
+	return nil
+}
 
-	bytes, err := json.Marshal(errorResponse)
-	if err != nil {
-		WriteInternalError(w)
+// EnableMetrics records every request in registry, it must be called before Handler.
+// The metrics cover all organizations, so they are served by MetricsHandler on a separate listener.
+func (s *Server) EnableMetrics(registry *metrics.Registry) {
+	s.metrics = registry
+}
+
+// Handler serves the API, every request is logged with its request ID, see RequestLogging.
+func (s *Server) Handler() http.Handler {
+	router := s.router()
+	if s.metrics == nil {
+		return RequestLogging(router)
 	}
+	return RequestLogging(s.metrics.Middleware(router))
+}
 
-	w.Write(bytes)
+// MetricsHandler serves the registry of EnableMetrics at /metrics, scrapes aren't recorded themselves
+func (s *Server) MetricsHandler() http.Handler {
+	handler := http.NewServeMux()
+	handler.Handle("/metrics", s.metrics.Handler())
+	return handler
+}
+
+// RunMetrics serves MetricsHandler on listenAddress until ctx is done
+func (s *Server) RunMetrics(ctx context.Context, listenAddress string, timeouts Timeouts) error {
+	server := &http.Server{
+		Addr:         listenAddress,
+		Handler:      s.MetricsHandler(),
+		ReadTimeout:  timeouts.Read,
+		WriteTimeout: timeouts.Write,
+		IdleTimeout:  timeouts.Idle,
+	}
+	return s.serveUntilDone(ctx, server, timeouts.Shutdown, server.ListenAndServe)
+}
+
+// router registers all HandlerFuncs for the existing HTTP routes.
+func (s *Server) router() *mux.Router {
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		WriteErrorResponse(response, http.StatusNotFound, []string{"not found"})
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		writeMethodNotAllowed(response, allowedMethods(router, request)...)
+	})
+	if s.tracer != nil {
+		router.Use(s.tracing)
+	}
+
+	devices := methodPermissions{
+		"GET":   domain.PermissionReadDevices,
+		"POST":  domain.PermissionManageDevices,
+		"PUT":   domain.PermissionManageDevices,
+		"PATCH": domain.PermissionManageDevices,
+	}
+	signing := methodPermissions{"POST": domain.PermissionSignTransactions}
+	lifecycle := methodPermissions{"POST": domain.PermissionManageDevices}
+	events := methodPermissions{"GET": domain.PermissionReadDevices}
+	apiKeys := methodPermissions{}
+	audit := methodPermissions{"GET": domain.PermissionReadAudit}
+	webhooks := methodPermissions{
+		"GET":    domain.PermissionManageWebhooks,
+		"POST":   domain.PermissionManageWebhooks,
+		"DELETE": domain.PermissionManageWebhooks,
+	}
+	organizations := methodPermissions{
+		"GET":  domain.PermissionManageOrganizations,
+		"POST": domain.PermissionManageOrganizations,
+	}
+
+	router.Handle("/api/v0/health", http.HandlerFunc(s.Health)).Methods("GET")
+	router.Handle("/api/v0/health/live", http.HandlerFunc(s.HealthLive)).Methods("GET")
+	router.Handle("/api/v0/health/ready", http.HandlerFunc(s.HealthReady)).Methods("GET")
+	router.Handle("/api/v0/openapi.json", http.HandlerFunc(s.OpenAPIDocument)).Methods("GET")
+	router.Handle("/api/v0/devices/{uuid}/sign", s.Authenticated(signing, s.DeviceSign)).Methods("POST")
+	router.Handle("/api/v0/devices/{uuid}/suspend", s.Authenticated(lifecycle, s.DeviceSuspend)).Methods("POST")
+	router.Handle("/api/v0/devices/{uuid}/resume", s.Authenticated(lifecycle, s.DeviceResume)).Methods("POST")
+	router.Handle("/api/v0/devices/{uuid}/decommission", s.Authenticated(lifecycle, s.DeviceDecommission)).Methods("POST")
+	router.Handle("/api/v0/devices/{uuid}/events", s.Authenticated(events, s.DeviceEvents)).Methods("GET")
+	router.Handle("/api/v0/devices/{uuid}", s.Authenticated(devices, s.Device)).Methods("GET", "PUT", "PATCH")
+	router.Handle("/api/v0/devices", s.Authenticated(devices, s.Devices)).Methods("GET", "POST")
+	router.Handle("/api/v0/events", s.Authenticated(events, s.Events)).Methods("GET")
+	router.Handle("/api/v0/api-keys/{id}/revoke", s.Authenticated(apiKeys, s.APIKeyRevoke)).Methods("POST")
+	router.Handle("/api/v0/api-keys/{id}/certificate", s.Authenticated(apiKeys, s.APIKeyCertificate)).Methods("PUT")
+	router.Handle("/api/v0/api-keys/{id}/devices", s.Authenticated(apiKeys, s.APIKeyDevices)).Methods("PUT")
+	router.Handle("/api/v0/api-keys", s.Authenticated(apiKeys, s.APIKeys)).Methods("GET", "POST")
+	router.Handle("/api/v0/audit/verify", s.Authenticated(audit, s.AuditVerify)).Methods("GET")
+	router.Handle("/api/v0/audit", s.Authenticated(audit, s.Audit)).Methods("GET")
+	router.Handle("/api/v0/webhooks/{id}/deliveries/{delivery_id}/redeliver", s.Authenticated(webhooks, s.WebhookRedeliver)).
+		Methods("POST")
+	router.Handle("/api/v0/webhooks/{id}/deliveries", s.Authenticated(webhooks, s.WebhookDeliveries)).Methods("GET")
+	router.Handle("/api/v0/webhooks/{id}", s.Authenticated(webhooks, s.Webhook)).Methods("GET", "DELETE")
+	router.Handle("/api/v0/webhooks", s.Authenticated(webhooks, s.Webhooks)).Methods("GET", "POST")
+	router.Handle("/api/v0/organizations", s.Authenticated(organizations, s.OperatorOnly(s.Organizations))).
+		Methods("GET", "POST")
+	return router
+}
+
+// allowedMethods lists the methods of the routes matching the path of request
+func allowedMethods(router *mux.Router, request *http.Request) []string {
+	var allowed []string
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		var match mux.RouteMatch
+		if !route.Match(request, &match) && match.MatchErr == mux.ErrMethodMismatch {
+			methods, _ := route.GetMethods()
+			allowed = append(allowed, methods...)
+		}
+		return nil
+	})
+	return allowed
+}
+
+// writeMethodNotAllowed answers requests with a method the resource doesn't support, allowed are those it does
+func writeMethodNotAllowed(response http.ResponseWriter, allowed ...string) {
+	response.Header().Set("Allow", strings.Join(allowed, ", "))
+	WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{http.StatusText(http.StatusMethodNotAllowed)})
+}
+
+// WriteInternalError writes a default internal error message as an HTTP response.
+func WriteInternalError(w http.ResponseWriter) {
+	WriteProblem(w, NewProblem(
+		http.StatusInternalServerError,
+		CodeInternalError,
+		http.StatusText(http.StatusInternalServerError),
+	))
+}
+
+// WriteErrorResponse takes an HTTP status code and a slice of errors
+// and writes those as problem details with the generic code of the status.
+func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
+	WriteProblem(w, NewProblem(code, codeForStatus(code), errors...))
 }
 
 // WriteAPIResponse takes an HTTP status code and a generic data struct
 // and writes those as an HTTP response in a structured format.
 func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
-	w.WriteHeader(code)
+	writeResponse(w, code, Response{Data: data})
+}
 
-	response := Response{
-		Data: data,
-	}
+// WriteAPIPage writes one page of a collection together with its pagination.
+func WriteAPIPage(w http.ResponseWriter, code int, data interface{}, pagination Pagination) {
+	writeResponse(w, code, Response{Data: data, Pagination: &pagination})
+}
+
+func writeResponse(w http.ResponseWriter, code int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 
 	bytes, err := json.MarshalIndent(response, "", "  ")
 	if err != nil {
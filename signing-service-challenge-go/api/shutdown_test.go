@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// blockingDevicesRepository holds counter updates until release is closed
+type blockingDevicesRepository struct {
+	*persistence.InMemoryDevicesRepository
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (repo *blockingDevicesRepository) IncrementCounter(ctx context.Context, device domain.SignatureDevice, events ...domain.Event) error {
+	repo.entered <- struct{}{}
+	<-repo.release
+	return repo.InMemoryDevicesRepository.IncrementCounter(ctx, device, events...)
+}
+
+type shutdownTestServer struct {
+	url    string
+	token  string
+	device string
+	repo   *blockingDevicesRepository
+	served chan error
+	stop   context.CancelFunc
+}
+
+// newShutdownTestServer serves on a local listener until stop is called, Serve's result is sent to served
+func newShutdownTestServer(t *testing.T, timeouts Timeouts) *shutdownTestServer {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	repo := &blockingDevicesRepository{
+		InMemoryDevicesRepository: persistence.NewInMemoryDevicesRepository(),
+		entered:                   make(chan struct{}),
+		release:                   make(chan struct{}),
+	}
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	deviceService := domain.NewDeviceService(
+		repo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "till", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	device, err := deviceService.CreateSignatureDevice(context.Background(), "organization", "admin", domain.ECC, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	server := NewServer("", deviceService, apiKeyService, nil, auditLog, nil, domain.NewEventStream(repo))
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, listener, timeouts)
+	}()
+	return &shutdownTestServer{
+		url:    "http://" + listener.Addr().String(),
+		token:  apiKey.Token,
+		device: device.UUID,
+		repo:   repo,
+		served: served,
+		stop:   stop,
+	}
+}
+
+func (server *shutdownTestServer) request(t *testing.T, method string, path string, body string) *http.Request {
+	request, err := http.NewRequest(method, server.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	request.Header.Set("Authorization", "Bearer "+server.token)
+	return request
+}
+
+func (server *shutdownTestServer) waitServed(t *testing.T) error {
+	select {
+	case err := <-server.served:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve() didn't return")
+		return nil
+	}
+}
+
+func TestServeDrainsInFlightSignOnShutdown(t *testing.T) {
+	server := newShutdownTestServer(t, Timeouts{Read: time.Second, Write: 5 * time.Second, Shutdown: 5 * time.Second})
+
+	// a fresh client, so the shutdown can't be hidden by a kept-alive connection
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	signed := make(chan *http.Response, 1)
+	go func() {
+		response, err := client.Do(server.request(t, "POST", "/api/v0/devices/"+server.device+"/sign", `{"data": "receipt"}`))
+		if err != nil {
+			t.Errorf("in-flight sign failed: %v", err)
+			close(signed)
+			return
+		}
+		signed <- response
+	}()
+	<-server.repo.entered
+
+	server.stop()
+	refused := false
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := client.Do(server.request(t, "GET", "/api/v0/devices/"+server.device, "")); err != nil {
+			refused = true
+			break
+		}
+	}
+	if !refused {
+		t.Errorf("new requests are still accepted during the shutdown")
+	}
+	select {
+	case err := <-server.served:
+		t.Fatalf("Serve() returned %v before the in-flight sign finished", err)
+	default:
+	}
+
+	close(server.repo.release)
+	response, ok := <-signed
+	if !ok {
+		t.FailNow()
+	}
+	response.Body.Close()
+	if response.StatusCode != 200 {
+		t.Errorf("in-flight sign answered %d, want 200", response.StatusCode)
+	}
+	if err := server.waitServed(t); err != nil {
+		t.Errorf("Serve() error = %v, want a clean shutdown", err)
+	}
+	device, _ := server.repo.Get(context.Background(), "organization", server.device)
+	if device.SignatureCounter != 1 {
+		t.Errorf("signature counter = %d after the shutdown, want 1", device.SignatureCounter)
+	}
+}
+
+func TestServeEndsEventStreamsOnShutdown(t *testing.T) {
+	// streams aren't bound by the write timeout
+	server := newShutdownTestServer(t, Timeouts{Write: 50 * time.Millisecond, Shutdown: 5 * time.Second})
+	response, err := http.DefaultClient.Do(server.request(t, "GET", "/api/v0/devices/"+server.device+"/events", ""))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		t.Fatalf("GET events answered %d", response.StatusCode)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	server.stop()
+	ended := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, response.Body)
+		ended <- err
+	}()
+	select {
+	case err = <-ended:
+		if err != nil {
+			t.Errorf("stream ended with %v, want it to end cleanly", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("stream is still open during the shutdown")
+	}
+	if err = server.waitServed(t); err != nil {
+		t.Errorf("Serve() error = %v, want a clean shutdown", err)
+	}
+}
+
+func TestServeReadTimeoutClosesSlowClients(t *testing.T) {
+	server := newShutdownTestServer(t, Timeouts{Read: 100 * time.Millisecond, Shutdown: time.Second})
+	connection, err := net.Dial("tcp", strings.TrimPrefix(server.url, "http://"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer connection.Close()
+	// the request line arrives, the headers never do
+	if _, err = io.WriteString(connection, "GET /api/v0/health HTTP/1.1\r\n"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if err = connection.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = io.ReadAll(connection); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("connection of a slow client is still open after the read timeout")
+	}
+}
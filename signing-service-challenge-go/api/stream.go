@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// streamHeartbeatInterval keeps idle event streams from being closed by proxies
+	streamHeartbeatInterval = 15 * time.Second
+	streamBatchSize         = 100
+)
+
+// DeviceEvents handles api/v0/devices/{uuid}/events route.
+// Signatures carry the device's signature counter as event id, so a reconnecting client
+// resumes with Last-Event-ID after its last received signature. State changes carry no id
+// and may be repeated on resume. Signatures that left the history retention window can't be resumed after.
+func (s *Server) DeviceEvents(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writeMethodNotAllowed(response, "GET")
+		return
+	}
+
+	id := mux.Vars(request)["uuid"]
+	if _, found := s.deviceService.GetSignatureDevice(request.Context(), organizationID(request), id); !found {
+		WriteErrorResponse(response, 404, []string{"not found"})
+		return
+	}
+
+	after := s.eventStream.LastSequence()
+	if lastEventID := request.Header.Get("Last-Event-ID"); lastEventID != "" {
+		signatureCounter, err := strconv.Atoi(lastEventID)
+		if err != nil || signatureCounter < 0 {
+			WriteErrorResponse(response, 400, []string{"Last-Event-ID must be a signature counter"})
+			return
+		}
+		after, err = s.eventStream.SequenceOfSignature(organizationID(request), id, signatureCounter)
+		if errors.Is(err, domain.ErrEventsExpired) {
+			WriteError(response, request, err)
+			return
+		}
+		if err != nil {
+			WriteErrorResponse(response, 400, []string{err.Error()})
+			return
+		}
+	}
+
+	s.streamEvents(response, request, id, after, func(event domain.OutboxEvent) string {
+		if data, ok := event.Event.Data.(domain.SignatureCreatedData); ok {
+			return strconv.Itoa(data.SignatureCounter + 1)
+		}
+		return ""
+	})
+}
+
+// Events handles api/v0/events route, which streams the events of all devices.
+// Events are identified by their position in the event log of the service.
+func (s *Server) Events(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writeMethodNotAllowed(response, "GET")
+		return
+	}
+
+	after := s.eventStream.LastSequence()
+	if lastEventID := request.Header.Get("Last-Event-ID"); lastEventID != "" {
+		var err error
+		after, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || after < 0 {
+			WriteErrorResponse(response, 400, []string{"Last-Event-ID must be an event sequence"})
+			return
+		}
+		if err = s.eventStream.CheckRetained(after); err != nil {
+			WriteError(response, request, err)
+			return
+		}
+	}
+
+	s.streamEvents(response, request, "", after, func(event domain.OutboxEvent) string {
+		return strconv.FormatInt(event.Sequence, 10)
+	})
+}
+
+// streamEvents writes the events following after as server-sent events until the client disconnects
+func (s *Server) streamEvents(
+	response http.ResponseWriter,
+	request *http.Request,
+	deviceID string,
+	after int64,
+	eventID func(event domain.OutboxEvent) string,
+) {
+	flusher, ok := response.(http.Flusher)
+	if !ok {
+		WriteInternalError(response)
+		return
+	}
+
+	// streams outlive the write timeout of the server, they end with the client or the shutdown instead.
+	// Writers without deadlines have none to clear.
+	_ = http.NewResponseController(response).SetWriteDeadline(time.Time{})
+
+	// subscribe before reading the history, so no event falls between both
+	wake, cancel := s.eventStream.Subscribe(organizationID(request))
+	defer cancel()
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.WriteHeader(200)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		for {
+			events := s.eventStream.Events(organizationID(request), deviceID, after, streamBatchSize)
+			if len(events) == 0 {
+				break
+			}
+			for _, event := range events {
+				if err := writeServerSentEvent(response, eventID(event), event.Event); err != nil {
+					return
+				}
+				after = event.Sequence
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-request.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(response, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeServerSentEvent(response http.ResponseWriter, id string, event domain.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err = fmt.Fprintf(response, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(response, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+type streamTestServer struct {
+	url        string
+	token      string
+	device     string
+	devices    *domain.DeviceService
+	apiKeys    *domain.APIKeyService
+	dispatcher *domain.EventDispatcher
+	repo       *persistence.InMemoryDevicesRepository
+}
+
+func newStreamTestServer(t *testing.T, signatures int) *streamTestServer {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	devicesRepo := persistence.NewInMemoryDevicesRepository()
+	eventStream := domain.NewEventStream(devicesRepo)
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	deviceService := domain.NewDeviceService(
+		devicesRepo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "dashboard", []string{"viewer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	device, err := deviceService.CreateSignatureDevice(context.Background(), "organization", "admin", domain.Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < signatures; i++ {
+		if _, err = deviceService.SignTransaction(context.Background(), "organization", device.UUID, "message"); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	server := NewServer("", deviceService, apiKeyService, nil, auditLog, nil, eventStream)
+	listener := httptest.NewServer(server.Handler())
+	t.Cleanup(listener.Close)
+	return &streamTestServer{
+		url:        listener.URL,
+		token:      apiKey.Token,
+		device:     device.UUID,
+		devices:    deviceService,
+		apiKeys:    apiKeyService,
+		dispatcher: domain.NewEventDispatcher(devicesRepo, 10, eventStream),
+		repo:       devicesRepo,
+	}
+}
+
+type testServerSentEvent struct {
+	id        string
+	eventType string
+}
+
+// open starts streaming path and returns a channel of the received events
+func (server *streamTestServer) open(t *testing.T, path string, lastEventID string) <-chan testServerSentEvent {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	request, err := http.NewRequestWithContext(ctx, "GET", server.url+path, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	request.Header.Set("Authorization", "Bearer "+server.token)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if response.StatusCode != 200 || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET %s answered %d %q", path, response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	events := make(chan testServerSentEvent, 100)
+	go func() {
+		defer response.Body.Close()
+		scanner := bufio.NewScanner(response.Body)
+		var event testServerSentEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.eventType = strings.TrimPrefix(line, "event: ")
+			case line == "" && event.eventType != "":
+				events <- event
+				event = testServerSentEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func receive(t *testing.T, events <-chan testServerSentEvent) testServerSentEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no event received")
+		return testServerSentEvent{}
+	}
+}
+
+func TestDeviceEventsResumesAfterSignatureCounter(t *testing.T) {
+	server := newStreamTestServer(t, 3)
+	events := server.open(t, "/api/v0/devices/"+server.device+"/events", "1")
+
+	for _, want := range []string{"2", "3"} {
+		if event := receive(t, events); event.id != want || event.eventType != "signature.created" {
+			t.Errorf("received %+v, want signature %s", event, want)
+		}
+	}
+
+	if _, err := server.devices.SignTransaction(context.Background(), "organization", server.device, "message"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := server.dispatcher.Dispatch(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if event := receive(t, events); event.id != "4" {
+		t.Errorf("received %+v, want live signature 4", event)
+	}
+}
+
+func TestEventsStreamsAllDevicesBySequence(t *testing.T) {
+	server := newStreamTestServer(t, 1)
+	events := server.open(t, "/api/v0/events", "0")
+
+	if event := receive(t, events); event.id != "1" || event.eventType != "device.created" {
+		t.Errorf("received %+v, want device.created with sequence 1", event)
+	}
+	if event := receive(t, events); event.id != "2" || event.eventType != "signature.created" {
+		t.Errorf("received %+v, want signature.created with sequence 2", event)
+	}
+}
+
+func TestDeviceEventsRejectsUnknownLastEventID(t *testing.T) {
+	server := newStreamTestServer(t, 1)
+	request, _ := http.NewRequest("GET", server.url+"/api/v0/devices/"+server.device+"/events", nil)
+	request.Header.Set("Authorization", "Bearer "+server.token)
+	request.Header.Set("Last-Event-ID", "5")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	response.Body.Close()
+	if response.StatusCode != 400 {
+		t.Errorf("GET with unknown Last-Event-ID answered %d, want 400", response.StatusCode)
+	}
+}
+
+// expireHistory stores an event of another device an hour after the window of the current events closed
+func (server *streamTestServer) expireHistory(t *testing.T) {
+	server.repo.SetHistoryRetention(time.Hour)
+	device := domain.SignatureDevice{UUID: "other", OrganizationID: "organization"}
+	event := domain.Event{OrganizationID: "organization", DeviceID: "other", OccurredAt: time.Now().Add(2 * time.Hour)}
+	if err := server.repo.Create(context.Background(), device, event); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestStreamsRejectExpiredLastEventID(t *testing.T) {
+	server := newStreamTestServer(t, 2)
+	server.expireHistory(t)
+
+	tests := []struct {
+		path        string
+		lastEventID string
+		status      int
+	}{
+		{"/api/v0/devices/" + server.device + "/events", "1", http.StatusGone},
+		{"/api/v0/devices/" + server.device + "/events", "0", http.StatusGone},
+		{"/api/v0/events", "0", http.StatusGone},
+		{"/api/v0/events", "2", http.StatusGone},
+		{"/api/v0/events", "3", http.StatusOK},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest("GET", server.url+test.path, nil)
+		request.Header.Set("Authorization", "Bearer "+server.token)
+		request.Header.Set("Last-Event-ID", test.lastEventID)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if response.StatusCode != test.status {
+			t.Errorf("GET %s after %s answered %d, want %d", test.path, test.lastEventID, response.StatusCode, test.status)
+		}
+		if test.status == http.StatusGone {
+			var problem Problem
+			if err = json.NewDecoder(response.Body).Decode(&problem); err != nil || problem.Code != CodeEventsExpired {
+				t.Errorf("GET %s after %s answered problem %+v, %v, want %s", test.path, test.lastEventID, problem, err, CodeEventsExpired)
+			}
+		}
+		response.Body.Close()
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TLSFiles locates the PEM files of the TLS listener.
+// ClientCAFile is optional, when set clients may authenticate with certificates issued by it.
+type TLSFiles struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// CertificateReloader serves the server certificate and client CAs from TLSFiles
+// and swaps them on Reload. Established connections keep their negotiated certificates,
+// only new handshakes observe the reloaded files.
+type CertificateReloader struct {
+	files       TLSFiles
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+// NewCertificateReloader is a factory to instantiate a CertificateReloader with the files loaded.
+func NewCertificateReloader(files TLSFiles) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{files: files}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the files again. On error the previously loaded certificates stay active.
+func (r *CertificateReloader) Reload() error {
+	certificate, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading server certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.files.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("loading client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("loading client CA: no certificates found")
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.certificate = &certificate
+	r.clientCAs = clientCAs
+	return nil
+}
+
+// TLSConfig returns the listener configuration resolving the current certificates per handshake.
+func (r *CertificateReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.configForClient,
+	}
+}
+
+func (r *CertificateReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.certificate},
+	}
+	if r.clientCAs != nil {
+		// client certificates are optional, clients without one fall back to bearer tokens
+		config.ClientCAs = r.clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
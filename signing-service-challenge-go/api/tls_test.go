@@ -0,0 +1,184 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func issueTestCertificate(t *testing.T, subject pkix.Name, parent *testCertificate, serial int64) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile string, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if keyFile != "" {
+		if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.certificate.Raw}, PrivateKey: c.key}
+}
+
+func TestCertificateReloader_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	files := TLSFiles{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	ca := issueTestCertificate(t, pkix.Name{CommonName: "test CA"}, nil, 1)
+	ca.write(t, files.ClientCAFile, "")
+	issueTestCertificate(t, pkix.Name{CommonName: "server"}, ca, 2).write(t, files.CertFile, files.KeyFile)
+	client := issueTestCertificate(t, pkix.Name{CommonName: "till-1", Organization: []string{"organization"}}, ca, 3)
+
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "till", []string{"viewer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = apiKeyService.BindCertificateSubject("organization", "admin", apiKey.ID, "CN=till-1,O=organization"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	webhookService := domain.NewWebhookService(
+		persistence.NewInMemoryWebhooksRepository(),
+		auditLog,
+		http.DefaultClient,
+		domain.DefaultWebhookRetryPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	deviceService := domain.NewDeviceService(
+		persistence.NewInMemoryDevicesRepository(),
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	server := NewServer("", deviceService, apiKeyService, nil, auditLog, webhookService, nil)
+
+	reloader, err := NewCertificateReloader(files)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	listener := httptest.NewUnstartedServer(server.Handler())
+	listener.TLS = reloader.TLSConfig()
+	listener.StartTLS()
+	defer listener.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	get := func(certificates []tls.Certificate) *http.Response {
+		httpClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certificates},
+			DisableKeepAlives: true,
+		}}
+		response, err := httpClient.Get(listener.URL + "/api/v0/devices")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		response.Body.Close()
+		return response
+	}
+
+	if response := get([]tls.Certificate{client.tlsCertificate()}); response.StatusCode != http.StatusOK {
+		t.Errorf("client certificate should authenticate, got status %v", response.StatusCode)
+	}
+	if response := get(nil); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("request without credentials should be rejected, got status %v", response.StatusCode)
+	}
+
+	renewed := issueTestCertificate(t, pkix.Name{CommonName: "renewed server"}, ca, 4)
+	renewed.write(t, files.CertFile, files.KeyFile)
+	if err = reloader.Reload(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	response := get([]tls.Certificate{client.tlsCertificate()})
+	if served := response.TLS.PeerCertificates[0].Subject.CommonName; served != "renewed server" {
+		t.Errorf("served certificate = %q, want the reloaded one", served)
+	}
+}
+
+func TestCertificateReloader_KeepsCertificatesOnFailedReload(t *testing.T) {
+	dir := t.TempDir()
+	files := TLSFiles{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server-key.pem")}
+	issueTestCertificate(t, pkix.Name{CommonName: "server"}, nil, 1).write(t, files.CertFile, files.KeyFile)
+
+	reloader, err := NewCertificateReloader(files)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = os.WriteFile(files.CertFile, []byte("broken"), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = reloader.Reload(); err == nil {
+		t.Errorf("broken certificate should fail to reload")
+	}
+
+	config, err := reloader.configForClient(nil)
+	if err != nil || len(config.Certificates) != 1 {
+		t.Errorf("previous certificate should stay active")
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+)
+
+// TracerName is the instrumentation scope of the spans of the REST API.
+const TracerName = "github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+
+// EnableTracing wraps every routed request in a span of provider, it must be called before Handler.
+// A trace context sent by the client in the traceparent header is continued.
+func (s *Server) EnableTracing(provider trace.TracerProvider) {
+	s.tracer = provider.Tracer(TracerName)
+}
+
+// tracing is a mux middleware, so spans are named after the template of the matched route
+func (s *Server) tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		route := request.URL.Path
+		if template, err := mux.CurrentRoute(request).GetPathTemplate(); err == nil {
+			route = template
+		}
+		ctx := propagation.TraceContext{}.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := s.tracer.Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", request.Method),
+				attribute.String("http.route", route),
+				attribute.String(logging.RequestIDKey, logging.RequestID(ctx)),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strconv.Itoa(recorder.status))
+		}
+	})
+}
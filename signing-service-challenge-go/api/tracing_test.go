@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingSpansRequests(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	server, _ := newContractTestServer(t)
+	server.deviceService.SetTracerProvider(provider)
+	server.EnableTracing(provider)
+	handler := server.Handler()
+
+	response := serve(handler, "PUT", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1", `{"algorithm": "ECC"}`, "")
+	if response.Code != 201 {
+		t.Fatalf("PUT answered %d %s", response.Code, response.Body)
+	}
+	exporter.Reset()
+	request := newRequest("POST", "/api/v0/devices/8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1/sign", `{"data": "receipt"}`)
+	// the client's trace is continued
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	request.Header.Set(RequestIDHeader, "till-7")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 200 {
+		t.Fatalf("POST answered %d %s", recorder.Code, recorder.Body)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	root, found := spans["POST /api/v0/devices/{uuid}/sign"]
+	if !found {
+		t.Fatalf("request isn't traced, spans %v", exporter.GetSpans().Snapshots())
+	}
+	if root.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || root.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("request span doesn't continue the trace of the client")
+	}
+	attributes := make(map[string]string)
+	for _, attribute := range root.Attributes {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	for key, want := range map[string]string{"http.route": "/api/v0/devices/{uuid}/sign", "http.response.status_code": "200", "request_id": "till-7"} {
+		if attributes[key] != want {
+			t.Errorf("request span has %s %q, want %q", key, attributes[key], want)
+		}
+	}
+	if span := spans["DeviceService.SignTransaction"]; span.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Errorf("SignTransaction isn't a child of the request span")
+	}
+}
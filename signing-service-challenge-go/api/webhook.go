@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+// Webhooks handles api/v0/webhooks route
+func (s *Server) Webhooks(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+		WriteAPIResponse(response, 200, s.webhookService.ListSubscriptions(organizationID(request)))
+	case "POST":
+		s.createWebhook(response, request)
+	default:
+		writeMethodNotAllowed(response, "GET", "POST")
+	}
+}
+
+// Webhook handles api/v0/webhooks/{id} route
+func (s *Server) Webhook(response http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["id"]
+	switch request.Method {
+	case "GET":
+		subscription, found := s.webhookService.GetSubscription(organizationID(request), id)
+		if !found {
+			WriteErrorResponse(response, 404, []string{"not found"})
+			return
+		}
+		WriteAPIResponse(response, 200, subscription)
+	case "DELETE":
+		if err := s.webhookService.DeleteSubscription(organizationID(request), actor(request), id); err != nil {
+			WriteError(response, request, err)
+			return
+		}
+		response.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(response, "GET", "DELETE")
+	}
+}
+
+// WebhookDeliveries handles api/v0/webhooks/{id}/deliveries route.
+// The status query parameter filters the log, status=dead lists the dead letters.
+func (s *Server) WebhookDeliveries(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writeMethodNotAllowed(response, "GET")
+		return
+	}
+
+	id := mux.Vars(request)["id"]
+	if _, found := s.webhookService.GetSubscription(organizationID(request), id); !found {
+		WriteErrorResponse(response, 404, []string{"not found"})
+		return
+	}
+
+	status := domain.DeliveryStatus(request.URL.Query().Get("status"))
+	WriteAPIResponse(response, 200, s.webhookService.ListDeliveries(organizationID(request), id, status))
+}
+
+// WebhookRedeliver handles api/v0/webhooks/{id}/deliveries/{delivery_id}/redeliver route
+func (s *Server) WebhookRedeliver(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writeMethodNotAllowed(response, "POST")
+		return
+	}
+
+	vars := mux.Vars(request)
+	delivery, err := s.webhookService.RedeliverDeadLetter(organizationID(request), vars["id"], vars["delivery_id"])
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 202, delivery)
+}
+
+type createWebhookParams struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+func (s *Server) createWebhook(response http.ResponseWriter, request *http.Request) {
+	var params createWebhookParams
+	read, _ := io.ReadAll(request.Body)
+	err := json.Unmarshal(read, &params)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	subscription, err := s.webhookService.CreateSubscription(
+		request.Context(),
+		organizationID(request),
+		actor(request),
+		params.URL,
+		params.EventTypes,
+		params.Secret,
+	)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, 201, subscription)
+}
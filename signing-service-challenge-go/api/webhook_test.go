@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCreateWebhookRejectsInternalAddresses(t *testing.T) {
+	server, _ := newContractTestServer(t)
+	handler := server.Handler()
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+	} {
+		body := `{"url": "` + url + `", "event_types": ["signature.created"], "secret": "0123456789abcdef"}`
+		recorder := serveAs(handler, contractTestToken, "POST", "/api/v0/webhooks", body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %v, want %v: %s", url, recorder.Code, http.StatusBadRequest, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Package client is the Go SDK of the signing service REST API.
+//
+// Every request the Client sends is safe to repeat: devices are created with an ID chosen by the
+// client and signing requests carry an idempotency key, so failed requests are retried transparently.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls the exponential backoff between attempts of a request.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy gives up after a few seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// Backoff returns the delay before the attempt following the given failed attempt
+func (policy RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := policy.InitialBackoff
+	for i := 1; i < attempt && backoff < policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	return backoff
+}
+
+// Error is a problem details response of the service, switch on Code to handle specific problems.
+type Error struct {
+	api.Problem
+}
+
+func (err *Error) Error() string {
+	detail := err.Detail
+	if detail == "" {
+		detail = strings.Join(err.Errors, "; ")
+	}
+	if detail == "" {
+		detail = err.Title
+	}
+	return fmt.Sprintf("signing service: %s (%d): %s", err.Code, err.Status, detail)
+}
+
+// Client calls the REST API of a signing service with an API key.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	policy     RetryPolicy
+	// verificationKeys caches the public keys of devices for Verify, they never change
+	verificationKeys     map[string]verificationKey
+	verificationKeysLock sync.RWMutex
+}
+
+// NewClient is a factory to instantiate a new Client.
+// baseURL is the address of the service without the API path, e.g. https://signing.example.com
+func NewClient(baseURL string, token string, httpClient *http.Client, policy RetryPolicy) *Client {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &Client{
+		baseURL:          strings.TrimSuffix(baseURL, "/"),
+		token:            token,
+		httpClient:       httpClient,
+		policy:           policy,
+		verificationKeys: make(map[string]verificationKey),
+	}
+}
+
+// response is the envelope of successful responses, like api.Response
+type response struct {
+	Data       json.RawMessage `json:"data"`
+	Pagination *api.Pagination `json:"pagination"`
+}
+
+// do sends a request to path below /api/v0 and decodes the data of the response into result.
+// Transport errors and responses that indicate a transient failure are retried with the same body and headers.
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	header http.Header,
+	body interface{},
+	result interface{},
+) (*api.Pagination, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/v0"+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			request.Header[name] = values
+		}
+		request.Header.Set("Authorization", "Bearer "+c.token)
+		request.Header.Set("Accept", "application/json")
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+
+		pagination, retry, err := c.send(request, result)
+		if err == nil || !retry || attempt >= c.policy.MaxAttempts || ctx.Err() != nil {
+			return pagination, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.policy.Backoff(attempt)):
+		}
+	}
+}
+
+// send sends request once and reports whether a failure is worth another attempt
+func (c *Client) send(request *http.Request, result interface{}) (*api.Pagination, bool, error) {
+	httpResponse, err := c.httpClient.Do(request)
+	if err != nil {
+		// the request may not have reached the service or its response got lost
+		return nil, true, err
+	}
+	defer httpResponse.Body.Close()
+	read, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if httpResponse.StatusCode >= 300 {
+		return nil, transientStatus(httpResponse.StatusCode), problemFrom(httpResponse.StatusCode, read)
+	}
+
+	var envelope response
+	if err = json.Unmarshal(read, &envelope); err != nil {
+		return nil, false, err
+	}
+	if result != nil {
+		if err = json.Unmarshal(envelope.Data, result); err != nil {
+			return nil, false, err
+		}
+	}
+	return envelope.Pagination, false, nil
+}
+
+// problemFrom decodes the problem details of an error response
+func problemFrom(status int, body []byte) *Error {
+	problem := &Error{}
+	if err := json.Unmarshal(body, &problem.Problem); err != nil || problem.Code == "" {
+		// not a problem details response, e.g. from a proxy in front of the service
+		problem.Problem = api.NewProblem(status, "")
+	}
+	problem.Status = status
+	return problem
+}
+
+// transientStatus reports whether a response with status may succeed when the request is repeated
+func transientStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
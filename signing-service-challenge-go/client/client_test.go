@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+type testServer struct {
+	url        string
+	token      string
+	dispatcher *domain.EventDispatcher
+}
+
+// newTestServer serves the REST API in-process with an admin API key
+func newTestServer(t *testing.T) *testServer {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	devicesRepo := persistence.NewInMemoryDevicesRepository()
+	eventStream := domain.NewEventStream(devicesRepo)
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	server := api.NewServer(
+		"",
+		domain.NewDeviceService(
+			devicesRepo,
+			persistence.NewInMemoryIdempotencyRepository(),
+			auditLog,
+			domain.DefaultKeyPolicy,
+			rand.Reader,
+			domain.SystemClock{},
+		),
+		apiKeyService,
+		domain.NewOrganizationService(persistence.NewInMemoryOrganizationsRepository(), auditLog, rand.Reader, domain.SystemClock{}),
+		auditLog,
+		domain.NewWebhookService(
+			persistence.NewInMemoryWebhooksRepository(),
+			auditLog,
+			http.DefaultClient,
+			domain.DefaultWebhookRetryPolicy,
+			rand.Reader,
+			domain.SystemClock{},
+		),
+		eventStream,
+	)
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "sdk", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	listener := httptest.NewServer(server.Handler())
+	t.Cleanup(listener.Close)
+	return &testServer{
+		url:        listener.URL,
+		token:      apiKey.Token,
+		dispatcher: domain.NewEventDispatcher(devicesRepo, 10, eventStream),
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// flakyTransport fails the first requests it sends, after the service handled them
+type flakyTransport struct {
+	failures int
+	status   int
+	mutex    sync.Mutex
+	requests int
+}
+
+func (transport *flakyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := http.DefaultTransport.RoundTrip(request)
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	transport.requests++
+	if err != nil || transport.requests > transport.failures {
+		return response, err
+	}
+
+	response.Body.Close()
+	if transport.status == 0 {
+		return nil, errors.New("connection reset by peer")
+	}
+	return &http.Response{
+		StatusCode: transport.status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    request,
+	}, nil
+}
+
+func TestCreateSignAndVerify(t *testing.T) {
+	server := newTestServer(t)
+	ctx := testContext(t)
+	client := NewClient(server.url, server.token, http.DefaultClient, testRetryPolicy)
+
+	for _, algorithm := range []domain.Algorithm{domain.ECC, domain.RSA} {
+		device, err := client.CreateDevice(ctx, algorithm, "till")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		first, err := client.Sign(ctx, device.UUID, "first")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		second, err := client.Sign(ctx, device.UUID, "second")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		// a fresh client has to fetch the public key first
+		verifier := NewClient(server.url, server.token, http.DefaultClient, testRetryPolicy)
+		tests := []struct {
+			name         string
+			verification domain.SignatureVerification
+			want         bool
+		}{
+			{"first", domain.SignatureVerification{Data: "first", Signature: first.Signature}, true},
+			{"chained", domain.SignatureVerification{
+				Data:              "second",
+				SignatureCounter:  1,
+				Signature:         second.Signature,
+				PreviousSignature: first.Signature,
+			}, true},
+			{"tampered", domain.SignatureVerification{
+				Data:              "tampered",
+				SignatureCounter:  1,
+				Signature:         second.Signature,
+				PreviousSignature: first.Signature,
+			}, false},
+		}
+		for _, test := range tests {
+			valid, err := verifier.Verify(ctx, device.UUID, test.verification)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if valid != test.want {
+				t.Errorf("%s %s: Verify() = %t, want %t", algorithm, test.name, valid, test.want)
+			}
+		}
+	}
+}
+
+func TestRetriesSignOnce(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{"lost response", 0},
+		{"unavailable", http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		server := newTestServer(t)
+		ctx := testContext(t)
+		device, err := NewClient(server.url, server.token, http.DefaultClient, testRetryPolicy).CreateDevice(ctx, domain.ECC, "till")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		transport := &flakyTransport{failures: 2, status: test.status}
+		client := NewClient(server.url, server.token, &http.Client{Transport: transport}, testRetryPolicy)
+		if _, err = client.Sign(ctx, device.UUID, "data"); err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+		if transport.requests != 3 {
+			t.Errorf("%s: sent %d requests, want 3", test.name, transport.requests)
+		}
+		fetched, err := client.GetDevice(ctx, device.UUID)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if fetched.SignatureCounter != 1 {
+			t.Errorf("%s: signature counter = %d, want 1", test.name, fetched.SignatureCounter)
+		}
+	}
+}
+
+func TestListDevicesPages(t *testing.T) {
+	server := newTestServer(t)
+	ctx := testContext(t)
+	client := NewClient(server.url, server.token, http.DefaultClient, testRetryPolicy)
+	for _, label := range []string{"a", "b", "c"} {
+		if _, err := client.CreateDevice(ctx, domain.ECC, label); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	var labels []string
+	options := ListDevicesOptions{SortBy: domain.SortByLabel, Limit: 2}
+	for {
+		page, err := client.ListDevices(ctx, options)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, device := range page.Devices {
+			labels = append(labels, device.Label)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+	if strings.Join(labels, ",") != "a,b,c" {
+		t.Errorf("listed %v, want a, b and c", labels)
+	}
+}
+
+func TestErrorsAreProblems(t *testing.T) {
+	server := newTestServer(t)
+	transport := &flakyTransport{}
+	client := NewClient(server.url, server.token, &http.Client{Transport: transport}, testRetryPolicy)
+
+	_, err := client.Sign(testContext(t), "unknown", "data")
+	var problem *Error
+	if !errors.As(err, &problem) || problem.Code != api.CodeNotFound || problem.Status != 404 {
+		t.Fatalf("Sign() error = %v, want a not found problem", err)
+	}
+	if transport.requests != 1 {
+		t.Errorf("sent %d requests, want no retries", transport.requests)
+	}
+}
+
+func TestStreamSignaturesReplaysChain(t *testing.T) {
+	server := newTestServer(t)
+	ctx := testContext(t)
+	client := NewClient(server.url, server.token, http.DefaultClient, testRetryPolicy)
+	device, err := client.CreateDevice(ctx, domain.ECC, "till")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var signatures []string
+	for _, data := range []string{"first", "second", "third"} {
+		signature, err := client.Sign(ctx, device.UUID, data)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		signatures = append(signatures, signature.Signature)
+	}
+	if err = server.dispatcher.Dispatch(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	var received []domain.SignatureCreatedData
+	err = client.StreamSignatures(ctx, device.UUID, 1, func(signature domain.SignatureCreatedData) bool {
+		received = append(received, signature)
+		return len(received) < 2
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(received) != 2 || received[0].SignatureCounter != 1 || received[1].Signature != signatures[2] {
+		t.Errorf("StreamSignatures() after 1 = %v, want the second and third signature", received)
+	}
+}
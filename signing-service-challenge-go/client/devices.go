@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/google/uuid"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListDevicesOptions selects a page of devices, zero values use the defaults of the service.
+type ListDevicesOptions struct {
+	domain.DeviceFilter
+	SortBy     domain.DeviceSortField
+	Descending bool
+	Limit      int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+func (options ListDevicesOptions) values() url.Values {
+	values := url.Values{}
+	if options.Algorithm != 0 {
+		values.Set("algorithm", options.Algorithm.String())
+	}
+	if options.LabelPrefix != "" {
+		values.Set("label_prefix", options.LabelPrefix)
+	}
+	if options.Status != nil {
+		values.Set("status", options.Status.String())
+	}
+	if options.Tag != "" {
+		values.Set("tag", options.Tag)
+	}
+	if options.SortBy != "" {
+		values.Set("sort", string(options.SortBy))
+	}
+	if options.Descending {
+		values.Set("order", "desc")
+	}
+	if options.Limit > 0 {
+		values.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Cursor != "" {
+		values.Set("cursor", options.Cursor)
+	}
+	return values
+}
+
+// verificationKey is what Verify needs to know about a device
+type verificationKey struct {
+	algorithm domain.Algorithm
+	publicKey []byte
+}
+
+type createDeviceParams struct {
+	Algorithm domain.Algorithm `json:"algorithm"`
+	Label     string           `json:"label"`
+}
+
+type signParams struct {
+	Data string `json:"data"`
+}
+
+// CreateDevice creates a signature device.
+// The client chooses the ID of the device, so retries can't create it twice.
+func (c *Client) CreateDevice(
+	ctx context.Context,
+	algorithm domain.Algorithm,
+	label string,
+) (domain.CreateSignatureDeviceResponse, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return domain.CreateSignatureDeviceResponse{}, err
+	}
+	return c.CreateDeviceWithID(ctx, id.String(), algorithm, label)
+}
+
+// CreateDeviceWithID creates the signature device with the given ID, or returns it if it already exists
+// with the same algorithm and label.
+func (c *Client) CreateDeviceWithID(
+	ctx context.Context,
+	id string,
+	algorithm domain.Algorithm,
+	label string,
+) (domain.CreateSignatureDeviceResponse, error) {
+	var device domain.CreateSignatureDeviceResponse
+	params := createDeviceParams{Algorithm: algorithm, Label: label}
+	if _, err := c.do(ctx, "PUT", "/devices/"+url.PathEscape(id), nil, params, &device); err != nil {
+		return domain.CreateSignatureDeviceResponse{}, err
+	}
+	c.cacheVerificationKey(device.UUID, verificationKey{device.Algorithm, device.PublicKey})
+	return device, nil
+}
+
+// GetDevice returns the signature device with the given ID.
+func (c *Client) GetDevice(ctx context.Context, id string) (domain.SignatureDevice, error) {
+	var device domain.SignatureDevice
+	if _, err := c.do(ctx, "GET", "/devices/"+url.PathEscape(id), nil, nil, &device); err != nil {
+		return domain.SignatureDevice{}, err
+	}
+	c.cacheVerificationKey(device.UUID, verificationKey{device.Algorithm, device.PublicKey})
+	return device, nil
+}
+
+// ListDevices returns a page of signature devices.
+func (c *Client) ListDevices(ctx context.Context, options ListDevicesOptions) (domain.DevicePage, error) {
+	path := "/devices"
+	if query := options.values().Encode(); query != "" {
+		path += "?" + query
+	}
+
+	var page domain.DevicePage
+	pagination, err := c.do(ctx, "GET", path, nil, nil, &page.Devices)
+	if err != nil {
+		return domain.DevicePage{}, err
+	}
+	if pagination != nil {
+		page.NextCursor = pagination.NextCursor
+	}
+	return page, nil
+}
+
+// Sign signs data with the device.
+// The request carries a fresh idempotency key, so the data is signed once even if the request is retried.
+func (c *Client) Sign(ctx context.Context, deviceID string, data string) (domain.SignatureResponse, error) {
+	idempotencyKey, err := uuid.NewRandom()
+	if err != nil {
+		return domain.SignatureResponse{}, err
+	}
+	return c.SignIdempotently(ctx, deviceID, data, idempotencyKey.String())
+}
+
+// SignIdempotently signs data with the device once per idempotency key.
+// Repeating a call with the same key returns the original signature, e.g. after the process restarted.
+func (c *Client) SignIdempotently(
+	ctx context.Context,
+	deviceID string,
+	data string,
+	idempotencyKey string,
+) (domain.SignatureResponse, error) {
+	var signature domain.SignatureResponse
+	header := http.Header{"Idempotency-Key": []string{idempotencyKey}}
+	path := "/devices/" + url.PathEscape(deviceID) + "/sign"
+	if _, err := c.do(ctx, "POST", path, header, signParams{Data: data}, &signature); err != nil {
+		return domain.SignatureResponse{}, err
+	}
+	return signature, nil
+}
+
+// Verify checks locally that the device created the signature, without sending it to the service.
+// Only the public key of the device is fetched once.
+func (c *Client) Verify(ctx context.Context, deviceID string, verification domain.SignatureVerification) (bool, error) {
+	c.verificationKeysLock.RLock()
+	key, found := c.verificationKeys[deviceID]
+	c.verificationKeysLock.RUnlock()
+	if !found {
+		device, err := c.GetDevice(ctx, deviceID)
+		if err != nil {
+			return false, err
+		}
+		key = verificationKey{device.Algorithm, device.PublicKey}
+	}
+	return domain.VerifySignature(deviceID, key.algorithm, key.publicKey, verification)
+}
+
+func (c *Client) cacheVerificationKey(deviceID string, key verificationKey) {
+	c.verificationKeysLock.Lock()
+	defer c.verificationKeysLock.Unlock()
+	c.verificationKeys[deviceID] = key
+}
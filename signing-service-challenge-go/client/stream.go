@@ -0,0 +1,97 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxEventSize bounds a single server-sent event, RSA signatures make them a few kilobytes
+const maxEventSize = 1024 * 1024
+
+// event is a domain.Event with its data left encoded until the type is known
+type event struct {
+	Type domain.EventType `json:"type"`
+	Data json.RawMessage  `json:"data"`
+}
+
+// StreamSignatures follows the signatures of the device in the order of their counter and calls handle for each,
+// until handle returns false or ctx is done. Other events of the device are skipped.
+// after is the number of signatures to skip, 0 replays the whole chain.
+// The stream isn't retried, resume it with the number of signatures received so far.
+func (c *Client) StreamSignatures(
+	ctx context.Context,
+	deviceID string,
+	after int,
+	handle func(signature domain.SignatureCreatedData) bool,
+) error {
+	path := c.baseURL + "/api/v0/devices/" + url.PathEscape(deviceID) + "/events"
+	request, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	request.Header.Set("Accept", "text/event-stream")
+	// signatures are identified by the counter they raised the device to
+	request.Header.Set("Last-Event-ID", strconv.Itoa(after))
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		read, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		return problemFrom(response.StatusCode, read)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(nil, maxEventSize)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			// only the data matters, the event type is repeated in it and ids are derived from the counter
+			if value, found := strings.CutPrefix(line, "data:"); found {
+				data.WriteString(strings.TrimPrefix(value, " "))
+			}
+			continue
+		}
+		if data.Len() == 0 {
+			continue
+		}
+
+		var received event
+		err := json.Unmarshal([]byte(data.String()), &received)
+		data.Reset()
+		if err != nil {
+			return err
+		}
+		if received.Type != domain.EventSignatureCreated {
+			continue
+		}
+		var signature domain.SignatureCreatedData
+		if err = json.Unmarshal(received.Data, &signature); err != nil {
+			return err
+		}
+		if !handle(signature) {
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
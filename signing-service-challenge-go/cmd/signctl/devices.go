@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/client"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"io"
+	"sort"
+	"time"
+)
+
+// deviceList is the JSON output of devices list
+type deviceList struct {
+	Devices    []domain.SignatureDevice `json:"devices"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+func (c *cli) devices(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError{"missing devices command"}
+	}
+	switch args[0] {
+	case "create":
+		return c.createDevice(ctx, args[1:])
+	case "list":
+		return c.listDevices(ctx, args[1:])
+	case "show":
+		return c.showDevice(ctx, args[1:])
+	default:
+		return usageError{fmt.Sprintf("unknown devices command %q", args[0])}
+	}
+}
+
+func (c *cli) createDevice(ctx context.Context, args []string) error {
+	flags := newFlagSet("devices create")
+	algorithmName := flags.String("algorithm", "", "signature algorithm, ECC or RSA")
+	label := flags.String("label", "", "label of the device")
+	id := flags.String("id", "", "UUID of the device, generated if empty")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	algorithm, err := domain.ParseAlgorithm(*algorithmName)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+
+	var device domain.CreateSignatureDeviceResponse
+	if *id == "" {
+		device, err = c.client.CreateDevice(ctx, algorithm, *label)
+	} else {
+		device, err = c.client.CreateDeviceWithID(ctx, *id, algorithm, *label)
+	}
+	if err != nil {
+		return err
+	}
+	return c.print(device, func(w io.Writer) {
+		fmt.Fprintln(w, "UUID\tALGORITHM\tLABEL\tSTATUS")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", device.UUID, device.Algorithm, device.Label, device.Status)
+	})
+}
+
+func (c *cli) listDevices(ctx context.Context, args []string) error {
+	flags := newFlagSet("devices list")
+	algorithmName := flags.String("algorithm", "", "only devices with this algorithm")
+	statusName := flags.String("status", "", "only devices with this status")
+	labelPrefix := flags.String("label-prefix", "", "only devices with a label starting with this prefix")
+	tag := flags.String("tag", "", "only devices with this tag")
+	sortBy := flags.String("sort", "", "created_at, label or signature_counter")
+	descending := flags.Bool("desc", false, "sort in descending order")
+	limit := flags.Int("limit", 0, "page size")
+	cursor := flags.String("cursor", "", "next cursor of the previous page")
+	all := flags.Bool("all", false, "follow the cursors through all pages")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	options := client.ListDevicesOptions{
+		DeviceFilter: domain.DeviceFilter{LabelPrefix: *labelPrefix, Tag: *tag},
+		Descending:   *descending,
+		Limit:        *limit,
+		Cursor:       *cursor,
+	}
+	var err error
+	if *algorithmName != "" {
+		if options.Algorithm, err = domain.ParseAlgorithm(*algorithmName); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	if *statusName != "" {
+		status, err := domain.ParseStatus(*statusName)
+		if err != nil {
+			return usageError{err.Error()}
+		}
+		options.Status = &status
+	}
+	if *sortBy != "" {
+		if options.SortBy, err = domain.ParseDeviceSortField(*sortBy); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+
+	var list deviceList
+	for {
+		page, err := c.client.ListDevices(ctx, options)
+		if err != nil {
+			return err
+		}
+		list.Devices = append(list.Devices, page.Devices...)
+		list.NextCursor = page.NextCursor
+		if !*all || page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+
+	err = c.print(list, func(w io.Writer) {
+		fmt.Fprintln(w, "UUID\tALGORITHM\tLABEL\tSTATUS\tCOUNTER\tCREATED")
+		for _, device := range list.Devices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+				device.UUID,
+				device.Algorithm,
+				device.Label,
+				device.Status,
+				device.SignatureCounter,
+				device.CreatedAt.Format(time.RFC3339),
+			)
+		}
+	})
+	if err == nil && !c.json && list.NextCursor != "" {
+		// keep the table parseable, the cursor only matters to whoever pages by hand
+		fmt.Fprintf(c.stderr, "more devices, continue with -cursor %s\n", list.NextCursor)
+	}
+	return err
+}
+
+func (c *cli) showDevice(ctx context.Context, args []string) error {
+	flags := newFlagSet("devices show")
+	publicKey := flags.Bool("public-key", false, "only print the PEM encoded public key, e.g. for verify")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError{"devices show needs exactly one device UUID"}
+	}
+
+	device, err := c.client.GetDevice(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *publicKey {
+		_, err = c.stdout.Write(device.PublicKey)
+		return err
+	}
+	return c.print(device, func(w io.Writer) {
+		fmt.Fprintf(w, "UUID\t%s\n", device.UUID)
+		fmt.Fprintf(w, "Label\t%s\n", device.Label)
+		fmt.Fprintf(w, "Algorithm\t%s\n", device.Algorithm)
+		fmt.Fprintf(w, "Status\t%s\n", device.Status)
+		fmt.Fprintf(w, "Signature counter\t%d\n", device.SignatureCounter)
+		fmt.Fprintf(w, "Created\t%s\n", device.CreatedAt.Format(time.RFC3339))
+		for _, tag := range device.Tags {
+			fmt.Fprintf(w, "Tag\t%s\n", tag)
+		}
+		keys := make([]string, 0, len(device.Metadata))
+		for key := range device.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "Metadata\t%s=%s\n", key, device.Metadata[key])
+		}
+	})
+}
@@ -0,0 +1,156 @@
+// Command signctl operates a signing service from the command line.
+// It talks to the REST API with the client package and verifies signatures offline.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/client"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+)
+
+const (
+	// URLEnv and TokenEnv are the defaults of the -url and -token flags.
+	URLEnv     = "SIGNCTL_URL"
+	TokenEnv   = "SIGNCTL_TOKEN"
+	DefaultURL = "http://localhost:8080"
+)
+
+const usage = `Usage: signctl [-url URL] [-token TOKEN] [-o table|json] COMMAND [ARGS]
+
+Commands:
+  devices create -algorithm ECC|RSA [-label LABEL] [-id UUID]
+  devices list [-algorithm A] [-status S] [-label-prefix P] [-tag T] [-sort FIELD] [-desc] [-limit N] [-cursor C] [-all]
+  devices show [-public-key] UUID
+  sign -device UUID [-idempotency-key KEY] [-data DATA | FILE...]
+  export -device UUID
+  verify -counter N [-chain FILE] [-public-key FILE -algorithm A -device UUID] [-signature S] [-previous S] [-data DATA | FILE]
+
+Data to sign or verify is read from -data, the given files or stdin, byte for byte.
+export writes the signature chain of a device as JSON, verify checks signatures against it offline.
+`
+
+// errInvalidSignature makes verify exit with status 1 after reporting the result
+var errInvalidSignature = errors.New("signature is invalid")
+
+// usageError reports wrong arguments, signctl exits with status 2 on them like the flag package
+type usageError struct {
+	message string
+}
+
+func (err usageError) Error() string {
+	return err.message
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr, http.DefaultClient)
+	var usageErr usageError
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+		fmt.Print(usage)
+	case errors.Is(err, errInvalidSignature):
+		os.Exit(1)
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "signctl: %s\n\n%s", err, usage)
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "signctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// cli holds what every command needs
+type cli struct {
+	client *client.Client
+	// json selects JSON output instead of tables
+	json   bool
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// run parses the global flags and runs the command named by the first remaining argument
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer, httpClient *http.Client) error {
+	flags := newFlagSet("signctl")
+	baseURL := flags.String("url", envOr(URLEnv, DefaultURL), "address of the signing service, defaults to $"+URLEnv)
+	token := flags.String("token", os.Getenv(TokenEnv), "API key, defaults to $"+TokenEnv)
+	output := flags.String("o", "table", "output format, table or json")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return usageError{fmt.Sprintf("unknown output format %q", *output)}
+	}
+
+	c := &cli{
+		client: client.NewClient(*baseURL, *token, httpClient, client.DefaultRetryPolicy),
+		json:   *output == "json",
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return usageError{"missing command"}
+	}
+	switch args[0] {
+	case "devices":
+		return c.devices(ctx, args[1:])
+	case "sign":
+		return c.sign(ctx, args[1:])
+	case "export":
+		return c.export(ctx, args[1:])
+	case "verify":
+		return c.verify(args[1:])
+	case "help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		return usageError{fmt.Sprintf("unknown command %q", args[0])}
+	}
+}
+
+// newFlagSet returns a silent flag set, parseFlags reports its errors with the usage instead
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return usageError{err.Error()}
+	}
+	return err
+}
+
+func envOr(name string, fallback string) string {
+	if value, found := os.LookupEnv(name); found {
+		return value
+	}
+	return fallback
+}
+
+// print writes value as indented JSON or as the table written by table
+func (c *cli) print(value interface{}, table func(w io.Writer)) error {
+	if c.json {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+type testServer struct {
+	url        string
+	token      string
+	dispatcher *domain.EventDispatcher
+}
+
+func newTestServer(t *testing.T) *testServer {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	devicesRepo := persistence.NewInMemoryDevicesRepository()
+	eventStream := domain.NewEventStream(devicesRepo)
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	server := api.NewServer(
+		"",
+		domain.NewDeviceService(
+			devicesRepo,
+			persistence.NewInMemoryIdempotencyRepository(),
+			auditLog,
+			domain.DefaultKeyPolicy,
+			rand.Reader,
+			domain.SystemClock{},
+		),
+		apiKeyService,
+		domain.NewOrganizationService(persistence.NewInMemoryOrganizationsRepository(), auditLog, rand.Reader, domain.SystemClock{}),
+		auditLog,
+		domain.NewWebhookService(
+			persistence.NewInMemoryWebhooksRepository(),
+			auditLog,
+			http.DefaultClient,
+			domain.DefaultWebhookRetryPolicy,
+			rand.Reader,
+			domain.SystemClock{},
+		),
+		eventStream,
+	)
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "signctl", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	listener := httptest.NewServer(server.Handler())
+	t.Cleanup(listener.Close)
+	return &testServer{
+		url:        listener.URL,
+		token:      apiKey.Token,
+		dispatcher: domain.NewEventDispatcher(devicesRepo, 10, eventStream),
+	}
+}
+
+// run runs signctl against the server and returns its output
+func (server *testServer) run(t *testing.T, stdin string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var stdout bytes.Buffer
+	args = append([]string{"-url", server.url, "-token", server.token}, args...)
+	err := run(ctx, args, strings.NewReader(stdin), &stdout, &bytes.Buffer{}, http.DefaultClient)
+	return stdout.String(), err
+}
+
+func TestSignExportAndVerifyOffline(t *testing.T) {
+	server := newTestServer(t)
+	output, err := server.run(t, "", "-o", "json", "devices", "create", "-algorithm", "ECC", "-label", "till")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var device domain.CreateSignatureDeviceResponse
+	if err = json.Unmarshal([]byte(output), &device); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	dir := t.TempDir()
+	receipt := filepath.Join(dir, "receipt.txt")
+	if err = os.WriteFile(receipt, []byte("second"), 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = server.run(t, "first", "sign", "-device", device.UUID); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = server.run(t, "", "sign", "-device", device.UUID, receipt); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = server.dispatcher.Dispatch(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	exported, err := server.run(t, "", "export", "-device", device.UUID)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	chainFile := filepath.Join(dir, "chain.json")
+	if err = os.WriteFile(chainFile, []byte(exported), 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tests := []struct {
+		name    string
+		stdin   string
+		args    []string
+		wantErr error
+	}{
+		{"first from stdin", "first", []string{"-counter", "0"}, nil},
+		{"second from file", "", []string{"-counter", "1", receipt}, nil},
+		{"tampered", "tampered", []string{"-counter", "1"}, errInvalidSignature},
+		{"wrong counter", "first", []string{"-counter", "1"}, errInvalidSignature},
+	}
+	for _, test := range tests {
+		args := append([]string{"verify", "-chain", chainFile}, test.args...)
+		// verifying is offline, an unreachable service must not matter
+		var stdout bytes.Buffer
+		err := run(context.Background(), append([]string{"-url", "http://127.0.0.1:0"}, args...),
+			strings.NewReader(test.stdin), &stdout, &bytes.Buffer{}, http.DefaultClient)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: verify error = %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestListDevicesTable(t *testing.T) {
+	server := newTestServer(t)
+	for _, label := range []string{"a", "b", "c"} {
+		if _, err := server.run(t, "", "devices", "create", "-algorithm", "RSA", "-label", label); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	output, err := server.run(t, "", "devices", "list", "-sort", "label", "-limit", "2", "-all")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "UUID") || !strings.Contains(lines[3], " c ") {
+		t.Errorf("devices list printed\n%s\nwant a header and devices a, b and c", output)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	server := newTestServer(t)
+	tests := [][]string{
+		{},
+		{"unknown"},
+		{"devices", "create"},
+		{"-o", "yaml", "devices", "list"},
+		{"sign", "-unknown-flag"},
+		{"verify", "-counter", "0"},
+	}
+	for _, args := range tests {
+		var usageErr usageError
+		if _, err := server.run(t, "", args...); !errors.As(err, &usageErr) {
+			t.Errorf("signctl %v error = %v, want a usage error", args, err)
+		}
+	}
+}
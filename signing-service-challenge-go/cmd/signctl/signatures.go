@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"io"
+	"os"
+)
+
+// signed is the output of sign for one input, Source is the file name or "-" for stdin and -data
+type signed struct {
+	Source string `json:"source"`
+	domain.SignatureResponse
+}
+
+// chain is the document written by export, verify checks signatures against it without the service
+type chain struct {
+	DeviceID  string           `json:"device_id"`
+	Algorithm domain.Algorithm `json:"algorithm"`
+	// PublicKey is PEM encoded
+	PublicKey  string      `json:"public_key"`
+	Signatures []chainLink `json:"signatures"`
+}
+
+// chainLink is a signature of the device, the counter is the one it was created with
+type chainLink struct {
+	SignatureCounter int    `json:"signature_counter"`
+	Signature        string `json:"signature"`
+}
+
+// input is data to sign or verify from -data, a file or stdin
+type input struct {
+	source string
+	data   []byte
+}
+
+// readInputs returns data if it was given, the contents of files, or stdin
+func (c *cli) readInputs(data *string, files []string) ([]input, error) {
+	if *data != "" {
+		if len(files) > 0 {
+			return nil, usageError{"-data can't be combined with files"}
+		}
+		return []input{{"-", []byte(*data)}}, nil
+	}
+	if len(files) == 0 {
+		read, err := io.ReadAll(c.stdin)
+		if err != nil {
+			return nil, err
+		}
+		return []input{{"-", read}}, nil
+	}
+
+	inputs := make([]input, 0, len(files))
+	for _, file := range files {
+		read, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input{file, read})
+	}
+	return inputs, nil
+}
+
+func (c *cli) sign(ctx context.Context, args []string) error {
+	flags := newFlagSet("sign")
+	deviceID := flags.String("device", "", "UUID of the signing device")
+	idempotencyKey := flags.String("idempotency-key", "", "sign at most once with this key, generated if empty")
+	data := flags.String("data", "", "data to sign instead of files or stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *deviceID == "" {
+		return usageError{"sign needs -device"}
+	}
+	inputs, err := c.readInputs(data, flags.Args())
+	if err != nil {
+		return err
+	}
+	if *idempotencyKey != "" && len(inputs) > 1 {
+		return usageError{"-idempotency-key signs a single input"}
+	}
+
+	// inputs are signed in order, so their counters follow the order of the files
+	results := make([]signed, 0, len(inputs))
+	for _, input := range inputs {
+		var signature domain.SignatureResponse
+		if *idempotencyKey != "" {
+			signature, err = c.client.SignIdempotently(ctx, *deviceID, string(input.data), *idempotencyKey)
+		} else {
+			signature, err = c.client.Sign(ctx, *deviceID, string(input.data))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", input.source, err)
+		}
+		results = append(results, signed{input.source, signature})
+	}
+	return c.print(results, func(w io.Writer) {
+		fmt.Fprintln(w, "SOURCE\tCOUNTER\tSIGNATURE")
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", result.Source, result.SignatureCounter, result.Signature)
+		}
+	})
+}
+
+// export writes the chain of all signatures the device created so far as JSON, whatever the output format
+func (c *cli) export(ctx context.Context, args []string) error {
+	flags := newFlagSet("export")
+	deviceID := flags.String("device", "", "UUID of the device")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *deviceID == "" {
+		return usageError{"export needs -device"}
+	}
+
+	device, err := c.client.GetDevice(ctx, *deviceID)
+	if err != nil {
+		return err
+	}
+	exported := chain{
+		DeviceID:   device.UUID,
+		Algorithm:  device.Algorithm,
+		PublicKey:  string(device.PublicKey),
+		Signatures: []chainLink{},
+	}
+	if device.SignatureCounter > 0 {
+		// the stream catches up with the counter as soon as the service dispatched the events
+		err = c.client.StreamSignatures(ctx, device.UUID, 0, func(signature domain.SignatureCreatedData) bool {
+			exported.Signatures = append(exported.Signatures, chainLink{signature.SignatureCounter, signature.Signature})
+			return len(exported.Signatures) < device.SignatureCounter
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(exported)
+}
+
+func (c *cli) verify(args []string) error {
+	flags := newFlagSet("verify")
+	chainFile := flags.String("chain", "", "chain written by export, provides everything but the data")
+	publicKeyFile := flags.String("public-key", "", "PEM encoded public key of the device")
+	algorithmName := flags.String("algorithm", "", "signature algorithm of the device, ECC or RSA")
+	deviceID := flags.String("device", "", "UUID of the device")
+	counter := flags.Int("counter", -1, "signature counter the signature was created with")
+	signature := flags.String("signature", "", "base64url encoded signature")
+	previous := flags.String("previous", "", "base64url encoded signature with the preceding counter")
+	data := flags.String("data", "", "signed data instead of a file or stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *counter < 0 {
+		return usageError{"verify needs -counter"}
+	}
+	if flags.NArg() > 1 {
+		return usageError{"verify checks a single file"}
+	}
+
+	var publicKey []byte
+	var algorithm domain.Algorithm
+	if *chainFile != "" {
+		read, err := os.ReadFile(*chainFile)
+		if err != nil {
+			return err
+		}
+		var loaded chain
+		if err = json.Unmarshal(read, &loaded); err != nil {
+			return fmt.Errorf("%s: %w", *chainFile, err)
+		}
+		// flags take precedence over the chain
+		publicKey, algorithm = []byte(loaded.PublicKey), loaded.Algorithm
+		if *deviceID == "" {
+			*deviceID = loaded.DeviceID
+		}
+		for _, link := range loaded.Signatures {
+			if link.SignatureCounter == *counter && *signature == "" {
+				*signature = link.Signature
+			}
+			if link.SignatureCounter == *counter-1 && *previous == "" {
+				*previous = link.Signature
+			}
+		}
+	}
+	if *publicKeyFile != "" {
+		var err error
+		if publicKey, err = os.ReadFile(*publicKeyFile); err != nil {
+			return err
+		}
+	}
+	if *algorithmName != "" {
+		var err error
+		if algorithm, err = domain.ParseAlgorithm(*algorithmName); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	switch {
+	case len(publicKey) == 0 || algorithm == 0 || *deviceID == "":
+		return usageError{"verify needs -chain or -public-key, -algorithm and -device"}
+	case *signature == "":
+		return usageError{fmt.Sprintf("no signature with counter %d, pass -signature", *counter)}
+	}
+
+	inputs, err := c.readInputs(data, flags.Args())
+	if err != nil {
+		return err
+	}
+	valid, err := domain.VerifySignature(*deviceID, algorithm, publicKey, domain.SignatureVerification{
+		Data:              string(inputs[0].data),
+		SignatureCounter:  *counter,
+		Signature:         *signature,
+		PreviousSignature: *previous,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.print(struct {
+		Valid bool `json:"valid"`
+	}{valid}, func(w io.Writer) {
+		if valid {
+			fmt.Fprintln(w, "valid")
+		} else {
+			fmt.Fprintln(w, "invalid")
+		}
+	})
+	if err == nil && !valid {
+		return errInvalidSignature
+	}
+	return err
+}
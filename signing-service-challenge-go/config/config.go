@@ -0,0 +1,412 @@
+// Package config loads the configuration of the signing service.
+//
+// Settings are taken from the defaults, a YAML or JSON configuration file, the environment and the command line,
+// each overriding the previous. Every setting has a key like "http.listen_address", which is its path in the file,
+// the environment variable SIGNING_SERVICE_HTTP_LISTEN_ADDRESS and the flag -http-listen-address.
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	// EnvPrefix starts the environment variables of all settings.
+	EnvPrefix = "SIGNING_SERVICE_"
+	// FileEnv names the configuration file if the -config flag isn't given.
+	FileEnv = EnvPrefix + "CONFIG"
+	// StorageMemory keeps all data in memory, it is lost on restart.
+	StorageMemory = "memory"
+	// ServiceName identifies the service in exported spans.
+	ServiceName = "signing-service"
+)
+
+// redacted replaces secrets when the configuration is printed
+const redacted = "<redacted>"
+
+// Config is the configuration of the signing service.
+type Config struct {
+	HTTP HTTPConfig `yaml:"http"`
+	// GRPC serves the gRPC API unless its listen address is empty
+	GRPC     ListenerConfig `yaml:"grpc"`
+	Storage  StorageConfig  `yaml:"storage"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Events   EventsConfig   `yaml:"events"`
+	Keys     KeysConfig     `yaml:"keys"`
+	Logging  LoggingConfig  `yaml:"logging"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish on SIGTERM or SIGINT
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+	// BootstrapAPIKey is the token of the operator's admin API key, a random one is generated and written to stderr if empty
+	BootstrapAPIKey string `yaml:"bootstrap_api_key"`
+}
+
+// HTTPConfig configures the REST API server, a zero timeout disables it.
+type HTTPConfig struct {
+	ListenAddress string   `yaml:"listen_address"`
+	ReadTimeout   Duration `yaml:"read_timeout"`
+	WriteTimeout  Duration `yaml:"write_timeout"`
+	IdleTimeout   Duration `yaml:"idle_timeout"`
+}
+
+// ListenerConfig configures a server socket.
+type ListenerConfig struct {
+	ListenAddress string `yaml:"listen_address"`
+}
+
+// StorageConfig selects where data is kept, DSN is specific to the backend.
+type StorageConfig struct {
+	Backend string `yaml:"backend"`
+	DSN     string `yaml:"dsn"`
+}
+
+// TLSConfig enables TLS for the REST and gRPC APIs when certificate and key files are set,
+// the client CA enables mutual TLS.
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// WebhooksConfig bounds webhook requests and sets how often due deliveries are sent.
+type WebhooksConfig struct {
+	Timeout          Duration `yaml:"timeout"`
+	DeliveryInterval Duration `yaml:"delivery_interval"`
+}
+
+// EventsConfig controls how outbox events are handed to the sinks.
+type EventsConfig struct {
+	DispatchInterval  Duration `yaml:"dispatch_interval"`
+	DispatchBatchSize int      `yaml:"dispatch_batch_size"`
+	// HistoryRetention is how long clients can resume event streams after an event
+	HistoryRetention Duration `yaml:"history_retention"`
+	// Log writes every domain event to the log
+	Log bool `yaml:"log"`
+}
+
+// KeysConfig is the key policy of new signature devices.
+type KeysConfig struct {
+	Algorithms []string `yaml:"algorithms"`
+	RSAKeyBits int      `yaml:"rsa_key_bits"`
+}
+
+// LoggingConfig sets the minimum level (debug, info, warn or error) and the format (text or json) of the log.
+type LoggingConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// MetricsConfig enables the Prometheus metrics at /metrics of a separate listener.
+// They cover all organizations, so the listener must not be reachable by tenants.
+type MetricsConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ListenAddress string `yaml:"listen_address"`
+}
+
+// Exporters of TracingConfig
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// TracingConfig selects where OpenTelemetry spans are exported to, none disables tracing.
+// The OTLP exporter sends spans over gRPC to the collector at OTLPEndpoint.
+type TracingConfig struct {
+	Exporter     string `yaml:"exporter"`
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// OTLPInsecure connects to the collector without TLS
+	OTLPInsecure bool `yaml:"otlp_insecure"`
+}
+
+// Duration is a time.Duration written like "10s" in files, the environment and flags.
+type Duration time.Duration
+
+func (duration Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(duration).String()), nil
+}
+
+func (duration *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*duration = Duration(parsed)
+	return nil
+}
+
+// Default returns the configuration used for everything that isn't configured.
+func Default() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			ListenAddress: ":8080",
+			ReadTimeout:   Duration(api.DefaultTimeouts.Read),
+			WriteTimeout:  Duration(api.DefaultTimeouts.Write),
+			IdleTimeout:   Duration(api.DefaultTimeouts.Idle),
+		},
+		GRPC:    ListenerConfig{ListenAddress: ":9090"},
+		Storage: StorageConfig{Backend: StorageMemory},
+		Webhooks: WebhooksConfig{
+			Timeout:          Duration(10 * time.Second),
+			DeliveryInterval: Duration(time.Second),
+		},
+		Events: EventsConfig{
+			DispatchInterval:  Duration(time.Second),
+			DispatchBatchSize: 100,
+			HistoryRetention:  Duration(domain.DefaultEventHistoryRetention),
+		},
+		Keys: KeysConfig{
+			Algorithms: []string{domain.ECC.String(), domain.RSA.String()},
+			RSAKeyBits: crypto.DefaultRSAKeyBits,
+		},
+		Logging:         LoggingConfig{Level: "info", Format: "text"},
+		Metrics:         MetricsConfig{ListenAddress: "127.0.0.1:9100"},
+		Tracing:         TracingConfig{Exporter: ExporterNone, OTLPEndpoint: "localhost:4317"},
+		ShutdownTimeout: Duration(api.DefaultTimeouts.Shutdown),
+	}
+}
+
+// Load builds the configuration from the defaults, the configuration file, the environment and args,
+// and validates it. printConfig reports whether -print-config was given.
+// Flag errors and usage are written to output, flag.ErrHelp is returned if help was requested.
+func Load(
+	name string,
+	args []string,
+	lookupEnv func(key string) (string, bool),
+	output io.Writer,
+) (config Config, printConfig bool, err error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	defaultFile, _ := lookupEnv(FileEnv)
+	file := flags.String("config", defaultFile, "YAML or JSON configuration `file`, defaults to $"+FileEnv)
+	flags.BoolVar(&printConfig, "print-config", false, "print the effective configuration and exit")
+
+	// flags only record their values, they are applied after the file and the environment
+	given := make(map[string]string)
+	config = Default()
+	for _, setting := range config.settings() {
+		_, isBool := setting.value.(boolValue)
+		flags.Var(&givenFlag{given, setting.flagName(), setting.value.String(), isBool}, setting.flagName(), setting.usage)
+	}
+	if err = flags.Parse(args); err != nil {
+		return Config{}, false, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, false, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if *file != "" {
+		if err = config.loadFile(*file); err != nil {
+			return Config{}, false, err
+		}
+	}
+	for _, setting := range config.settings() {
+		if value, found := lookupEnv(setting.envName()); found {
+			if err = setting.value.Set(value); err != nil {
+				return Config{}, false, fmt.Errorf("invalid %s: %w", setting.envName(), err)
+			}
+		}
+		if value, found := given[setting.flagName()]; found {
+			if err = setting.value.Set(value); err != nil {
+				return Config{}, false, fmt.Errorf("invalid -%s: %w", setting.flagName(), err)
+			}
+		}
+	}
+
+	if err = config.Validate(); err != nil {
+		return Config{}, false, err
+	}
+	return config, printConfig, nil
+}
+
+// loadFile overrides the configuration with the settings in file, unknown settings are rejected
+func (config *Config) loadFile(file string) error {
+	read, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	// JSON is valid YAML, so one decoder reads both
+	decoder := yaml.NewDecoder(bytes.NewReader(read))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// Validate reports all invalid settings at once.
+func (config Config) Validate() error {
+	var errs []error
+	invalid := func(key string, message string) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, message))
+	}
+
+	if config.HTTP.ListenAddress == "" {
+		invalid("http.listen_address", "is required")
+	}
+	if config.HTTP.ReadTimeout < 0 || config.HTTP.WriteTimeout < 0 || config.HTTP.IdleTimeout < 0 {
+		invalid("http", "timeouts must not be negative")
+	}
+	if config.Metrics.Enabled && config.Metrics.ListenAddress == "" {
+		invalid("metrics.listen_address", "is required when metrics are enabled")
+	}
+	switch config.Storage.Backend {
+	case StorageMemory:
+		if config.Storage.DSN != "" {
+			invalid("storage.dsn", "must be empty for the memory backend")
+		}
+	default:
+		invalid("storage.backend", fmt.Sprintf("%q is not supported, use %q", config.Storage.Backend, StorageMemory))
+	}
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		invalid("tls", "cert_file and key_file must be set together")
+	}
+	if config.TLS.ClientCAFile != "" && config.TLS.CertFile == "" {
+		invalid("tls.client_ca_file", "requires cert_file and key_file")
+	}
+	if config.Webhooks.Timeout <= 0 {
+		invalid("webhooks.timeout", "must be positive")
+	}
+	if config.Webhooks.DeliveryInterval <= 0 {
+		invalid("webhooks.delivery_interval", "must be positive")
+	}
+	if config.Events.DispatchInterval <= 0 {
+		invalid("events.dispatch_interval", "must be positive")
+	}
+	if config.Events.DispatchBatchSize < 1 {
+		invalid("events.dispatch_batch_size", "must be positive")
+	}
+	if config.Events.HistoryRetention <= 0 {
+		invalid("events.history_retention", "must be positive")
+	}
+	if config.ShutdownTimeout <= 0 {
+		invalid("shutdown_timeout", "must be positive")
+	}
+	if _, err := config.Keys.Policy(); err != nil {
+		invalid("keys", err.Error())
+	}
+	if _, err := config.Logging.level(); err != nil {
+		invalid("logging.level", err.Error())
+	}
+	if config.Logging.Format != "text" && config.Logging.Format != "json" {
+		invalid("logging.format", "must be text or json")
+	}
+	switch config.Tracing.Exporter {
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+	default:
+		invalid("tracing.exporter", "must be none, stdout or otlp")
+	}
+	return errors.Join(errs...)
+}
+
+// Timeouts returns the api.Timeouts of the REST API server.
+func (config Config) Timeouts() api.Timeouts {
+	return api.Timeouts{
+		Read:     time.Duration(config.HTTP.ReadTimeout),
+		Write:    time.Duration(config.HTTP.WriteTimeout),
+		Idle:     time.Duration(config.HTTP.IdleTimeout),
+		Shutdown: time.Duration(config.ShutdownTimeout),
+	}
+}
+
+// Policy returns the domain.KeyPolicy the settings describe.
+func (keys KeysConfig) Policy() (domain.KeyPolicy, error) {
+	if len(keys.Algorithms) == 0 {
+		return domain.KeyPolicy{}, errors.New("algorithms must allow at least one algorithm")
+	}
+	// smaller keys are too short for PKCS #1 v1.5 signatures of SHA-256 hashes
+	if keys.RSAKeyBits < crypto.DefaultRSAKeyBits {
+		return domain.KeyPolicy{}, fmt.Errorf("rsa_key_bits must be at least %d", crypto.DefaultRSAKeyBits)
+	}
+	policy := domain.KeyPolicy{RSAKeyBits: keys.RSAKeyBits}
+	for _, name := range keys.Algorithms {
+		algorithm, err := domain.ParseAlgorithm(name)
+		if err != nil {
+			return domain.KeyPolicy{}, err
+		}
+		policy.Algorithms = append(policy.Algorithms, algorithm)
+	}
+	return policy, nil
+}
+
+func (config LoggingConfig) level() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(config.Level))
+	return level, err
+}
+
+// NewLogger returns a logger writing to w with the configured level and format,
+// records carry the request ID of their context and sensitive attributes are redacted, see logging.Handler.
+func (config LoggingConfig) NewLogger(w io.Writer) *slog.Logger {
+	level, _ := config.level()
+	options := &slog.HandlerOptions{Level: level}
+	if config.Format == "json" {
+		return slog.New(logging.NewHandler(slog.NewJSONHandler(w, options)))
+	}
+	return slog.New(logging.NewHandler(slog.NewTextHandler(w, options)))
+}
+
+// NewTracerProvider returns a provider exporting spans with the configured exporter, the stdout exporter writes
+// to w. It returns nil if tracing is disabled. The provider must be shut down to export the last spans.
+func (config TracingConfig) NewTracerProvider(ctx context.Context, w io.Writer) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.OTLPEndpoint)}
+		if config.OTLPInsecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, options...)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", ServiceName),
+			attribute.String("service.version", api.Version),
+		)),
+	), nil
+}
+
+// Write prints the configuration as YAML with secrets redacted.
+func (config Config) Write(w io.Writer) error {
+	if config.BootstrapAPIKey != "" {
+		config.BootstrapAPIKey = redacted
+	}
+	// a DSN may carry credentials
+	if config.Storage.DSN != "" {
+		config.Storage.DSN = redacted
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, found := values[key]
+		return value, found
+	}
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return file
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+http:
+  listen_address: ":8000"
+grpc:
+  listen_address: ":9000"
+webhooks:
+  timeout: 5s
+keys:
+  algorithms: [RSA]
+`)
+	config, printConfig, err := Load("test", []string{"-config", file, "-grpc-listen-address", ":9999"}, env(map[string]string{
+		"SIGNING_SERVICE_GRPC_LISTEN_ADDRESS": ":9001",
+		"SIGNING_SERVICE_WEBHOOKS_TIMEOUT":    "7s",
+		"SIGNING_SERVICE_EVENT_LOG":           "true",
+	}), io.Discard)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"default", config.Events.DispatchBatchSize, 100},
+		{"default duration", time.Duration(config.Events.HistoryRetention), 7 * 24 * time.Hour},
+		{"metrics are off by default", config.Metrics.Enabled, false},
+		{"file", config.HTTP.ListenAddress, ":8000"},
+		{"environment over file", time.Duration(config.Webhooks.Timeout), 7 * time.Second},
+		{"flag over environment", config.GRPC.ListenAddress, ":9999"},
+		{"legacy environment name", config.Events.Log, true},
+		{"print config", printConfig, false},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+
+	policy, err := config.Keys.Policy()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if policy.Allows(domain.ECC) || !policy.Allows(domain.RSA) {
+		t.Errorf("key policy = %v, want only RSA", policy.Algorithms)
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	file := writeFile(t, "config.json", `{"logging": {"level": "debug", "format": "json"}, "keys": {"rsa_key_bits": 2048}}`)
+	config, _, err := Load("test", []string{"-config", file}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if config.Logging.Format != "json" || config.Keys.RSAKeyBits != 2048 {
+		t.Errorf("Load() = %+v, want the settings of the JSON file", config)
+	}
+}
+
+func TestLoadDisablesGRPCWithoutListenAddress(t *testing.T) {
+	config, _, err := Load("test", []string{"-grpc-listen-address", ""}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if config.GRPC.ListenAddress != "" {
+		t.Errorf("grpc.listen_address = %q, want it empty", config.GRPC.ListenAddress)
+	}
+}
+
+func TestLoadRejectsInvalidConfiguration(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"unknown file setting", "http:\n  port: 80\n", nil, nil, "field port not found"},
+		{"unknown flag", "", []string{"-port", "80"}, nil, "flag provided but not defined"},
+		{"malformed environment", "", nil, map[string]string{"SIGNING_SERVICE_EVENTS_DISPATCH_INTERVAL": "soon"}, "invalid duration"},
+		{"unsupported backend", "", []string{"-storage-backend", "postgres"}, nil, "storage.backend"},
+		{"half TLS", "", []string{"-tls-cert-file", "cert.pem"}, nil, "must be set together"},
+		{"unknown algorithm", "", []string{"-keys-algorithms", "ECC,DSA"}, nil, "keys"},
+		{"short RSA keys", "", []string{"-keys-rsa-key-bits", "256"}, nil, "rsa_key_bits"},
+		{"log level", "", []string{"-logging-level", "loud"}, nil, "logging.level"},
+		{"negative timeout", "http:\n  read_timeout: -1s\n", nil, nil, "must not be negative"},
+		{"no shutdown timeout", "", []string{"-shutdown-timeout", "0s"}, nil, "shutdown_timeout"},
+		{"metrics without listener", "", []string{"-metrics-enabled", "-metrics-listen-address", ""}, nil, "metrics.listen_address"},
+		{"unknown span exporter", "", []string{"-tracing-exporter", "jaeger"}, nil, "tracing.exporter"},
+	}
+	for _, test := range tests {
+		args := test.args
+		if test.file != "" {
+			args = append([]string{"-config", writeFile(t, "config.yaml", test.file)}, args...)
+		}
+		_, _, err := Load("test", args, env(test.env), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: Load() error = %v, want it to mention %q", test.name, err, test.want)
+		}
+	}
+
+	_, _, err := Load("test", []string{"-h"}, env(nil), io.Discard)
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load(-h) error = %v, want %v", err, flag.ErrHelp)
+	}
+}
+
+func TestWriteRedactsSecrets(t *testing.T) {
+	config, printConfig, err := Load("test", []string{"--print-config", "-bootstrap-api-key", "ssk_secret"}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !printConfig {
+		t.Errorf("--print-config wasn't reported")
+	}
+
+	var written bytes.Buffer
+	if err = config.Write(&written); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if strings.Contains(written.String(), "ssk_secret") || !strings.Contains(written.String(), "timeout: 10s") {
+		t.Errorf("Write() printed\n%s\nwant durations and no secrets", written.String())
+	}
+
+	// the printed configuration is a valid configuration file once secrets are set again
+	file := writeFile(t, "printed.yaml", strings.ReplaceAll(written.String(), redacted, "ssk_secret"))
+	if _, _, err = Load("test", []string{"-config", file}, env(nil), io.Discard); err != nil {
+		t.Errorf("printed configuration can't be loaded: %v", err)
+	}
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	config := Default()
+	provider, err := config.Tracing.NewTracerProvider(context.Background(), io.Discard)
+	if err != nil || provider != nil {
+		t.Errorf("NewTracerProvider() = %v, %v without exporter, want no provider", provider, err)
+	}
+
+	config.Tracing.Exporter = ExporterStdout
+	var exported bytes.Buffer
+	provider, err = config.Tracing.NewTracerProvider(context.Background(), &exported)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, span := provider.Tracer("test").Start(context.Background(), "DeviceService.SignTransaction")
+	span.End()
+	// spans are exported in batches until the provider is shut down
+	if err = provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, want := range []string{`"Name":"DeviceService.SignTransaction"`, `"Value":"signing-service"`} {
+		if !strings.Contains(exported.String(), want) {
+			t.Errorf("stdout exporter wrote %s, want %s", exported.String(), want)
+		}
+	}
+}
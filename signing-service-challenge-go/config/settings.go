@@ -0,0 +1,212 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting binds a configuration field to its environment variable and flag
+type setting struct {
+	key   string
+	usage string
+	value settingValue
+	// env replaces the environment variable derived from key, for names that predate the config package
+	env string
+}
+
+// settingValue reads and writes a configuration field as string, it is a flag.Value
+type settingValue interface {
+	String() string
+	Set(value string) error
+}
+
+// settings lists every setting of config, the values write to config
+func (config *Config) settings() []setting {
+	return []setting{
+		{key: "http.listen_address", usage: "address of the REST API", value: stringValue{&config.HTTP.ListenAddress}},
+		{key: "http.read_timeout", usage: "timeout of reading a request, 0 disables it", value: durationValue{&config.HTTP.ReadTimeout}},
+		{
+			key:   "http.write_timeout",
+			usage: "timeout of writing a response, 0 disables it, event streams aren't bound by it",
+			value: durationValue{&config.HTTP.WriteTimeout},
+		},
+		{key: "http.idle_timeout", usage: "how long idle keep-alive connections are kept", value: durationValue{&config.HTTP.IdleTimeout}},
+		{key: "grpc.listen_address", usage: "address of the gRPC API, empty disables it", value: stringValue{&config.GRPC.ListenAddress}},
+		{key: "storage.backend", usage: "storage backend, only memory", value: stringValue{&config.Storage.Backend}},
+		{key: "storage.dsn", usage: "data source name of the storage backend", value: stringValue{&config.Storage.DSN}},
+		{key: "tls.cert_file", usage: "PEM certificate file, enables TLS", value: stringValue{&config.TLS.CertFile}},
+		{key: "tls.key_file", usage: "PEM private key file of the certificate", value: stringValue{&config.TLS.KeyFile}},
+		{
+			key:   "tls.client_ca_file",
+			usage: "PEM file of the CAs client certificates must be signed by, enables mutual TLS",
+			value: stringValue{&config.TLS.ClientCAFile},
+		},
+		{key: "webhooks.timeout", usage: "timeout of a webhook request", value: durationValue{&config.Webhooks.Timeout}},
+		{
+			key:   "webhooks.delivery_interval",
+			usage: "how often due webhook deliveries are sent",
+			value: durationValue{&config.Webhooks.DeliveryInterval},
+		},
+		{
+			key:   "events.dispatch_interval",
+			usage: "how often outbox events are dispatched",
+			value: durationValue{&config.Events.DispatchInterval},
+		},
+		{
+			key:   "events.dispatch_batch_size",
+			usage: "maximum number of events dispatched at once",
+			value: intValue{&config.Events.DispatchBatchSize},
+		},
+		{
+			key:   "events.history_retention",
+			usage: "how long event streams can be resumed after an event",
+			value: durationValue{&config.Events.HistoryRetention},
+		},
+		{key: "events.log", usage: "write every domain event to the log", value: boolValue{&config.Events.Log}, env: EnvPrefix + "EVENT_LOG"},
+		{
+			key:   "keys.algorithms",
+			usage: "comma separated algorithms new devices may use",
+			value: listValue{&config.Keys.Algorithms},
+		},
+		{key: "keys.rsa_key_bits", usage: "size of the RSA keys of new devices", value: intValue{&config.Keys.RSAKeyBits}},
+		{key: "logging.level", usage: "minimum level of log records, debug, info, warn or error", value: stringValue{&config.Logging.Level}},
+		{key: "logging.format", usage: "format of log records, text or json", value: stringValue{&config.Logging.Format}},
+		{key: "metrics.enabled", usage: "serve Prometheus metrics at /metrics", value: boolValue{&config.Metrics.Enabled}},
+		{
+			key:   "metrics.listen_address",
+			usage: "address of the metrics listener, keep it private, the metrics cover all organizations",
+			value: stringValue{&config.Metrics.ListenAddress},
+		},
+		{
+			key:   "tracing.exporter",
+			usage: "where OpenTelemetry spans are exported, none, stdout or otlp",
+			value: stringValue{&config.Tracing.Exporter},
+		},
+		{key: "tracing.otlp_endpoint", usage: "host:port of the OTLP gRPC collector", value: stringValue{&config.Tracing.OTLPEndpoint}},
+		{key: "tracing.otlp_insecure", usage: "connect to the OTLP collector without TLS", value: boolValue{&config.Tracing.OTLPInsecure}},
+		{
+			key:   "shutdown_timeout",
+			usage: "how long in-flight requests may take to finish on SIGTERM or SIGINT",
+			value: durationValue{&config.ShutdownTimeout},
+		},
+		{key: "bootstrap_api_key", usage: "token of the operator's admin API key", value: stringValue{&config.BootstrapAPIKey}},
+	}
+}
+
+// flagName turns "http.listen_address" into "http-listen-address"
+func (setting setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(setting.key)
+}
+
+// envName turns "http.listen_address" into "SIGNING_SERVICE_HTTP_LISTEN_ADDRESS"
+func (setting setting) envName() string {
+	if setting.env != "" {
+		return setting.env
+	}
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(setting.key, ".", "_"))
+}
+
+// givenFlag records the value of a flag, so it can be applied after the configuration file and the environment
+type givenFlag struct {
+	given        map[string]string
+	name         string
+	defaultValue string
+	isBool       bool
+}
+
+func (flag *givenFlag) String() string {
+	if flag == nil {
+		return ""
+	}
+	return flag.defaultValue
+}
+
+func (flag *givenFlag) Set(value string) error {
+	flag.given[flag.name] = value
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given without a value
+func (flag *givenFlag) IsBoolFlag() bool {
+	return flag.isBool
+}
+
+type stringValue struct {
+	target *string
+}
+
+func (value stringValue) String() string {
+	return *value.target
+}
+
+func (value stringValue) Set(s string) error {
+	*value.target = s
+	return nil
+}
+
+type intValue struct {
+	target *int
+}
+
+func (value intValue) String() string {
+	return strconv.Itoa(*value.target)
+}
+
+func (value intValue) Set(s string) error {
+	parsed, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*value.target = parsed
+	return nil
+}
+
+type boolValue struct {
+	target *bool
+}
+
+func (value boolValue) String() string {
+	return strconv.FormatBool(*value.target)
+}
+
+func (value boolValue) Set(s string) error {
+	parsed, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*value.target = parsed
+	return nil
+}
+
+type durationValue struct {
+	target *Duration
+}
+
+func (value durationValue) String() string {
+	return time.Duration(*value.target).String()
+}
+
+func (value durationValue) Set(s string) error {
+	return value.target.UnmarshalText([]byte(s))
+}
+
+// listValue is written as comma separated list
+type listValue struct {
+	target *[]string
+}
+
+func (value listValue) String() string {
+	return strings.Join(*value.target, ",")
+}
+
+func (value listValue) Set(s string) error {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*value.target = list
+	return nil
+}
@@ -3,17 +3,34 @@ package crypto
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/rsa"
+	"io"
 )
 
+// DefaultRSAKeyBits is the size of RSA keys unless configured otherwise.
+// Security has been ignored for the sake of simplicity.
+const DefaultRSAKeyBits = 512
+
 // RSAGenerator generates a RSA key pair.
-type RSAGenerator struct{}
+type RSAGenerator struct {
+	random io.Reader
+	bits   int
+}
+
+// NewRSAGenerator creates a new RSAGenerator reading entropy from random.
+// rsa.GenerateKey doesn't read random deterministically, the same source doesn't reproduce keys.
+func NewRSAGenerator(random io.Reader) *RSAGenerator {
+	return NewRSAGeneratorWithBits(random, DefaultRSAKeyBits)
+}
+
+// NewRSAGeneratorWithBits creates a new RSAGenerator of keys with the given size.
+func NewRSAGeneratorWithBits(random io.Reader, bits int) *RSAGenerator {
+	return &RSAGenerator{random: random, bits: bits}
+}
 
 // Generate generates a new RSAKeyPair.
 func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := rsa.GenerateKey(rand.Reader, 512)
+	key, err := rsa.GenerateKey(g.random, g.bits)
 	if err != nil {
 		return nil, err
 	}
@@ -25,12 +42,20 @@ func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 }
 
 // ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{}
+type ECCGenerator struct {
+	random io.Reader
+}
+
+// NewECCGenerator creates a new ECCGenerator reading entropy from random.
+// ecdsa.GenerateKey doesn't read random deterministically, the same source doesn't reproduce keys.
+func NewECCGenerator(random io.Reader) *ECCGenerator {
+	return &ECCGenerator{random: random}
+}
 
 // Generate generates a new ECCKeyPair.
 func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	key, err := ecdsa.GenerateKey(elliptic.P384(), g.random)
 	if err != nil {
 		return nil, err
 	}
@@ -4,3 +4,9 @@ package crypto
 type Signer interface {
 	Sign(dataToBeSigned []byte) ([]byte, error)
 }
+
+// KeyDecoder is implemented by signers that can decode their private key ahead of Sign,
+// so the time decoding takes can be told apart from signing.
+type KeyDecoder interface {
+	DecodeKey() error
+}
@@ -2,31 +2,47 @@ package crypto
 
 import (
 	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/sha256"
+	"io"
 )
 
 type SignerECDSA struct {
 	privateKey []byte
 	marshaler  *ECCMarshaler
+	random     io.Reader
+	// keyPair is set once the private key is decoded
+	keyPair *ECCKeyPair
 }
 
-func NewSignerECDSA(privateKey []byte, marshaler *ECCMarshaler) *SignerECDSA {
+func NewSignerECDSA(privateKey []byte, marshaler *ECCMarshaler, random io.Reader) *SignerECDSA {
 	return &SignerECDSA{
-		privateKey,
-		marshaler,
+		privateKey: privateKey,
+		marshaler:  marshaler,
+		random:     random,
 	}
 }
 
-// Sign implementation for ECC algorithm
-func (signer *SignerECDSA) Sign(dataToBeSigned []byte) ([]byte, error) {
+// DecodeKey decodes the private key, Sign decodes it itself if DecodeKey wasn't called
+func (signer *SignerECDSA) DecodeKey() error {
+	if signer.keyPair != nil {
+		return nil
+	}
 	keyPair, err := signer.marshaler.Decode(signer.privateKey)
 	if err != nil {
+		return err
+	}
+	signer.keyPair = keyPair
+	return nil
+}
+
+// Sign implementation for ECC algorithm
+func (signer *SignerECDSA) Sign(dataToBeSigned []byte) ([]byte, error) {
+	if err := signer.DecodeKey(); err != nil {
 		return nil, err
 	}
 
 	hashedData := sha256.Sum256(dataToBeSigned)
-	signedData, err := ecdsa.SignASN1(rand.Reader, keyPair.Private, hashedData[:])
+	signedData, err := ecdsa.SignASN1(signer.random, signer.keyPair.Private, hashedData[:])
 	if err != nil {
 		return nil, err
 	}
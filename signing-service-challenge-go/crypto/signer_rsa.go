@@ -9,24 +9,38 @@ import (
 type SignerRSA struct {
 	privateKey []byte
 	marshaler  *RSAMarshaler
+	// keyPair is set once the private key is decoded
+	keyPair *RSAKeyPair
 }
 
 func NewSignerRSA(privateKey []byte, marshaler *RSAMarshaler) *SignerRSA {
 	return &SignerRSA{
-		privateKey,
-		marshaler,
+		privateKey: privateKey,
+		marshaler:  marshaler,
 	}
 }
 
-// Sign implementation for RSA algorithm
-func (signer *SignerRSA) Sign(dataToBeSigned []byte) ([]byte, error) {
+// DecodeKey decodes the private key, Sign decodes it itself if DecodeKey wasn't called
+func (signer *SignerRSA) DecodeKey() error {
+	if signer.keyPair != nil {
+		return nil
+	}
 	keyPair, err := signer.marshaler.Unmarshal(signer.privateKey)
 	if err != nil {
+		return err
+	}
+	signer.keyPair = keyPair
+	return nil
+}
+
+// Sign implementation for RSA algorithm
+func (signer *SignerRSA) Sign(dataToBeSigned []byte) ([]byte, error) {
+	if err := signer.DecodeKey(); err != nil {
 		return nil, err
 	}
 
 	hashedData := sha256.Sum256(dataToBeSigned)
-	signedData, err := rsa.SignPKCS1v15(nil, keyPair.Private, crypto.SHA256, hashedData[:])
+	signedData, err := rsa.SignPKCS1v15(nil, signer.keyPair.Private, crypto.SHA256, hashedData[:])
 	if err != nil {
 		return nil, err
 	}
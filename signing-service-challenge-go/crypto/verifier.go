@@ -0,0 +1,6 @@
+package crypto
+
+// Verifier defines a contract for checking signatures created by the matching Signer.
+type Verifier interface {
+	Verify(signedData []byte, signature []byte) (bool, error)
+}
@@ -0,0 +1,29 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+)
+
+type VerifierECDSA struct {
+	publicKey []byte
+	marshaler *ECCMarshaler
+}
+
+func NewVerifierECDSA(publicKey []byte, marshaler *ECCMarshaler) *VerifierECDSA {
+	return &VerifierECDSA{
+		publicKey,
+		marshaler,
+	}
+}
+
+// Verify implementation for ECC algorithm
+func (verifier *VerifierECDSA) Verify(signedData []byte, signature []byte) (bool, error) {
+	publicKey, err := verifier.marshaler.DecodePublic(verifier.publicKey)
+	if err != nil {
+		return false, err
+	}
+
+	hashedData := sha256.Sum256(signedData)
+	return ecdsa.VerifyASN1(publicKey, hashedData[:], signature), nil
+}
@@ -0,0 +1,30 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+)
+
+type VerifierRSA struct {
+	publicKey []byte
+	marshaler *RSAMarshaler
+}
+
+func NewVerifierRSA(publicKey []byte, marshaler *RSAMarshaler) *VerifierRSA {
+	return &VerifierRSA{
+		publicKey,
+		marshaler,
+	}
+}
+
+// Verify implementation for RSA algorithm
+func (verifier *VerifierRSA) Verify(signedData []byte, signature []byte) (bool, error) {
+	publicKey, err := verifier.marshaler.UnmarshalPublic(verifier.publicKey)
+	if err != nil {
+		return false, err
+	}
+
+	hashedData := sha256.Sum256(signedData)
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashedData[:], signature) == nil, nil
+}
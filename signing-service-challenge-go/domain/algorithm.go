@@ -2,9 +2,10 @@ package domain
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"io"
+	"log/slog"
 	"strings"
 )
 
@@ -35,7 +36,7 @@ func ParseAlgorithm(s string) (Algorithm, error) {
 	s = strings.TrimSpace(strings.ToLower(s))
 	value, found := algorithmValue[s]
 	if !found {
-		return Algorithm(0), fmt.Errorf("%q is not a valid algorithm", s)
+		return Algorithm(0), InvalidAlgorithmError{Algorithm: s}
 	}
 	return Algorithm(value), nil
 }
@@ -62,22 +63,67 @@ type KeyPairInBytes struct {
 	PublicKey  []byte
 }
 
+// LogValue keeps the private key out of logs
+func (keyPair KeyPairInBytes) LogValue() slog.Value {
+	return slog.StringValue("<key pair>")
+}
+
 // GenerateKeyPairsInBytes depending on Algorithm type returns KeyPairInBytes for storing
-func (algorithm Algorithm) GenerateKeyPairsInBytes() (*KeyPairInBytes, error) {
+// using random as the entropy source. The standard library doesn't consume random deterministically,
+// so the same source doesn't reproduce the same keys.
+func (algorithm Algorithm) GenerateKeyPairsInBytes(random io.Reader) (*KeyPairInBytes, error) {
+	return algorithm.generateKeyPairsInBytes(random, crypto.DefaultRSAKeyBits)
+}
+
+func (algorithm Algorithm) generateKeyPairsInBytes(random io.Reader, rsaKeyBits int) (*KeyPairInBytes, error) {
 	switch algorithm {
 	case ECC:
 		return eccKeyPairInBytesGenerator{
 			marshaler: crypto.NewECCMarshaler(),
-			generator: &crypto.ECCGenerator{},
+			generator: crypto.NewECCGenerator(random),
 		}.generateECCKeyPairInBytes()
 	case RSA:
 		return rsaKeyPairInBytesGenerator{
 			marshaler: crypto.NewRSAMarshaler(),
-			generator: &crypto.RSAGenerator{},
+			generator: crypto.NewRSAGeneratorWithBits(random, rsaKeyBits),
 		}.generateRSAKeyPairInBytes()
 	default:
-		return nil, errors.New("invalid algorithm")
+		return nil, InvalidAlgorithmError{}
+	}
+}
+
+// KeyPolicy restricts the keys of new signature devices.
+type KeyPolicy struct {
+	// Algorithms new devices may be created with
+	Algorithms []Algorithm
+	RSAKeyBits int
+}
+
+// DefaultKeyPolicy allows all algorithms
+var DefaultKeyPolicy = KeyPolicy{
+	Algorithms: []Algorithm{ECC, RSA},
+	RSAKeyBits: crypto.DefaultRSAKeyBits,
+}
+
+// Allows reports whether new devices may use algorithm
+func (policy KeyPolicy) Allows(algorithm Algorithm) bool {
+	for _, allowed := range policy.Algorithms {
+		if allowed == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateKeyPairInBytes generates the key pair of a new device if the policy allows algorithm
+func (policy KeyPolicy) GenerateKeyPairInBytes(algorithm Algorithm, random io.Reader) (*KeyPairInBytes, error) {
+	if algorithm.String() == "" {
+		return nil, InvalidAlgorithmError{}
+	}
+	if !policy.Allows(algorithm) {
+		return nil, InvalidAlgorithmError{Algorithm: algorithm.String(), Reason: "is not allowed by the key policy"}
 	}
+	return algorithm.generateKeyPairsInBytes(random, policy.RSAKeyBits)
 }
 
 type eccKeyPairInBytesGenerator struct {
@@ -88,7 +134,7 @@ type eccKeyPairInBytesGenerator struct {
 func (keyPairGenerator eccKeyPairInBytesGenerator) generateECCKeyPairInBytes() (*KeyPairInBytes, error) {
 	eccKeyPair, err := keyPairGenerator.generator.Generate()
 	if err != nil {
-		panic("error during ECC key generation")
+		return nil, fmt.Errorf("generating ECC key: %w", err)
 	}
 
 	publicKey, privateKey, err := keyPairGenerator.marshaler.Encode(*eccKeyPair)
@@ -109,7 +155,7 @@ type rsaKeyPairInBytesGenerator struct {
 func (keyPairGenerator rsaKeyPairInBytesGenerator) generateRSAKeyPairInBytes() (*KeyPairInBytes, error) {
 	rsaKeyPair, err := keyPairGenerator.generator.Generate()
 	if err != nil {
-		panic("error during RSA key generation")
+		return nil, fmt.Errorf("generating RSA key: %w", err)
 	}
 
 	publicKey, privateKey, err := keyPairGenerator.marshaler.Marshal(*rsaKeyPair)
@@ -122,15 +168,30 @@ func (keyPairGenerator rsaKeyPairInBytesGenerator) generateRSAKeyPairInBytes() (
 	}, nil
 }
 
-func (algorithm Algorithm) Signer(privateKey []byte) (crypto.Signer, error) {
+// Signer returns crypto.Signer for Algorithm type, random is used by non-deterministic algorithms
+func (algorithm Algorithm) Signer(privateKey []byte, random io.Reader) (crypto.Signer, error) {
 	switch algorithm {
 	case ECC:
 		marshaler := crypto.NewECCMarshaler()
-		return crypto.NewSignerECDSA(privateKey, &marshaler), nil
+		return crypto.NewSignerECDSA(privateKey, &marshaler, random), nil
 	case RSA:
 		marshaler := crypto.NewRSAMarshaler()
 		return crypto.NewSignerRSA(privateKey, &marshaler), nil
 	default:
-		return nil, errors.New("invalid algorithm")
+		return nil, InvalidAlgorithmError{}
+	}
+}
+
+// Verifier returns crypto.Verifier checking signatures of the Algorithm type against publicKey
+func (algorithm Algorithm) Verifier(publicKey []byte) (crypto.Verifier, error) {
+	switch algorithm {
+	case ECC:
+		marshaler := crypto.NewECCMarshaler()
+		return crypto.NewVerifierECDSA(publicKey, &marshaler), nil
+	case RSA:
+		marshaler := crypto.NewRSAMarshaler()
+		return crypto.NewVerifierRSA(publicKey, &marshaler), nil
+	default:
+		return nil, InvalidAlgorithmError{}
 	}
 }
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"crypto/rand"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -158,7 +160,7 @@ func TestAlgorithm_UnmarshalJSON(t *testing.T) {
 }
 
 func TestAlgorithm_GenerateKeyPairsInBytesECC(t *testing.T) {
-	keyPair, err := Algorithm(1).GenerateKeyPairsInBytes()
+	keyPair, err := Algorithm(1).GenerateKeyPairsInBytes(rand.Reader)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -171,7 +173,7 @@ func TestAlgorithm_GenerateKeyPairsInBytesECC(t *testing.T) {
 }
 
 func TestAlgorithm_GenerateKeyPairsInBytesRSA(t *testing.T) {
-	keyPair, err := Algorithm(2).GenerateKeyPairsInBytes()
+	keyPair, err := Algorithm(2).GenerateKeyPairsInBytes(rand.Reader)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -184,8 +186,23 @@ func TestAlgorithm_GenerateKeyPairsInBytesRSA(t *testing.T) {
 }
 
 func TestAlgorithm_GenerateKeyPairsInBytesInvalid(t *testing.T) {
-	_, err := Algorithm(0).GenerateKeyPairsInBytes()
+	_, err := Algorithm(0).GenerateKeyPairsInBytes(rand.Reader)
 	if err == nil {
 		t.Errorf("error should present for invalid algorithm")
 	}
 }
+
+// failingReader fails every read like an exhausted entropy source
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy source exhausted")
+}
+
+func TestAlgorithm_GenerateKeyPairsInBytesFailingEntropy(t *testing.T) {
+	for _, algorithm := range []Algorithm{ECC, RSA} {
+		if _, err := algorithm.GenerateKeyPairsInBytes(failingReader{}); err == nil {
+			t.Errorf("%s: key generation succeeded without entropy", algorithm)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"strings"
+	"time"
+)
+
+const apiKeyPrefix = "ssk_"
+
+// AllDevices is the device grant that lets an API key sign with every device of its organization
+const AllDevices = "*"
+
+var (
+	// ErrUnauthenticated is returned for missing, unknown or revoked API keys.
+	ErrUnauthenticated = errors.New("invalid or revoked API key")
+	// ErrAPIKeyRevoked is returned when revoking an already revoked API key.
+	ErrAPIKeyRevoked = errors.New("API key is already revoked")
+	// ErrCertificateSubjectBound is returned when binding a subject another API key of the organization holds.
+	ErrCertificateSubjectBound = errors.New("certificate subject is already bound to another API key")
+)
+
+// APIKey is a credential presented by API clients. Only the hash of the secret token is stored.
+type APIKey struct {
+	ID             string   `json:"id"`
+	OrganizationID string   `json:"organization_id"`
+	Name           string   `json:"name"`
+	Hash           [32]byte `json:"-"`
+	Roles          []Role   `json:"roles"`
+	// DeviceGrants lists the devices the API key signs with, AllDevices grants every device of the organization.
+	// Signer keys without grants can't sign, other keys are only restricted once devices are granted.
+	DeviceGrants []string `json:"device_grants,omitempty"`
+	// CertificateSubject lets clients authenticate with a TLS client certificate of this subject,
+	// it names the organization in an O attribute
+	CertificateSubject string     `json:"certificate_subject,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	LastUsedAt         *time.Time `json:"last_used_at"`
+	RevokedAt          *time.Time `json:"revoked_at"`
+}
+
+// CreateAPIKeyResponse returns the secret token, which is shown to the client only once.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Token string `json:"token"`
+}
+
+// APIKeysRepository stores API keys, lookups by id and listings are partitioned by organization.
+type APIKeysRepository interface {
+	Get(organizationID string, id string) (APIKey, bool)
+	GetByHash(hash [32]byte) (APIKey, bool)
+	// GetByCertificateSubject finds the API key of the organization bound to subject,
+	// subjects are unique within an organization
+	GetByCertificateSubject(organizationID string, subject string) (APIKey, bool)
+	GetAll(organizationID string) []APIKey
+	Create(apiKey APIKey) error
+	Update(apiKey APIKey) error
+	// Touch records that the API key was used at usedAt
+	Touch(id string, usedAt time.Time) error
+}
+
+// Can reports whether any role of the API key grants permission
+func (apiKey APIKey) Can(permission Permission) bool {
+	for _, role := range apiKey.Roles {
+		if role.Grants(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the API key holds role
+func (apiKey APIKey) HasRole(role Role) bool {
+	for _, held := range apiKey.Roles {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSignWith reports whether the device grants of the API key include the device
+func (apiKey APIKey) CanSignWith(deviceID string) bool {
+	if len(apiKey.DeviceGrants) == 0 {
+		return !apiKey.HasRole(RoleSigner)
+	}
+	for _, granted := range apiKey.DeviceGrants {
+		if granted == deviceID || granted == AllDevices {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyService manages API keys and authenticates tokens.
+type APIKeyService struct {
+	repo   APIKeysRepository
+	audit  *AuditLog
+	random io.Reader
+	clock  Clock
+}
+
+// NewAPIKeyService is a factory to instantiate a new APIKeyService.
+func NewAPIKeyService(repo APIKeysRepository, audit *AuditLog, random io.Reader, clock Clock) *APIKeyService {
+	return &APIKeyService{
+		repo:   repo,
+		audit:  audit,
+		random: random,
+		clock:  clock,
+	}
+}
+
+// CreateAPIKey generates a new secret token of the organization with the given roles and stores its hash
+func (service *APIKeyService) CreateAPIKey(
+	organizationID string,
+	actor string,
+	name string,
+	roles []string,
+) (CreateAPIKeyResponse, error) {
+	if len(roles) == 0 {
+		return CreateAPIKeyResponse{}, ValidationError{"roles", "at least one role is required"}
+	}
+	parsedRoles := make([]Role, 0, len(roles))
+	for _, s := range roles {
+		role, err := ParseRole(s)
+		if err != nil {
+			return CreateAPIKeyResponse{}, ValidationError{"roles", err.Error()}
+		}
+		parsedRoles = append(parsedRoles, role)
+	}
+
+	id, err := uuid.NewRandomFromReader(service.random)
+	if err != nil {
+		return CreateAPIKeyResponse{}, err
+	}
+	token, err := NewAPIKeyToken(service.random)
+	if err != nil {
+		return CreateAPIKeyResponse{}, err
+	}
+
+	apiKey := APIKey{
+		ID:             id.String(),
+		OrganizationID: organizationID,
+		Name:           name,
+		Hash:           hashAPIKeyToken(token),
+		Roles:          parsedRoles,
+		CreatedAt:      service.clock.Now(),
+	}
+	if err = service.repo.Create(apiKey); err != nil {
+		return CreateAPIKeyResponse{}, err
+	}
+	if err = service.audit.Record(organizationID, actor, AuditAPIKeyCreated, apiKey.ID, nil, apiKey); err != nil {
+		return CreateAPIKeyResponse{}, err
+	}
+
+	return CreateAPIKeyResponse{APIKey: apiKey, Token: token}, nil
+}
+
+// ImportAPIKey stores an externally provisioned token, e.g. the bootstrap admin key
+func (service *APIKeyService) ImportAPIKey(
+	organizationID string,
+	name string,
+	token string,
+	roles []Role,
+) (APIKey, error) {
+	if !strings.HasPrefix(token, apiKeyPrefix) || len(token) < len(apiKeyPrefix)+32 {
+		return APIKey{}, ValidationError{"token", fmt.Sprintf("must start with %q and hold at least 32 characters", apiKeyPrefix)}
+	}
+	id, err := uuid.NewRandomFromReader(service.random)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	apiKey := APIKey{
+		ID:             id.String(),
+		OrganizationID: organizationID,
+		Name:           name,
+		Hash:           hashAPIKeyToken(token),
+		Roles:          roles,
+		CreatedAt:      service.clock.Now(),
+	}
+	if err = service.repo.Create(apiKey); err != nil {
+		return APIKey{}, err
+	}
+	if err = service.audit.Record(organizationID, SystemActor, AuditAPIKeyCreated, apiKey.ID, nil, apiKey); err != nil {
+		return APIKey{}, err
+	}
+	return apiKey, nil
+}
+
+// ListAPIKeys returns all stored API keys of the organization, including revoked ones
+func (service *APIKeyService) ListAPIKeys(organizationID string) []APIKey {
+	return service.repo.GetAll(organizationID)
+}
+
+// RevokeAPIKey permanently disables the API key of the organization
+func (service *APIKeyService) RevokeAPIKey(organizationID string, actor string, id string) (APIKey, error) {
+	apiKey, found := service.repo.Get(organizationID, id)
+	if !found {
+		return APIKey{}, NotFoundError{"API key", id}
+	}
+	if apiKey.RevokedAt != nil {
+		return APIKey{}, ErrAPIKeyRevoked
+	}
+
+	before := apiKey
+	now := service.clock.Now()
+	apiKey.RevokedAt = &now
+	return service.update(actor, AuditAPIKeyRevoked, before, apiKey)
+}
+
+// GrantDevices restricts signing of the API key to deviceIDs, AllDevices grants every device of the organization.
+// An empty list revokes all grants, which leaves signer keys unable to sign.
+func (service *APIKeyService) GrantDevices(
+	organizationID string,
+	actor string,
+	id string,
+	deviceIDs []string,
+) (APIKey, error) {
+	grants := make([]string, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		if deviceID == AllDevices {
+			if len(deviceIDs) > 1 {
+				return APIKey{}, ValidationError{"device_ids", fmt.Sprintf("%q can't be combined with device ids", AllDevices)}
+			}
+			grants = append(grants, AllDevices)
+			continue
+		}
+		parsed, err := uuid.Parse(deviceID)
+		if err != nil {
+			return APIKey{}, ValidationError{"device_ids", fmt.Sprintf("%q is not a valid UUID", deviceID)}
+		}
+		grants = append(grants, parsed.String())
+	}
+
+	apiKey, found := service.repo.Get(organizationID, id)
+	if !found {
+		return APIKey{}, NotFoundError{"API key", id}
+	}
+	if apiKey.RevokedAt != nil {
+		return APIKey{}, ErrAPIKeyRevoked
+	}
+
+	before := apiKey
+	apiKey.DeviceGrants = grants
+	return service.update(actor, AuditAPIKeyDevicesGranted, before, apiKey)
+}
+
+// BindCertificateSubject allows authenticating as the API key with a client certificate of subject.
+// The subject must name the organization in an O attribute, like "CN=till-7,O=<organization ID>", so a
+// certificate of the shared client CA only ever authenticates as a key of the organization it was issued to.
+// It is stored in the form certificates are looked up by, however it was spelled.
+func (service *APIKeyService) BindCertificateSubject(
+	organizationID string,
+	actor string,
+	id string,
+	subject string,
+) (APIKey, error) {
+	if strings.TrimSpace(subject) == "" {
+		return APIKey{}, ValidationError{"subject", "must not be empty"}
+	}
+	name, err := parseDistinguishedName(subject)
+	if err != nil {
+		return APIKey{}, ValidationError{"subject", fmt.Sprintf("must be a distinguished name: %v", err)}
+	}
+	if !namesOrganization(name, organizationID) {
+		return APIKey{}, ValidationError{"subject", fmt.Sprintf("must contain the attribute O=%s", organizationID)}
+	}
+	apiKey, found := service.repo.Get(organizationID, id)
+	if !found {
+		return APIKey{}, NotFoundError{"API key", id}
+	}
+	if apiKey.RevokedAt != nil {
+		return APIKey{}, ErrAPIKeyRevoked
+	}
+
+	before := apiKey
+	apiKey.CertificateSubject = name.String()
+	return service.update(actor, AuditAPIKeyCertificateBound, before, apiKey)
+}
+
+// update stores apiKey and records the change from before in the audit log
+func (service *APIKeyService) update(actor string, action AuditAction, before APIKey, apiKey APIKey) (APIKey, error) {
+	if err := service.repo.Update(apiKey); err != nil {
+		return APIKey{}, err
+	}
+	if err := service.audit.Record(apiKey.OrganizationID, actor, action, apiKey.ID, before, apiKey); err != nil {
+		return APIKey{}, err
+	}
+	return apiKey, nil
+}
+
+// Authenticate resolves a presented token to its active API key and records its usage
+func (service *APIKeyService) Authenticate(token string) (APIKey, error) {
+	apiKey, found := service.repo.GetByHash(hashAPIKeyToken(token))
+	return service.use(apiKey, found)
+}
+
+// AuthenticateCertificate resolves the subject of a verified client certificate to its active API key.
+// Only keys of the organizations the certificate names are considered.
+func (service *APIKeyService) AuthenticateCertificate(subject pkix.Name) (APIKey, error) {
+	for _, organizationID := range subject.Organization {
+		if apiKey, found := service.repo.GetByCertificateSubject(organizationID, subject.String()); found {
+			return service.use(apiKey, found)
+		}
+	}
+	return service.use(APIKey{}, false)
+}
+
+// namesOrganization reports whether name has the attribute O=organizationID
+func namesOrganization(name pkix.Name, organizationID string) bool {
+	for _, organization := range name.Organization {
+		if organization == organizationID {
+			return true
+		}
+	}
+	return false
+}
+
+func (service *APIKeyService) use(apiKey APIKey, found bool) (APIKey, error) {
+	if !found || apiKey.RevokedAt != nil {
+		return APIKey{}, ErrUnauthenticated
+	}
+
+	now := service.clock.Now()
+	if err := service.repo.Touch(apiKey.ID, now); err != nil {
+		return APIKey{}, err
+	}
+	apiKey.LastUsedAt = &now
+	return apiKey, nil
+}
+
+// NewAPIKeyToken generates a random token in the format accepted by ImportAPIKey
+func NewAPIKeyToken(random io.Reader) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(random, secret); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashAPIKeyToken(token string) [32]byte {
+	return sha256.Sum256([]byte(token))
+}
@@ -0,0 +1,328 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testAPIKeysRepository struct {
+	storage map[string]APIKey
+}
+
+func (repo *testAPIKeysRepository) Get(organizationID string, id string) (APIKey, bool) {
+	apiKey, found := repo.storage[id]
+	if apiKey.OrganizationID != organizationID {
+		return APIKey{}, false
+	}
+	return apiKey, found
+}
+func (repo *testAPIKeysRepository) GetByHash(hash [32]byte) (APIKey, bool) {
+	for _, apiKey := range repo.storage {
+		if apiKey.Hash == hash {
+			return apiKey, true
+		}
+	}
+	return APIKey{}, false
+}
+func (repo *testAPIKeysRepository) GetByCertificateSubject(organizationID string, subject string) (APIKey, bool) {
+	for _, apiKey := range repo.storage {
+		if apiKey.OrganizationID == organizationID && apiKey.CertificateSubject == subject {
+			return apiKey, true
+		}
+	}
+	return APIKey{}, false
+}
+func (repo *testAPIKeysRepository) GetAll(string) []APIKey {
+	return nil
+}
+func (repo *testAPIKeysRepository) Create(apiKey APIKey) error {
+	repo.storage[apiKey.ID] = apiKey
+	return nil
+}
+func (repo *testAPIKeysRepository) Update(apiKey APIKey) error {
+	repo.storage[apiKey.ID] = apiKey
+	return nil
+}
+func (repo *testAPIKeysRepository) Touch(id string, usedAt time.Time) error {
+	apiKey := repo.storage[id]
+	apiKey.LastUsedAt = &usedAt
+	repo.storage[id] = apiKey
+	return nil
+}
+
+func TestAPIKeyService_CreateAndAuthenticate(t *testing.T) {
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, fixedClock{now: now})
+
+	created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"signer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if repo.storage[created.ID].Hash == [32]byte{} || created.Hash != hashAPIKeyToken(created.Token) {
+		t.Errorf("token hash wasn't stored")
+	}
+
+	apiKey, err := service.Authenticate(created.Token)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if apiKey.ID != created.ID {
+		t.Errorf("authenticated the wrong API key")
+	}
+	if lastUsed := repo.storage[created.ID].LastUsedAt; lastUsed == nil || !lastUsed.Equal(now) {
+		t.Errorf("last usage wasn't tracked")
+	}
+	if !apiKey.Can(PermissionSignTransactions) || apiKey.Can(PermissionManageDevices) {
+		t.Errorf("API key roles = %v, want only signer", apiKey.Roles)
+	}
+
+	if _, err = service.Authenticate(created.Token + "x"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("unknown token should be rejected, got %v", err)
+	}
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, SystemClock{})
+	created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"viewer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if _, err = service.RevokeAPIKey(testOrganizationID, testActor, created.ID); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = service.Authenticate(created.Token); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("revoked API key should be rejected, got %v", err)
+	}
+	if _, err = service.RevokeAPIKey(testOrganizationID, testActor, created.ID); !errors.Is(err, ErrAPIKeyRevoked) {
+		t.Errorf("RevokeAPIKey() error = %v, want %v", err, ErrAPIKeyRevoked)
+	}
+}
+
+func TestAPIKey_Can(t *testing.T) {
+	tests := []struct {
+		name       string
+		roles      []Role
+		permission Permission
+		want       bool
+	}{
+		{"viewer reads devices", []Role{RoleViewer}, PermissionReadDevices, true},
+		{"viewer can't sign", []Role{RoleViewer}, PermissionSignTransactions, false},
+		{"signer signs", []Role{RoleSigner}, PermissionSignTransactions, true},
+		{"signer can't manage devices", []Role{RoleSigner}, PermissionManageDevices, false},
+		{"device admin manages devices", []Role{RoleDeviceAdmin}, PermissionManageDevices, true},
+		{"device admin can't sign", []Role{RoleDeviceAdmin}, PermissionSignTransactions, false},
+		{"auditor reads audit", []Role{RoleAuditor}, PermissionReadAudit, true},
+		{"auditor can't manage API keys", []Role{RoleAuditor}, PermissionManageAPIKeys, false},
+		{"roles combine", []Role{RoleViewer, RoleAuditor}, PermissionReadAudit, true},
+		{"admin manages API keys", []Role{RoleAdmin}, PermissionManageAPIKeys, true},
+		{"no roles", nil, PermissionReadDevices, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (APIKey{Roles: tt.roles}).Can(tt.permission); got != tt.want {
+				t.Errorf("Can() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_GrantDevices(t *testing.T) {
+	repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, SystemClock{})
+	created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"signer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	granted := "8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1"
+	other := "c9f0f895-fb98-4b91-8bd9-0b4bd2a0bd24"
+
+	if created.CanSignWith(other) {
+		t.Errorf("signer key without grants shouldn't sign with any device")
+	}
+	apiKey, err := service.GrantDevices(testOrganizationID, testActor, created.ID, []string{granted})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !apiKey.CanSignWith(granted) || apiKey.CanSignWith(other) {
+		t.Errorf("API key should only sign with granted devices")
+	}
+	if apiKey, err = service.GrantDevices(testOrganizationID, testActor, created.ID, []string{AllDevices}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !apiKey.CanSignWith(granted) || !apiKey.CanSignWith(other) {
+		t.Errorf("wildcard grant should sign with every device")
+	}
+	if apiKey, err = service.GrantDevices(testOrganizationID, testActor, created.ID, []string{}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if apiKey.CanSignWith(granted) {
+		t.Errorf("empty grants should revoke signing")
+	}
+	if _, err = service.GrantDevices(testOrganizationID, testActor, created.ID, []string{"till-1"}); err == nil {
+		t.Errorf("invalid device id should be rejected")
+	}
+	if _, err = service.GrantDevices(testOrganizationID, testActor, created.ID, []string{AllDevices, granted}); err == nil {
+		t.Errorf("wildcard combined with device ids should be rejected")
+	}
+}
+
+func TestAPIKey_CanSignWithoutGrants(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []Role
+		want  bool
+	}{
+		{"signer", []Role{RoleSigner}, false},
+		{"signer and admin", []Role{RoleSigner, RoleAdmin}, false},
+		{"admin", []Role{RoleAdmin}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			apiKey := APIKey{Roles: test.roles}
+			if got := apiKey.CanSignWith("8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1"); got != test.want {
+				t.Errorf("CanSignWith() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_CreateInvalidRole(t *testing.T) {
+	repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, SystemClock{})
+
+	if _, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"root"}); err == nil {
+		t.Errorf("invalid role should be rejected")
+	}
+	if _, err := service.CreateAPIKey(testOrganizationID, testActor, "till", nil); err == nil {
+		t.Errorf("API key without roles should be rejected")
+	}
+}
+
+func TestAPIKeyService_AuthenticateCertificate(t *testing.T) {
+	repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, SystemClock{})
+	created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"signer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	subject := pkix.Name{CommonName: "till-1", Organization: []string{testOrganizationID}}
+
+	if _, err = service.AuthenticateCertificate(subject); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("unbound subject should be rejected, got %v", err)
+	}
+	if _, err = service.BindCertificateSubject(testOrganizationID, testActor, created.ID, subject.String()); err != nil {
+		t.Fatalf(err.Error())
+	}
+	apiKey, err := service.AuthenticateCertificate(subject)
+	if err != nil || apiKey.ID != created.ID {
+		t.Errorf("bound subject should authenticate as the API key, err = %v", err)
+	}
+	if _, err = service.BindCertificateSubject("other", testActor, created.ID, "CN=till-1,O=other"); err == nil {
+		t.Errorf("another organization bound a certificate to the API key")
+	}
+}
+
+func TestAPIKeyService_BindCertificateSubjectOfOtherOrganization(t *testing.T) {
+	repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, SystemClock{})
+	created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"signer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	var validation ValidationError
+	for _, subject := range []string{"CN=till-7", "CN=till-7,O=other", "CN=till-7,O=" + testOrganizationID + "-other"} {
+		if _, err = service.BindCertificateSubject(testOrganizationID, testActor, created.ID, subject); !errors.As(err, &validation) {
+			t.Errorf("subject %q not naming the organization was bound, err = %v", subject, err)
+		}
+	}
+	// a subject naming both organizations only authenticates within the organization that bound it
+	subject := pkix.Name{CommonName: "till-7", Organization: []string{"other", testOrganizationID}}
+	if _, err = service.BindCertificateSubject(testOrganizationID, testActor, created.ID, subject.String()); err != nil {
+		t.Fatalf(err.Error())
+	}
+	apiKey, err := service.AuthenticateCertificate(subject)
+	if err != nil || apiKey.OrganizationID != testOrganizationID {
+		t.Errorf("certificate authenticated as %v, err = %v", apiKey, err)
+	}
+}
+
+func TestAPIKeyService_BindCertificateSubjectCanonicalizes(t *testing.T) {
+	want := pkix.Name{CommonName: "till-7", Organization: []string{testOrganizationID}, OrganizationalUnit: []string{"north"}}
+	tests := []string{
+		"CN=till-7,OU=north,O=" + testOrganizationID,
+		"cn=till-7, ou=north, o=" + testOrganizationID,
+		" O = " + testOrganizationID + " , OU=north,CN=till-7 ",
+		`CN=till\2d7+OU=north,O=` + testOrganizationID,
+		"2.5.4.3=#0c0674696c6c2d37,OU=north,O=" + testOrganizationID,
+	}
+	for _, subject := range tests {
+		repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+		service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, SystemClock{})
+		created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"signer"})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		bound, err := service.BindCertificateSubject(testOrganizationID, testActor, created.ID, subject)
+		if err != nil {
+			t.Errorf("%q: BindCertificateSubject() error = %v", subject, err)
+			continue
+		}
+		if bound.CertificateSubject != want.String() {
+			t.Errorf("%q: bound subject %q, want %q", subject, bound.CertificateSubject, want.String())
+		}
+		if _, err = service.AuthenticateCertificate(want); err != nil {
+			t.Errorf("%q: certificate of the subject didn't authenticate, err = %v", subject, err)
+		}
+	}
+}
+
+func TestAPIKeyService_BindCertificateSubjectRejectsMalformedSubjects(t *testing.T) {
+	repo := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&repo, newTestAuditLog(), rand.Reader, SystemClock{})
+	created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"signer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	var validation ValidationError
+	for _, subject := range []string{
+		"till-7",
+		"CN=till-7,O=" + testOrganizationID + ",",
+		"X=till-7,O=" + testOrganizationID,
+		`CN=till-7\,O=` + testOrganizationID,
+		`CN=till\zz,O=` + testOrganizationID,
+		"CN=#zz,O=" + testOrganizationID,
+	} {
+		if _, err = service.BindCertificateSubject(testOrganizationID, testActor, created.ID, subject); !errors.As(err, &validation) {
+			t.Errorf("malformed subject %q was bound, err = %v", subject, err)
+		}
+	}
+}
+
+func TestParseDistinguishedName_RoundTripsCertificateSubjects(t *testing.T) {
+	email := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+	subjects := []pkix.Name{
+		{CommonName: "till, #7", Organization: []string{"a+b", "c"}, Country: []string{"DE"}},
+		{CommonName: " padded ", SerialNumber: "42", Names: []pkix.AttributeTypeAndValue{{Type: email, Value: "till@example.com"}}},
+	}
+	for _, subject := range subjects {
+		parsed, err := parseDistinguishedName(subject.String())
+		if err != nil {
+			t.Errorf("%q: %v", subject.String(), err)
+			continue
+		}
+		if parsed.String() != subject.String() {
+			t.Errorf("parsed %q as %q", subject.String(), parsed.String())
+		}
+	}
+}
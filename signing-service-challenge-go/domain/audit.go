@@ -0,0 +1,260 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AuditAction names an administrative action recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditDeviceCreated          AuditAction = "device.created"
+	AuditDeviceUpdated          AuditAction = "device.updated"
+	AuditDeviceSuspended        AuditAction = "device.suspended"
+	AuditDeviceResumed          AuditAction = "device.resumed"
+	AuditDeviceDecommissioned   AuditAction = "device.decommissioned"
+	AuditAPIKeyCreated          AuditAction = "api_key.created"
+	AuditAPIKeyRevoked          AuditAction = "api_key.revoked"
+	AuditAPIKeyDevicesGranted   AuditAction = "api_key.devices_granted"
+	AuditAPIKeyCertificateBound AuditAction = "api_key.certificate_bound"
+	AuditOrganizationCreated    AuditAction = "organization.created"
+	AuditWebhookCreated         AuditAction = "webhook.created"
+	AuditWebhookDeleted         AuditAction = "webhook.deleted"
+)
+
+// SystemActor is recorded for actions the service performs on its own, e.g. bootstrapping.
+const SystemActor = "system"
+
+// maxAuditAppendAttempts bounds retries when concurrent writers extend the same chain
+const maxAuditAppendAttempts = 10
+
+// AuditRetryInterval is how often Run retries entries the repository didn't accept
+const AuditRetryInterval = time.Second
+
+// ErrAuditChainConflict is returned by AuditRepository.Append when the entry doesn't follow the last one.
+var ErrAuditChainConflict = errors.New("audit entry doesn't extend the current chain")
+
+// AuditEntry is one link of the append-only audit chain of an organization.
+// Hash covers all other fields, including the Hash of the previous entry.
+type AuditEntry struct {
+	Sequence       int             `json:"sequence"`
+	OrganizationID string          `json:"organization_id"`
+	Actor          string          `json:"actor"`
+	Action         AuditAction     `json:"action"`
+	Target         string          `json:"target"`
+	Before         json.RawMessage `json:"before"`
+	After          json.RawMessage `json:"after"`
+	Timestamp      time.Time       `json:"timestamp"`
+	PreviousHash   string          `json:"previous_hash"`
+	Hash           string          `json:"hash"`
+}
+
+// AuditFilter narrows down audit entries, zero values match everything.
+type AuditFilter struct {
+	Actor  string
+	Action AuditAction
+	Target string
+	Since  time.Time
+	Until  time.Time
+}
+
+// AuditVerification is the result of checking an audit chain for tampering.
+type AuditVerification struct {
+	Valid    bool `json:"valid"`
+	Entries  int  `json:"entries"`
+	BrokenAt *int `json:"broken_at,omitempty"`
+}
+
+type AuditRepository interface {
+	// Append stores entry if it directly follows the last entry of its organization,
+	// otherwise it fails with ErrAuditChainConflict.
+	Append(entry AuditEntry) error
+	Last(organizationID string) (AuditEntry, bool)
+	GetAll(organizationID string) []AuditEntry
+}
+
+// AuditLog records administrative actions in a hash chain per organization.
+// Entries are recorded after the change they describe is stored, so an entry the repository doesn't accept
+// is kept pending and retried instead of failing a change that already happened.
+type AuditLog struct {
+	repo  AuditRepository
+	clock Clock
+	// mutex serializes appends, so pending entries of an organization are written before newer ones
+	mutex   sync.Mutex
+	pending []AuditEntry
+}
+
+// NewAuditLog is a factory to instantiate a new AuditLog.
+func NewAuditLog(repo AuditRepository, clock Clock) *AuditLog {
+	return &AuditLog{
+		repo:  repo,
+		clock: clock,
+	}
+}
+
+// Record appends an entry with the serialized before and after state of target.
+// If the repository fails, the entry is kept pending and retried by later calls and by Retry,
+// Record then only fails when the states can't be serialized.
+func (log *AuditLog) Record(
+	organizationID string,
+	actor string,
+	action AuditAction,
+	target string,
+	before interface{},
+	after interface{},
+) error {
+	beforeJSON, err := marshalAuditState(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshalAuditState(after)
+	if err != nil {
+		return err
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	log.pending = append(log.pending, AuditEntry{
+		OrganizationID: organizationID,
+		Actor:          actor,
+		Action:         action,
+		Target:         target,
+		Before:         beforeJSON,
+		After:          afterJSON,
+		Timestamp:      log.clock.Now(),
+	})
+	if err = log.appendPending(); err != nil {
+		slog.Warn("Could not write audit entry, retrying", "action", action, "target", target, "error", err)
+	}
+	return nil
+}
+
+// Retry appends the entries the repository didn't accept yet
+func (log *AuditLog) Retry() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return log.appendPending()
+}
+
+// Run retries pending entries every interval until ctx is done
+func (log *AuditLog) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := log.Retry(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// appendPending appends pending entries in record order, entries of an organization whose
+// append failed stay pending together with all later entries of the organization
+func (log *AuditLog) appendPending() error {
+	var errs []error
+	failed := make(map[string]bool)
+	remaining := log.pending[:0]
+	for _, entry := range log.pending {
+		if !failed[entry.OrganizationID] {
+			err := log.append(entry)
+			if err == nil {
+				continue
+			}
+			failed[entry.OrganizationID] = true
+			errs = append(errs, fmt.Errorf("organization %s: %w", entry.OrganizationID, err))
+		}
+		remaining = append(remaining, entry)
+	}
+	log.pending = remaining
+	return errors.Join(errs...)
+}
+
+// append links entry to the last entry of its organization and stores it
+func (log *AuditLog) append(entry AuditEntry) error {
+	var err error
+	for attempt := 0; attempt < maxAuditAppendAttempts; attempt++ {
+		entry.Sequence, entry.PreviousHash = 1, ""
+		if last, found := log.repo.Last(entry.OrganizationID); found {
+			entry.Sequence = last.Sequence + 1
+			entry.PreviousHash = last.Hash
+		}
+		entry.Hash, err = hashAuditEntry(entry)
+		if err != nil {
+			return err
+		}
+
+		err = log.repo.Append(entry)
+		if !errors.Is(err, ErrAuditChainConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// Entries returns the audit entries of the organization matching filter in chain order
+func (log *AuditLog) Entries(organizationID string, filter AuditFilter) []AuditEntry {
+	entries := make([]AuditEntry, 0)
+	for _, entry := range log.repo.GetAll(organizationID) {
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Verify recomputes the chain of the organization and reports the first entry that was altered
+func (log *AuditLog) Verify(organizationID string) (AuditVerification, error) {
+	entries := log.repo.GetAll(organizationID)
+	previousHash := ""
+	for i, entry := range entries {
+		hash, err := hashAuditEntry(entry)
+		if err != nil {
+			return AuditVerification{}, err
+		}
+		if entry.Sequence != i+1 || entry.PreviousHash != previousHash || entry.Hash != hash {
+			brokenAt := entry.Sequence
+			return AuditVerification{Valid: false, Entries: len(entries), BrokenAt: &brokenAt}, nil
+		}
+		previousHash = entry.Hash
+	}
+	return AuditVerification{Valid: true, Entries: len(entries)}, nil
+}
+
+func (filter AuditFilter) matches(entry AuditEntry) bool {
+	return (filter.Actor == "" || entry.Actor == filter.Actor) &&
+		(filter.Action == "" || entry.Action == filter.Action) &&
+		(filter.Target == "" || entry.Target == filter.Target) &&
+		(filter.Since.IsZero() || !entry.Timestamp.Before(filter.Since)) &&
+		(filter.Until.IsZero() || entry.Timestamp.Before(filter.Until))
+}
+
+func marshalAuditState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return json.RawMessage("null"), nil
+	}
+	return json.Marshal(state)
+}
+
+// hashAuditEntry hashes the JSON encoding of entry without its own Hash
+func hashAuditEntry(entry AuditEntry) (string, error) {
+	entry.Hash = ""
+	entry.Timestamp = entry.Timestamp.UTC()
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,254 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testAuditRepository struct {
+	entries map[string][]AuditEntry
+}
+
+func newTestAuditLog() *AuditLog {
+	return NewAuditLog(&testAuditRepository{entries: make(map[string][]AuditEntry)}, SystemClock{})
+}
+
+func (repo *testAuditRepository) Append(entry AuditEntry) error {
+	entries := repo.entries[entry.OrganizationID]
+	if entry.Sequence != len(entries)+1 {
+		return ErrAuditChainConflict
+	}
+	repo.entries[entry.OrganizationID] = append(entries, entry)
+	return nil
+}
+func (repo *testAuditRepository) Last(organizationID string) (AuditEntry, bool) {
+	entries := repo.entries[organizationID]
+	if len(entries) == 0 {
+		return AuditEntry{}, false
+	}
+	return entries[len(entries)-1], true
+}
+func (repo *testAuditRepository) GetAll(organizationID string) []AuditEntry {
+	return repo.entries[organizationID]
+}
+
+// conflictingAuditRepository rejects the first append as if another writer extended the chain
+type conflictingAuditRepository struct {
+	testAuditRepository
+	conflicts int
+}
+
+func (repo *conflictingAuditRepository) Append(entry AuditEntry) error {
+	if repo.conflicts > 0 {
+		repo.conflicts--
+		return ErrAuditChainConflict
+	}
+	return repo.testAuditRepository.Append(entry)
+}
+
+// failingAuditRepository rejects appends of the organization while failing is set, e.g. during a storage outage
+type failingAuditRepository struct {
+	testAuditRepository
+	failing string
+}
+
+func (repo *failingAuditRepository) Append(entry AuditEntry) error {
+	if entry.OrganizationID == repo.failing {
+		return errors.New("storage unavailable")
+	}
+	return repo.testAuditRepository.Append(entry)
+}
+
+func TestAuditLogChainsEntries(t *testing.T) {
+	repo := testAuditRepository{entries: make(map[string][]AuditEntry)}
+	log := NewAuditLog(&repo, SystemClock{})
+
+	for _, action := range []AuditAction{AuditDeviceCreated, AuditDeviceSuspended, AuditDeviceResumed} {
+		if err := log.Record(testOrganizationID, testActor, action, "device", nil, nil); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := log.Record("other", testActor, AuditDeviceCreated, "device", nil, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	entries := log.Entries(testOrganizationID, AuditFilter{})
+	if len(entries) != 3 {
+		t.Fatalf("Entries() returned %d entries, want 3", len(entries))
+	}
+	if entries[0].PreviousHash != "" || entries[0].Sequence != 1 {
+		t.Errorf("first entry = %+v, want sequence 1 without previous hash", entries[0])
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].PreviousHash != entries[i-1].Hash {
+			t.Errorf("entry %d doesn't link to the previous entry", entries[i].Sequence)
+		}
+	}
+	if others := log.Entries("other", AuditFilter{}); len(others) != 1 || others[0].Sequence != 1 {
+		t.Errorf("organizations must have independent chains, got %+v", others)
+	}
+}
+
+func TestAuditLogVerifyDetectsTampering(t *testing.T) {
+	repo := testAuditRepository{entries: make(map[string][]AuditEntry)}
+	log := NewAuditLog(&repo, SystemClock{})
+	for i := 0; i < 3; i++ {
+		if err := log.Record(testOrganizationID, testActor, AuditDeviceUpdated, "device", nil, map[string]int{"version": i}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	verification, err := log.Verify(testOrganizationID)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !verification.Valid || verification.Entries != 3 {
+		t.Errorf("Verify() = %+v, want a valid chain of 3 entries", verification)
+	}
+
+	repo.entries[testOrganizationID][1].After = json.RawMessage(`{"version":7}`)
+	verification, err = log.Verify(testOrganizationID)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if verification.Valid || verification.BrokenAt == nil || *verification.BrokenAt != 2 {
+		t.Errorf("Verify() = %+v, want chain broken at entry 2", verification)
+	}
+}
+
+func TestAuditLogRetriesChainConflicts(t *testing.T) {
+	repo := conflictingAuditRepository{
+		testAuditRepository: testAuditRepository{entries: make(map[string][]AuditEntry)},
+		conflicts:           2,
+	}
+	log := NewAuditLog(&repo, SystemClock{})
+
+	if err := log.Record(testOrganizationID, testActor, AuditDeviceCreated, "device", nil, nil); err != nil {
+		t.Errorf("Record() error = %v, want retries to succeed", err)
+	}
+}
+
+func TestAuditLogEntriesFilter(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	log := NewAuditLog(&testAuditRepository{entries: make(map[string][]AuditEntry)}, fixedClock{now: now})
+	if err := log.Record(testOrganizationID, "alice", AuditDeviceCreated, "device-1", nil, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := log.Record(testOrganizationID, "bob", AuditDeviceSuspended, "device-2", nil, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   int
+	}{
+		{"all", AuditFilter{}, 2},
+		{"actor", AuditFilter{Actor: "alice"}, 1},
+		{"action", AuditFilter{Action: AuditDeviceSuspended}, 1},
+		{"target", AuditFilter{Target: "device-3"}, 0},
+		{"since", AuditFilter{Since: now.Add(time.Second)}, 0},
+		{"until", AuditFilter{Until: now.Add(time.Second)}, 2},
+	}
+	for _, test := range tests {
+		if got := len(log.Entries(testOrganizationID, test.filter)); got != test.want {
+			t.Errorf("%s: Entries() returned %d entries, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUpdateSignatureDeviceRecordsAudit(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	log := newTestAuditLog()
+	service := NewDeviceService(&repo, newTestIdempotencyRepository(), log, DefaultKeyPolicy, rand.Reader, SystemClock{})
+	created, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "old")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	label := "new"
+	if _, err = service.UpdateSignatureDevice(context.Background(), testOrganizationID, testActor, created.UUID, SignatureDeviceUpdate{
+		Version: created.Version,
+		Label:   &label,
+	}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	entries := log.Entries(testOrganizationID, AuditFilter{Target: created.UUID})
+	if len(entries) != 2 || entries[0].Action != AuditDeviceCreated || entries[1].Action != AuditDeviceUpdated {
+		t.Fatalf("Entries() = %+v, want created and updated entries", entries)
+	}
+	var before, after SignatureDevice
+	if err = json.Unmarshal(entries[1].Before, &before); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = json.Unmarshal(entries[1].After, &after); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if before.Label != "old" || after.Label != "new" || entries[1].Actor != testActor {
+		t.Errorf("update entry recorded %q -> %q by %q", before.Label, after.Label, entries[1].Actor)
+	}
+}
+
+func TestAuditLogRetriesFailedAppends(t *testing.T) {
+	repo := failingAuditRepository{testAuditRepository: testAuditRepository{entries: make(map[string][]AuditEntry)}}
+	log := NewAuditLog(&repo, SystemClock{})
+
+	repo.failing = testOrganizationID
+	for _, action := range []AuditAction{AuditDeviceCreated, AuditDeviceSuspended} {
+		if err := log.Record(testOrganizationID, testActor, action, "device", nil, nil); err != nil {
+			t.Fatalf("Record() should succeed while the repository fails, got %v", err)
+		}
+	}
+	if err := log.Record("other", testActor, AuditDeviceCreated, "device", nil, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(log.Entries("other", AuditFilter{})) != 1 {
+		t.Errorf("entries of other organizations shouldn't wait for the failing one")
+	}
+	if err := log.Retry(); err == nil {
+		t.Errorf("Retry() should report the failing repository")
+	}
+
+	repo.failing = ""
+	if err := log.Retry(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	entries := log.Entries(testOrganizationID, AuditFilter{})
+	if len(entries) != 2 || entries[0].Action != AuditDeviceCreated || entries[1].Action != AuditDeviceSuspended {
+		t.Fatalf("Entries() = %+v, want the pending entries in record order", entries)
+	}
+	if verification, err := log.Verify(testOrganizationID); err != nil || !verification.Valid {
+		t.Errorf("Verify() = %+v, %v, want a valid chain", verification, err)
+	}
+}
+
+func TestGrantDevicesSucceedsWhileAuditFails(t *testing.T) {
+	repo := failingAuditRepository{testAuditRepository: testAuditRepository{entries: make(map[string][]AuditEntry)}}
+	log := NewAuditLog(&repo, SystemClock{})
+	apiKeys := testAPIKeysRepository{storage: make(map[string]APIKey)}
+	service := NewAPIKeyService(&apiKeys, log, rand.Reader, SystemClock{})
+	created, err := service.CreateAPIKey(testOrganizationID, testActor, "till", []string{"signer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	repo.failing = testOrganizationID
+	if _, err = service.GrantDevices(testOrganizationID, testActor, created.ID, []string{AllDevices}); err != nil {
+		t.Fatalf("GrantDevices() should succeed once the API key is stored, got %v", err)
+	}
+	if stored, _ := apiKeys.Get(testOrganizationID, created.ID); !stored.CanSignWith("8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1") {
+		t.Errorf("grants should be stored")
+	}
+
+	repo.failing = ""
+	if err = log.Retry(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if entries := log.Entries(testOrganizationID, AuditFilter{Action: AuditAPIKeyDevicesGranted}); len(entries) != 1 {
+		t.Errorf("Entries() = %+v, want the retried grant entry", entries)
+	}
+}
@@ -1,112 +1,378 @@
 package domain
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
 	"strings"
+	"time"
 )
 
+// maxSignAttempts bounds retries when concurrent requests sign with the same device
+const maxSignAttempts = 10
+
 type SignatureDevice struct {
-	UUID             string    `json:"uuid"`
-	Label            string    `json:"label"`
-	PrivateKey       []byte    `json:"-"`
-	PublicKey        []byte    `json:"public_key"`
-	Algorithm        Algorithm `json:"algorithm"`
-	SignatureCounter int       `json:"signature_counter"`
-	LastSignature    []byte    `json:"-"`
+	UUID             string            `json:"uuid"`
+	OrganizationID   string            `json:"organization_id"`
+	Label            string            `json:"label"`
+	PrivateKey       []byte            `json:"-"`
+	PublicKey        []byte            `json:"public_key"`
+	Algorithm        Algorithm         `json:"algorithm"`
+	SignatureCounter int               `json:"signature_counter"`
+	LastSignature    []byte            `json:"-"`
+	CreatedAt        time.Time         `json:"created_at"`
+	Status           Status            `json:"status"`
+	StatusChangedAt  time.Time         `json:"status_changed_at"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Version          int               `json:"version"`
+}
+
+// LogValue keeps the private key and the last signature out of logs
+func (device SignatureDevice) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("uuid", device.UUID),
+		slog.String("organization_id", device.OrganizationID),
+		slog.String("algorithm", device.Algorithm.String()),
+		slog.String("status", device.Status.String()),
+		slog.Int("signature_counter", device.SignatureCounter),
+		slog.Int("version", device.Version),
+	)
 }
 
+// DevicesRepository stores signature devices partitioned by organization.
+// A device is only visible through the organization it belongs to.
 type DevicesRepository interface {
-	Get(uuid string) (SignatureDevice, bool)
-	GetAll() []SignatureDevice
-	Create(device SignatureDevice) error
-	Update(device SignatureDevice) error
-	IncrementCounter(uuid string) error
+	Get(ctx context.Context, organizationID string, uuid string) (SignatureDevice, bool)
+	// List returns up to query.Limit devices matching the query in the order of the query
+	List(ctx context.Context, organizationID string, query DeviceQuery) []SignatureDevice
+	// Create, Update and IncrementCounter append events to the outbox atomically with the change.
+	Create(ctx context.Context, device SignatureDevice, events ...Event) error
+	// Update stores device if its Version matches the stored one, otherwise it fails with ErrVersionConflict.
+	// Every successful write increments the stored Version.
+	Update(ctx context.Context, device SignatureDevice, events ...Event) error
+	// IncrementCounter stores the LastSignature of device and increments its signature counter in one write.
+	// Like Update it fails with ErrVersionConflict unless the Version of device matches the stored one.
+	IncrementCounter(ctx context.Context, device SignatureDevice, events ...Event) error
 }
 
+var (
+	// ErrDeviceExists is returned by DevicesRepository.Create when the UUID is already taken.
+	ErrDeviceExists = errors.New("signature device already exists")
+	// ErrDeviceConflict is returned when a device is created again with different parameters.
+	ErrDeviceConflict = errors.New("signature device conflicts with an existing one")
+)
+
 type CreateSignatureDeviceResponse struct {
 	UUID             string    `json:"uuid"`
 	Label            string    `json:"label"`
 	PublicKey        []byte    `json:"public_key"`
 	Algorithm        Algorithm `json:"algorithm"`
 	SignatureCounter int       `json:"signature_counter"`
+	CreatedAt        time.Time `json:"created_at"`
+	Status           Status    `json:"status"`
+	Version          int       `json:"version"`
 }
 
 type SignatureResponse struct {
-	Signature  string `json:"signature"`
-	SignedData string `json:"signed_data"`
+	Signature        string `json:"signature"`
+	SignedData       string `json:"signed_data"`
+	SignatureCounter int    `json:"signature_counter"`
 }
 
-// CreateSignatureDevice creates SignatureDevice in store and returns serializable response
-func CreateSignatureDevice(
+// DeviceService runs signature device use cases against a DevicesRepository.
+// Entropy and time are injected, so tests can reproduce device ids, event ids and timestamps.
+// Keys differ nonetheless, crypto/ecdsa and crypto/rsa don't read the entropy source deterministically.
+type DeviceService struct {
+	repo        DevicesRepository
+	idempotency IdempotencyRepository
+	audit       *AuditLog
+	keyPolicy   KeyPolicy
+	random      io.Reader
+	clock       Clock
+	metrics     Metrics
+	tracer      trace.Tracer
+	// selfTestKeys are used by CheckHealth only
+	selfTestKeys selfTestKeys
+}
+
+// NewDeviceService is a factory to instantiate a new DeviceService.
+func NewDeviceService(
+	repo DevicesRepository,
+	idempotency IdempotencyRepository,
+	audit *AuditLog,
+	keyPolicy KeyPolicy,
+	random io.Reader,
+	clock Clock,
+) *DeviceService {
+	return &DeviceService{
+		repo:        repo,
+		idempotency: idempotency,
+		audit:       audit,
+		keyPolicy:   keyPolicy,
+		random:      random,
+		clock:       clock,
+		metrics:     NopMetrics{},
+		tracer:      nopTracer,
+	}
+}
+
+// GetSignatureDevice returns stored SignatureDevice of the organization by id
+func (service *DeviceService) GetSignatureDevice(ctx context.Context, organizationID string, id string) (SignatureDevice, bool) {
+	return service.repo.Get(ctx, organizationID, id)
+}
+
+// CreateSignatureDevice creates SignatureDevice in store on behalf of actor and returns serializable response
+func (service *DeviceService) CreateSignatureDevice(
+	ctx context.Context,
+	organizationID string,
+	actor string,
 	algorithm Algorithm,
 	label string,
-	repo DevicesRepository,
 ) (CreateSignatureDeviceResponse, error) {
-	keyPairInBytes, err := algorithm.GenerateKeyPairsInBytes()
+	// the id is drawn first, key generation consumes a non-deterministic amount of entropy
+	generatedUUID, err := uuid.NewRandomFromReader(service.random)
 	if err != nil {
 		return CreateSignatureDeviceResponse{}, err
 	}
 
-	id := uuid.NewString()
+	signatureDevice, err := service.createSignatureDevice(ctx, organizationID, actor, generatedUUID.String(), algorithm, label)
+	if err != nil {
+		return CreateSignatureDeviceResponse{}, err
+	}
+	return newCreateSignatureDeviceResponse(signatureDevice), nil
+}
+
+// CreateSignatureDeviceWithID creates SignatureDevice under the client chosen id.
+// Repeating the call with the same parameters returns the existing device and created == false,
+// different parameters for an existing id fail with ErrDeviceConflict.
+func (service *DeviceService) CreateSignatureDeviceWithID(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	id string,
+	algorithm Algorithm,
+	label string,
+) (response CreateSignatureDeviceResponse, created bool, err error) {
+	parsedUUID, err := uuid.Parse(id)
+	if err != nil {
+		return CreateSignatureDeviceResponse{}, false, ValidationError{"uuid", "must be a valid UUID"}
+	}
+	id = parsedUUID.String()
+
+	if existing, found := service.repo.Get(ctx, organizationID, id); found {
+		return matchExistingSignatureDevice(existing, algorithm, label)
+	}
+
+	signatureDevice, err := service.createSignatureDevice(ctx, organizationID, actor, id, algorithm, label)
+	if errors.Is(err, ErrDeviceExists) {
+		// a concurrent request created the device in the meantime
+		if existing, found := service.repo.Get(ctx, organizationID, id); found {
+			return matchExistingSignatureDevice(existing, algorithm, label)
+		}
+	}
+	if err != nil {
+		return CreateSignatureDeviceResponse{}, false, err
+	}
+	return newCreateSignatureDeviceResponse(signatureDevice), true, nil
+}
+
+func (service *DeviceService) createSignatureDevice(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	id string,
+	algorithm Algorithm,
+	label string,
+) (SignatureDevice, error) {
+	start := time.Now()
+	keyPairInBytes, err := service.keyPolicy.GenerateKeyPairInBytes(algorithm, service.random)
+	if err != nil {
+		return SignatureDevice{}, err
+	}
+	service.metrics.ObserveKeyGeneration(algorithm, time.Since(start))
+
+	now := service.clock.Now()
 	lastSignature := base64.URLEncoding.EncodeToString([]byte(id))
 	signatureDevice := SignatureDevice{
 		UUID:             id,
+		OrganizationID:   organizationID,
 		Label:            label,
 		PrivateKey:       keyPairInBytes.PrivateKey,
 		PublicKey:        keyPairInBytes.PublicKey,
 		Algorithm:        algorithm,
 		SignatureCounter: 0,
 		LastSignature:    []byte(lastSignature),
+		CreatedAt:        now,
+		Status:           DeviceActive,
+		StatusChangedAt:  now,
 	}
-	err = repo.Create(signatureDevice)
+	event, err := service.newEvent(organizationID, EventDeviceCreated, id, newCreateSignatureDeviceResponse(signatureDevice))
 	if err != nil {
-		return CreateSignatureDeviceResponse{}, err
+		return SignatureDevice{}, err
+	}
+	err = service.repositoryError(ctx, "create", service.repo.Create(ctx, signatureDevice, event))
+	if err != nil {
+		return SignatureDevice{}, err
+	}
+	err = service.audit.Record(organizationID, actor, AuditDeviceCreated, id, nil, signatureDevice)
+	if err != nil {
+		return SignatureDevice{}, err
 	}
+	slog.InfoContext(ctx, "Created signature device", "device", signatureDevice, "actor", actor)
+	return signatureDevice, nil
+}
 
+func matchExistingSignatureDevice(
+	existing SignatureDevice,
+	algorithm Algorithm,
+	label string,
+) (CreateSignatureDeviceResponse, bool, error) {
+	if existing.Algorithm != algorithm || existing.Label != label {
+		return CreateSignatureDeviceResponse{}, false, fmt.Errorf(
+			"signature device %q exists with different parameters: %w", existing.UUID, ErrDeviceConflict,
+		)
+	}
+	return newCreateSignatureDeviceResponse(existing), false, nil
+}
+
+func newCreateSignatureDeviceResponse(signatureDevice SignatureDevice) CreateSignatureDeviceResponse {
 	return CreateSignatureDeviceResponse{
 		UUID:             signatureDevice.UUID,
 		Label:            signatureDevice.Label,
 		PublicKey:        signatureDevice.PublicKey,
 		Algorithm:        signatureDevice.Algorithm,
 		SignatureCounter: signatureDevice.SignatureCounter,
-	}, nil
+		CreatedAt:        signatureDevice.CreatedAt,
+		Status:           signatureDevice.Status,
+		Version:          signatureDevice.Version,
+	}
 }
 
 // SignTransaction signs data with found devices, updates device's data and returns signed data
-func SignTransaction(id string, data string, repo DevicesRepository) (SignatureResponse, error) {
-	device, found := repo.Get(id)
-	if !found {
-		return SignatureResponse{}, fmt.Errorf("could not found signature device with id %q", id)
+func (service *DeviceService) SignTransaction(
+	ctx context.Context,
+	organizationID string,
+	id string,
+	data string,
+) (SignatureResponse, error) {
+	ctx, span := service.tracer.Start(ctx, "DeviceService.SignTransaction", trace.WithAttributes(
+		attribute.String(attributeOrganizationID, organizationID),
+		attribute.String(attributeDeviceID, id),
+	))
+	response, err := service.signTransaction(ctx, organizationID, id, data)
+	endSpan(span, err)
+	return response, err
+}
+
+// signTransaction retries signing on concurrent modifications of the device, each retry signs the newly
+// stored counter and last signature, so concurrent requests of one device are chained instead of rejected
+func (service *DeviceService) signTransaction(
+	ctx context.Context,
+	organizationID string,
+	id string,
+	data string,
+) (SignatureResponse, error) {
+	var response SignatureResponse
+	var err error
+	for attempt := 0; attempt < maxSignAttempts; attempt++ {
+		response, err = service.signTransactionOnce(ctx, organizationID, id, data)
+		if !errors.Is(err, ErrVersionConflict) {
+			return response, err
+		}
+		slog.DebugContext(ctx, "Signature device was modified while signing, retrying", "uuid", id, "attempt", attempt+1)
 	}
+	return SignatureResponse{}, err
+}
 
-	signer, err := device.Algorithm.Signer(device.PrivateKey)
-	if err != nil {
+func (service *DeviceService) signTransactionOnce(
+	ctx context.Context,
+	organizationID string,
+	id string,
+	data string,
+) (SignatureResponse, error) {
+	device, found := service.repo.Get(ctx, organizationID, id)
+	if !found {
+		return SignatureResponse{}, NotFoundError{"signature device", id}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String(attributeAlgorithm, device.Algorithm.String()),
+		attribute.Int(attributeSignatureCounter, device.SignatureCounter),
+	)
+	if err := device.Status.CanSign(); err != nil {
 		return SignatureResponse{}, err
 	}
 
+	start := time.Now()
 	securedDataToBeSigned := buildSecuredDataToBeSigned(device.SignatureCounter, data, device.LastSignature)
-	signedData, err := signer.Sign([]byte(securedDataToBeSigned))
+	signedData, err := service.sign(ctx, device, []byte(securedDataToBeSigned))
 	if err != nil {
 		return SignatureResponse{}, err
 	}
+	service.metrics.ObserveSign(device.Algorithm, time.Since(start))
 
 	device.LastSignature = signedData
-	err = repo.Update(device)
+	signedDataBase64 := base64.URLEncoding.EncodeToString(signedData)
+	event, err := service.newEvent(organizationID, EventSignatureCreated, device.UUID, SignatureCreatedData{
+		DeviceID:         device.UUID,
+		Signature:        signedDataBase64,
+		SignedData:       string(signedData),
+		SignatureCounter: device.SignatureCounter,
+	})
 	if err != nil {
 		return SignatureResponse{}, err
 	}
-	// increment as separate action, so we make sure it has the latest value
-	err = repo.IncrementCounter(device.UUID)
+	// the signature and the counter it used are stored together, concurrent signers conflict on the version
+	err = service.repositoryError(ctx, "increment_counter", service.repo.IncrementCounter(ctx, device, event))
 	if err != nil {
 		return SignatureResponse{}, err
 	}
+	slog.DebugContext(ctx, "Signed transaction", "device", device)
 
-	signedDataBase64 := base64.URLEncoding.EncodeToString(signedData)
 	return SignatureResponse{
-		Signature:  signedDataBase64,
-		SignedData: string(signedData),
+		Signature:        signedDataBase64,
+		SignedData:       string(signedData),
+		SignatureCounter: device.SignatureCounter,
+	}, nil
+}
+
+// updateWithEvent stores device and raises eventType carrying a snapshot of the stored state
+func (service *DeviceService) updateWithEvent(ctx context.Context, device SignatureDevice, eventType EventType) (SignatureDevice, error) {
+	stored := device
+	stored.Version++
+	event, err := service.newEvent(device.OrganizationID, eventType, device.UUID, newDeviceChangedData(stored))
+	if err != nil {
+		return SignatureDevice{}, err
+	}
+	if err = service.repositoryError(ctx, "update", service.repo.Update(ctx, device, event)); err != nil {
+		return SignatureDevice{}, err
+	}
+	return stored, nil
+}
+
+func (service *DeviceService) newEvent(
+	organizationID string,
+	eventType EventType,
+	deviceID string,
+	data interface{},
+) (Event, error) {
+	id, err := uuid.NewRandomFromReader(service.random)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:             id.String(),
+		Type:           eventType,
+		OrganizationID: organizationID,
+		DeviceID:       deviceID,
+		OccurredAt:     service.clock.Now(),
+		Data:           data,
 	}, nil
 }
 
@@ -1,38 +1,125 @@
 package domain
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	mathrand "math/rand"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
+)
+
+const (
+	testOrganizationID = "organization"
+	testActor          = "admin"
 )
 
 type testRepository struct {
 	storage map[string]SignatureDevice
+	events  []Event
 }
 
-func (repo *testRepository) Get(uuid string) (SignatureDevice, bool) {
-	return repo.storage[uuid], true
+func (repo *testRepository) Get(_ context.Context, organizationID string, uuid string) (SignatureDevice, bool) {
+	device, found := repo.storage[uuid]
+	if device.OrganizationID != organizationID {
+		return SignatureDevice{}, false
+	}
+	return device, found
 }
-func (repo *testRepository) GetAll() []SignatureDevice {
-	return nil
+func (repo *testRepository) List(_ context.Context, organizationID string, query DeviceQuery) []SignatureDevice {
+	devices := make([]SignatureDevice, 0)
+	for _, device := range repo.storage {
+		if device.OrganizationID == organizationID && query.Matches(device) && query.IsAfterCursor(device) {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return query.Before(devices[i], devices[j])
+	})
+	if len(devices) > query.Limit {
+		devices = devices[:query.Limit]
+	}
+	return devices
 }
-func (repo *testRepository) Create(device SignatureDevice) error {
+func (repo *testRepository) Create(_ context.Context, device SignatureDevice, events ...Event) error {
+	if _, found := repo.storage[device.UUID]; found {
+		return ErrDeviceExists
+	}
 	repo.storage[device.UUID] = device
+	repo.events = append(repo.events, events...)
 	return nil
 }
-func (repo *testRepository) Update(device SignatureDevice) error {
+func (repo *testRepository) Update(_ context.Context, device SignatureDevice, events ...Event) error {
+	if repo.storage[device.UUID].Version != device.Version {
+		return ErrVersionConflict
+	}
+	device.Version++
 	repo.storage[device.UUID] = device
+	repo.events = append(repo.events, events...)
 	return nil
 }
-func (repo *testRepository) IncrementCounter(uuid string) error {
-	device := repo.storage[uuid]
+func (repo *testRepository) IncrementCounter(_ context.Context, signed SignatureDevice, events ...Event) error {
+	device := repo.storage[signed.UUID]
+	if device.Version != signed.Version {
+		return ErrVersionConflict
+	}
+	device.LastSignature = signed.LastSignature
 	device.SignatureCounter += 1
-	repo.storage[uuid] = device
+	device.Version++
+	repo.storage[signed.UUID] = device
+	repo.events = append(repo.events, events...)
+	return nil
+}
+
+type testIdempotencyRepository struct {
+	storage map[string]IdempotencyRecord
+	mutex   sync.Mutex
+}
+
+func newTestIdempotencyRepository() *testIdempotencyRepository {
+	return &testIdempotencyRepository{storage: make(map[string]IdempotencyRecord)}
+}
+
+func (repo *testIdempotencyRepository) Lock(string) func() {
+	repo.mutex.Lock()
+	return repo.mutex.Unlock
+}
+func (repo *testIdempotencyRepository) Get(key string) (IdempotencyRecord, bool) {
+	record, found := repo.storage[key]
+	return record, found
+}
+func (repo *testIdempotencyRepository) Save(record IdempotencyRecord) error {
+	repo.storage[record.Key] = record
 	return nil
 }
+func (repo *testIdempotencyRepository) DeleteExpired(now time.Time) {
+	for key, record := range repo.storage {
+		if !now.Before(record.ExpiresAt) {
+			delete(repo.storage, key)
+		}
+	}
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (clock fixedClock) Now() time.Time {
+	return clock.now
+}
+
+func newTestService(repo DevicesRepository) *DeviceService {
+	return NewDeviceService(repo, newTestIdempotencyRepository(), newTestAuditLog(), DefaultKeyPolicy, rand.Reader, SystemClock{})
+}
 
 func TestCreateSignatureDeviceECC(t *testing.T) {
 	repo := testRepository{storage: make(map[string]SignatureDevice)}
-	device, err := CreateSignatureDevice(Algorithm(1), "", &repo)
+	device, err := newTestService(&repo).CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -44,9 +131,34 @@ func TestCreateSignatureDeviceECC(t *testing.T) {
 	}
 }
 
+func TestCreateSignatureDeviceFollowsKeyPolicy(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	policy := KeyPolicy{Algorithms: []Algorithm{RSA}, RSAKeyBits: 1024}
+	service := NewDeviceService(&repo, newTestIdempotencyRepository(), newTestAuditLog(), policy, rand.Reader, SystemClock{})
+
+	_, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, ECC, "")
+	var invalidAlgorithm InvalidAlgorithmError
+	if !errors.As(err, &invalidAlgorithm) || invalidAlgorithm.Reason == "" {
+		t.Errorf("CreateSignatureDevice(ECC) error = %v, want the key policy to forbid ECC", err)
+	}
+
+	device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, RSA, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	block, _ := pem.Decode(device.PublicKey)
+	publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if publicKey.N.BitLen() != 1024 {
+		t.Errorf("RSA key has %d bits, want 1024", publicKey.N.BitLen())
+	}
+}
+
 func TestCreateSignatureDeviceRSA(t *testing.T) {
 	repo := testRepository{storage: make(map[string]SignatureDevice)}
-	device, err := CreateSignatureDevice(Algorithm(2), "", &repo)
+	device, err := newTestService(&repo).CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(2), "")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -60,33 +172,72 @@ func TestCreateSignatureDeviceRSA(t *testing.T) {
 
 func TestCreateSignatureDeviceInvalid(t *testing.T) {
 	repo := testRepository{storage: make(map[string]SignatureDevice)}
-	_, err := CreateSignatureDevice(Algorithm(0), "", &repo)
+	_, err := newTestService(&repo).CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(0), "")
 	if err == nil {
 		t.Errorf("can't create signature device with invalid algorithm")
 	}
 }
 
+func TestCreateSignatureDeviceWithIDIdempotent(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := newTestService(&repo)
+	id := "8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1"
+
+	first, created, err := service.CreateSignatureDeviceWithID(context.Background(), testOrganizationID, testActor, id, Algorithm(1), "till")
+	if err != nil || !created {
+		t.Fatalf("first call should create the device, err = %v", err)
+	}
+	if first.UUID != id {
+		t.Errorf("UUID = %v, want %v", first.UUID, id)
+	}
+
+	second, created, err := service.CreateSignatureDeviceWithID(context.Background(), testOrganizationID, testActor, id, Algorithm(1), "till")
+	if err != nil || created {
+		t.Fatalf("repeated call should return the existing device, err = %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("repeated call returned a different device")
+	}
+}
+
+func TestCreateSignatureDeviceWithIDConflict(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := newTestService(&repo)
+	id := "8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1"
+
+	if _, _, err := service.CreateSignatureDeviceWithID(context.Background(), testOrganizationID, testActor, id, Algorithm(1), "till"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, _, err := service.CreateSignatureDeviceWithID(context.Background(), testOrganizationID, testActor, id, Algorithm(2), "till"); !errors.Is(err, ErrDeviceConflict) {
+		t.Errorf("CreateSignatureDeviceWithID() error = %v, want %v", err, ErrDeviceConflict)
+	}
+	if _, _, err := service.CreateSignatureDeviceWithID(context.Background(), testOrganizationID, testActor, "not-a-uuid", Algorithm(1), ""); err == nil {
+		t.Errorf("invalid UUID should be rejected")
+	}
+}
+
 func TestSignTransactionRSA(t *testing.T) {
-	keyPairInBytes, err := Algorithm(2).GenerateKeyPairsInBytes()
+	keyPairInBytes, err := Algorithm(2).GenerateKeyPairsInBytes(rand.Reader)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
 	device := SignatureDevice{
-		UUID:       "uuid",
-		Algorithm:  Algorithm(2), //RSA
-		PrivateKey: keyPairInBytes.PrivateKey,
-		PublicKey:  keyPairInBytes.PublicKey,
+		UUID:           "uuid",
+		OrganizationID: testOrganizationID,
+		Algorithm:      Algorithm(2), //RSA
+		PrivateKey:     keyPairInBytes.PrivateKey,
+		PublicKey:      keyPairInBytes.PublicKey,
 	}
 	repo := testRepository{storage: make(map[string]SignatureDevice)}
-	err = repo.Create(device)
+	err = repo.Create(context.Background(), device)
 
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
 	dataToSign := "message"
-	signedResponse, err := SignTransaction(device.UUID, dataToSign, &repo)
+	signedResponse, err := newTestService(&repo).SignTransaction(context.Background(), testOrganizationID, device.UUID, dataToSign)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -102,26 +253,27 @@ func TestSignTransactionRSA(t *testing.T) {
 }
 
 func TestSignTransactionECC(t *testing.T) {
-	keyPairInBytes, err := Algorithm(1).GenerateKeyPairsInBytes()
+	keyPairInBytes, err := Algorithm(1).GenerateKeyPairsInBytes(rand.Reader)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
 	device := SignatureDevice{
-		UUID:       "uuid",
-		Algorithm:  Algorithm(1), //RSA
-		PrivateKey: keyPairInBytes.PrivateKey,
-		PublicKey:  keyPairInBytes.PublicKey,
+		UUID:           "uuid",
+		OrganizationID: testOrganizationID,
+		Algorithm:      Algorithm(1), //RSA
+		PrivateKey:     keyPairInBytes.PrivateKey,
+		PublicKey:      keyPairInBytes.PublicKey,
 	}
 	repo := testRepository{storage: make(map[string]SignatureDevice)}
-	err = repo.Create(device)
+	err = repo.Create(context.Background(), device)
 
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
 	dataToSign := "message"
-	signedResponse, err := SignTransaction(device.UUID, dataToSign, &repo)
+	signedResponse, err := newTestService(&repo).SignTransaction(context.Background(), testOrganizationID, device.UUID, dataToSign)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -135,3 +287,150 @@ func TestSignTransactionECC(t *testing.T) {
 		t.Errorf("device wasn't updated")
 	}
 }
+
+// interleavingRepository runs interleave the first times a signature is stored, before storing it
+// or right after it unless before is set, as if concurrent requests signed while this one did
+type interleavingRepository struct {
+	*testRepository
+	interleave func()
+	remaining  int
+	after      bool
+}
+
+func (repo *interleavingRepository) IncrementCounter(ctx context.Context, device SignatureDevice, events ...Event) error {
+	if repo.remaining > 0 && !repo.after {
+		repo.remaining--
+		repo.interleave()
+	}
+	err := repo.testRepository.IncrementCounter(ctx, device, events...)
+	if repo.remaining > 0 && repo.after {
+		repo.remaining--
+		repo.interleave()
+	}
+	return err
+}
+
+func TestSignTransactionRetriesConcurrentModifications(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	created, err := newTestService(&repo).CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	other := newTestService(&repo)
+	interleaving := interleavingRepository{testRepository: &repo, remaining: 2}
+	interleaving.interleave = func() {
+		if _, err := other.SignTransaction(context.Background(), testOrganizationID, created.UUID, "concurrent"); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	response, err := newTestService(&interleaving).SignTransaction(context.Background(), testOrganizationID, created.UUID, "message")
+	if err != nil {
+		t.Fatalf("SignTransaction() = %v, want the conflict to be retried", err)
+	}
+	if response.SignatureCounter != 2 || repo.storage[created.UUID].SignatureCounter != 3 {
+		t.Errorf("signed with counter %d, stored counter %d, want 2 and 3",
+			response.SignatureCounter, repo.storage[created.UUID].SignatureCounter)
+	}
+}
+
+func TestSignTransactionChainsSignaturesOfInterleavedSigners(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	created, err := newTestService(&repo).CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var second SignatureResponse
+	other := newTestService(&repo)
+	interleaving := interleavingRepository{testRepository: &repo, remaining: 1, after: true}
+	interleaving.interleave = func() {
+		if second, err = other.SignTransaction(context.Background(), testOrganizationID, created.UUID, "concurrent"); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	first, err := newTestService(&interleaving).SignTransaction(context.Background(), testOrganizationID, created.UUID, "message")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if first.SignatureCounter != 0 || second.SignatureCounter != 1 || repo.storage[created.UUID].SignatureCounter != 2 {
+		t.Errorf("signed with counters %d and %d, stored counter %d, want 0, 1 and 2",
+			first.SignatureCounter, second.SignatureCounter, repo.storage[created.UUID].SignatureCounter)
+	}
+	if string(repo.storage[created.UUID].LastSignature) != second.SignedData {
+		t.Errorf("the last signature isn't the one of the latest counter")
+	}
+}
+
+func TestSignTransactionGivesUpOnPersistentConflicts(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	created, err := newTestService(&repo).CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	interleaving := interleavingRepository{testRepository: &repo, remaining: maxSignAttempts}
+	interleaving.interleave = func() {
+		device := repo.storage[created.UUID]
+		device.Version++
+		repo.storage[created.UUID] = device
+	}
+
+	if _, err = newTestService(&interleaving).SignTransaction(context.Background(), testOrganizationID, created.UUID, "message"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("SignTransaction() = %v, want %v", err, ErrVersionConflict)
+	}
+}
+
+func TestCreateSignatureDeviceWithFailingEntropy(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := NewDeviceService(&repo, newTestIdempotencyRepository(), newTestAuditLog(), DefaultKeyPolicy, failingReader{}, SystemClock{})
+
+	_, _, err := service.CreateSignatureDeviceWithID(context.Background(), testOrganizationID, testActor, "1d8e2a53-5c43-4e34-9a51-6c3d07c3f1a2", ECC, "")
+	if err == nil {
+		t.Errorf("CreateSignatureDeviceWithID() succeeded without entropy")
+	}
+	if len(repo.storage) != 0 {
+		t.Errorf("a device without keys was stored")
+	}
+}
+
+// keys aren't compared, the standard library doesn't generate them deterministically from the entropy source
+func TestCreateSignatureDeviceReproducible(t *testing.T) {
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	createDevice := func() CreateSignatureDeviceResponse {
+		repo := testRepository{storage: make(map[string]SignatureDevice)}
+		service := NewDeviceService(&repo, newTestIdempotencyRepository(), newTestAuditLog(), DefaultKeyPolicy, mathrand.New(mathrand.NewSource(42)), fixedClock{now: now})
+		device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return device
+	}
+
+	first := createDevice()
+	second := createDevice()
+	if first.UUID != second.UUID {
+		t.Errorf("device id is not reproducible with the same entropy source")
+	}
+	if !first.CreatedAt.Equal(now) {
+		t.Errorf("CreatedAt = %v, want %v", first.CreatedAt, now)
+	}
+}
+
+func TestSignatureDeviceOrganizationIsolation(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := newTestService(&repo)
+	device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if _, found := service.GetSignatureDevice(context.Background(), "other", device.UUID); found {
+		t.Errorf("device is visible to another organization")
+	}
+	if _, err = service.SignTransaction(context.Background(), "other", device.UUID, "message"); err == nil {
+		t.Errorf("another organization signed with the device")
+	}
+	if _, err = service.SuspendSignatureDevice(context.Background(), "other", testActor, device.UUID); err == nil {
+		t.Errorf("another organization suspended the device")
+	}
+}
@@ -0,0 +1,50 @@
+package domain
+
+import "fmt"
+
+// ValidationError describes input rejected by the domain rules.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (err ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Field, err.Message)
+}
+
+// NotFoundError is returned when a resource doesn't exist in the organization.
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+func (err NotFoundError) Error() string {
+	return fmt.Sprintf("could not found %s with id %q", err.Resource, err.ID)
+}
+
+// InvalidAlgorithmError is returned for algorithms the service can't generate keys or sign with.
+// Reason explains why a known algorithm can't be used, e.g. because the key policy forbids it.
+type InvalidAlgorithmError struct {
+	Algorithm string
+	Reason    string
+}
+
+func (err InvalidAlgorithmError) Error() string {
+	if err.Algorithm == "" {
+		return "invalid algorithm"
+	}
+	if err.Reason != "" {
+		return fmt.Sprintf("%q %s", err.Algorithm, err.Reason)
+	}
+	return fmt.Sprintf("%q is not a valid algorithm", err.Algorithm)
+}
+
+// StatusTransitionError is returned when the lifecycle doesn't allow moving a device to another status.
+type StatusTransitionError struct {
+	From Status
+	To   Status
+}
+
+func (err StatusTransitionError) Error() string {
+	return fmt.Sprintf("signature device can't change status from %q to %q", err.From, err.To)
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// EventType names a domain event clients can subscribe to.
+type EventType string
+
+const (
+	EventDeviceCreated        EventType = "device.created"
+	EventDeviceUpdated        EventType = "device.updated"
+	EventDeviceSuspended      EventType = "device.suspended"
+	EventDeviceResumed        EventType = "device.resumed"
+	EventDeviceDecommissioned EventType = "device.decommissioned"
+	EventSignatureCreated     EventType = "signature.created"
+)
+
+var eventTypes = []EventType{
+	EventDeviceCreated,
+	EventDeviceUpdated,
+	EventDeviceSuspended,
+	EventDeviceResumed,
+	EventDeviceDecommissioned,
+	EventSignatureCreated,
+}
+
+// Event is a notification about a change of a signature device.
+type Event struct {
+	ID             string      `json:"id"`
+	Type           EventType   `json:"type"`
+	OrganizationID string      `json:"organization_id"`
+	DeviceID       string      `json:"device_id"`
+	OccurredAt     time.Time   `json:"occurred_at"`
+	Data           interface{} `json:"data"`
+}
+
+// LogValue leaves out the data of the event, so signed transactions never reach the log
+func (event Event) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", event.ID),
+		slog.String("type", string(event.Type)),
+		slog.String("organization_id", event.OrganizationID),
+		slog.String("device_id", event.DeviceID),
+		slog.Time("occurred_at", event.OccurredAt),
+	)
+}
+
+// SignatureCreatedData is the payload of EventSignatureCreated
+type SignatureCreatedData struct {
+	DeviceID         string `json:"device_id"`
+	Signature        string `json:"signature"`
+	SignedData       string `json:"signed_data"`
+	SignatureCounter int    `json:"signature_counter"`
+}
+
+// DeviceChangedData is the payload of the device events after creation, a snapshot of the stored device
+// without its private key and last signature, which the outbox and the event history would otherwise keep
+type DeviceChangedData struct {
+	UUID             string            `json:"uuid"`
+	OrganizationID   string            `json:"organization_id"`
+	Label            string            `json:"label"`
+	PublicKey        []byte            `json:"public_key"`
+	Algorithm        Algorithm         `json:"algorithm"`
+	SignatureCounter int               `json:"signature_counter"`
+	CreatedAt        time.Time         `json:"created_at"`
+	Status           Status            `json:"status"`
+	StatusChangedAt  time.Time         `json:"status_changed_at"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Version          int               `json:"version"`
+}
+
+func newDeviceChangedData(device SignatureDevice) DeviceChangedData {
+	return DeviceChangedData{
+		UUID:             device.UUID,
+		OrganizationID:   device.OrganizationID,
+		Label:            device.Label,
+		PublicKey:        device.PublicKey,
+		Algorithm:        device.Algorithm,
+		SignatureCounter: device.SignatureCounter,
+		CreatedAt:        device.CreatedAt,
+		Status:           device.Status,
+		StatusChangedAt:  device.StatusChangedAt,
+		Metadata:         device.Metadata,
+		Tags:             device.Tags,
+		Version:          device.Version,
+	}
+}
+
+// EventSink receives events dispatched from the outbox.
+// Delivery is at least once, sinks and their consumers deduplicate by Event.ID.
+type EventSink interface {
+	// Name identifies the sink, its dispatch progress is tracked under this name
+	Name() string
+	Deliver(event Event) error
+}
+
+// ParseEventType from string
+func ParseEventType(s string) (EventType, error) {
+	for _, eventType := range eventTypes {
+		if string(eventType) == s {
+			return eventType, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a valid event type", s)
+}
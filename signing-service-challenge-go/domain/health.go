@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// HealthChecker is implemented by repositories whose backend can become unreachable.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// Components checked by DeviceService.CheckHealth
+const (
+	ComponentDevicesRepository = "devices-repository"
+	ComponentKeyStore          = "key-store"
+	ComponentSigner            = "signer"
+)
+
+// HealthCheck is the result of checking one component the service depends on.
+type HealthCheck struct {
+	Component string
+	// ComponentID tells checks of the same component apart, e.g. the algorithm of a signer
+	ComponentID string
+	// ComponentType is "datastore" or "component"
+	ComponentType string
+	Time          time.Time
+	Duration      time.Duration
+	// Err is nil if the component is healthy
+	Err error
+}
+
+// selfTestData is signed and verified by the signer self-test
+const selfTestData = "signing-service self-test"
+
+// selfTestKeys caches a key pair per algorithm, so probes don't generate keys every time
+type selfTestKeys struct {
+	keys  map[Algorithm]*KeyPairInBytes
+	mutex sync.Mutex
+}
+
+// CheckHealth checks that the devices repository and the key store are reachable
+// and signs and verifies with every algorithm the key policy allows.
+func (service *DeviceService) CheckHealth() []HealthCheck {
+	checks := []HealthCheck{
+		service.check(ComponentDevicesRepository, "", "datastore", func() error {
+			if checker, ok := service.repo.(HealthChecker); ok {
+				return checker.CheckHealth()
+			}
+			return nil
+		}),
+		// private keys are stored with their device, what can fail apart from the repository is
+		// the entropy source they are generated from
+		service.check(ComponentKeyStore, "", "datastore", func() error {
+			_, err := io.ReadFull(service.random, make([]byte, 32))
+			return err
+		}),
+	}
+	for _, algorithm := range service.keyPolicy.Algorithms {
+		checks = append(checks, service.check(ComponentSigner, algorithm.String(), "component", func() error {
+			return service.selfTest(algorithm)
+		}))
+	}
+	return checks
+}
+
+func (service *DeviceService) check(component string, componentID string, componentType string, check func() error) HealthCheck {
+	checkedAt := service.clock.Now()
+	start := time.Now()
+	err := check()
+	return HealthCheck{
+		Component:     component,
+		ComponentID:   componentID,
+		ComponentType: componentType,
+		Time:          checkedAt,
+		Duration:      time.Since(start),
+		Err:           err,
+	}
+}
+
+// selfTest signs with a key of algorithm and verifies the signature with its public key
+func (service *DeviceService) selfTest(algorithm Algorithm) error {
+	keyPair, err := service.selfTestKeyPair(algorithm)
+	if err != nil {
+		return err
+	}
+	signer, err := algorithm.Signer(keyPair.PrivateKey, service.random)
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign([]byte(selfTestData))
+	if err != nil {
+		return err
+	}
+	verifier, err := algorithm.Verifier(keyPair.PublicKey)
+	if err != nil {
+		return err
+	}
+	valid, err := verifier.Verify([]byte(selfTestData), signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("signature of the self-test doesn't verify")
+	}
+	return nil
+}
+
+func (service *DeviceService) selfTestKeyPair(algorithm Algorithm) (*KeyPairInBytes, error) {
+	service.selfTestKeys.mutex.Lock()
+	defer service.selfTestKeys.mutex.Unlock()
+
+	if keyPair, found := service.selfTestKeys.keys[algorithm]; found {
+		return keyPair, nil
+	}
+	keyPair, err := service.keyPolicy.GenerateKeyPairInBytes(algorithm, service.random)
+	if err != nil {
+		return nil, err
+	}
+	if service.selfTestKeys.keys == nil {
+		service.selfTestKeys.keys = make(map[Algorithm]*KeyPairInBytes)
+	}
+	service.selfTestKeys.keys[algorithm] = keyPair
+	return keyPair, nil
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"time"
+)
+
+// IdempotencyRetention is how long the result of an idempotent sign request is replayed.
+const IdempotencyRetention = 24 * time.Hour
+
+// ErrIdempotencyKeyMismatch is returned when an idempotency key is reused with a different request.
+var ErrIdempotencyKeyMismatch = errors.New("idempotency key was already used for a different request")
+
+// IdempotencyRecord is the stored outcome of the first request made with an idempotency key.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash [32]byte
+	Response    SignatureResponse
+	ExpiresAt   time.Time
+}
+
+type IdempotencyRepository interface {
+	// Lock blocks other callers of the same key until the returned unlock function is called.
+	Lock(key string) (unlock func())
+	Get(key string) (IdempotencyRecord, bool)
+	Save(record IdempotencyRecord) error
+	// DeleteExpired removes the records that expired at now, it runs on every idempotent request,
+	// so it should only cost in proportion to the expired records
+	DeleteExpired(now time.Time)
+}
+
+// SignTransactionIdempotently signs data at most once per device and idempotency key.
+// Retries within IdempotencyRetention replay the first result and report replayed == true.
+func (service *DeviceService) SignTransactionIdempotently(
+	ctx context.Context,
+	organizationID string,
+	id string,
+	data string,
+	idempotencyKey string,
+) (response SignatureResponse, replayed bool, err error) {
+	key := organizationID + "/" + id + "/" + idempotencyKey
+	requestHash := sha256.Sum256([]byte(data))
+
+	unlock := service.idempotency.Lock(key)
+	defer unlock()
+
+	now := service.clock.Now()
+	service.idempotency.DeleteExpired(now)
+	if record, found := service.idempotency.Get(key); found {
+		if record.RequestHash != requestHash {
+			return SignatureResponse{}, false, ErrIdempotencyKeyMismatch
+		}
+		return record.Response, true, nil
+	}
+
+	response, err = service.SignTransaction(ctx, organizationID, id, data)
+	if err != nil {
+		return SignatureResponse{}, false, err
+	}
+
+	err = service.idempotency.Save(IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		Response:    response,
+		ExpiresAt:   now.Add(IdempotencyRetention),
+	})
+	if err != nil {
+		return SignatureResponse{}, false, err
+	}
+	return response, false, nil
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type manualClock struct {
+	now time.Time
+}
+
+func (clock *manualClock) Now() time.Time {
+	return clock.now
+}
+
+func newIdempotencyTestService(t *testing.T, clock Clock) (*DeviceService, *testRepository, string) {
+	repo := &testRepository{storage: make(map[string]SignatureDevice)}
+	service := NewDeviceService(repo, newTestIdempotencyRepository(), newTestAuditLog(), DefaultKeyPolicy, rand.Reader, clock)
+	device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return service, repo, device.UUID
+}
+
+func TestSignTransactionIdempotentlyReplays(t *testing.T) {
+	service, repo, id := newIdempotencyTestService(t, SystemClock{})
+
+	first, replayed, err := service.SignTransactionIdempotently(context.Background(), testOrganizationID, id, "message", "key")
+	if err != nil || replayed {
+		t.Fatalf("first request should sign, err = %v", err)
+	}
+	second, replayed, err := service.SignTransactionIdempotently(context.Background(), testOrganizationID, id, "message", "key")
+	if err != nil || !replayed {
+		t.Fatalf("retry should be replayed, err = %v", err)
+	}
+
+	if first != second {
+		t.Errorf("replayed response differs from the first one")
+	}
+	if repo.storage[id].SignatureCounter != 1 {
+		t.Errorf("retry shouldn't sign again, counter = %v", repo.storage[id].SignatureCounter)
+	}
+}
+
+func TestSignTransactionIdempotentlyMismatch(t *testing.T) {
+	service, _, id := newIdempotencyTestService(t, SystemClock{})
+
+	if _, _, err := service.SignTransactionIdempotently(context.Background(), testOrganizationID, id, "message", "key"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, _, err := service.SignTransactionIdempotently(context.Background(), testOrganizationID, id, "other message", "key")
+	if !errors.Is(err, ErrIdempotencyKeyMismatch) {
+		t.Errorf("SignTransactionIdempotently() error = %v, want %v", err, ErrIdempotencyKeyMismatch)
+	}
+}
+
+func TestSignTransactionIdempotentlyExpires(t *testing.T) {
+	clock := &manualClock{now: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	service, repo, id := newIdempotencyTestService(t, clock)
+
+	if _, _, err := service.SignTransactionIdempotently(context.Background(), testOrganizationID, id, "message", "key"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	clock.now = clock.now.Add(IdempotencyRetention)
+	_, replayed, err := service.SignTransactionIdempotently(context.Background(), testOrganizationID, id, "message", "key")
+	if err != nil || replayed {
+		t.Errorf("expired key should sign again, replayed = %v, err = %v", replayed, err)
+	}
+	if repo.storage[id].SignatureCounter != 2 {
+		t.Errorf("counter = %v, want 2", repo.storage[id].SignatureCounter)
+	}
+}
+
+func TestSignTransactionIdempotentlyConcurrentDuplicates(t *testing.T) {
+	service, repo, id := newIdempotencyTestService(t, SystemClock{})
+
+	var wg sync.WaitGroup
+	responses := make([]SignatureResponse, 5)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], _, _ = service.SignTransactionIdempotently(context.Background(), testOrganizationID, id, "message", "key")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, response := range responses {
+		if response != responses[0] {
+			t.Errorf("concurrent duplicates returned different responses")
+		}
+	}
+	if repo.storage[id].SignatureCounter != 1 {
+		t.Errorf("counter = %v, want 1", repo.storage[id].SignatureCounter)
+	}
+}
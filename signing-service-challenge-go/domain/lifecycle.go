@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SuspendSignatureDevice temporarily disables signing with the device
+func (service *DeviceService) SuspendSignatureDevice(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	id string,
+) (SignatureDevice, error) {
+	return service.changeStatus(ctx, organizationID, actor, id, DeviceSuspended, AuditDeviceSuspended, EventDeviceSuspended)
+}
+
+// ResumeSignatureDevice re-enables signing with a suspended device
+func (service *DeviceService) ResumeSignatureDevice(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	id string,
+) (SignatureDevice, error) {
+	return service.changeStatus(ctx, organizationID, actor, id, DeviceActive, AuditDeviceResumed, EventDeviceResumed)
+}
+
+// DecommissionSignatureDevice permanently retires the device and destroys its private key.
+// The public key, signature counter and last signature are kept, so issued signatures stay verifiable.
+func (service *DeviceService) DecommissionSignatureDevice(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	id string,
+) (SignatureDevice, error) {
+	return service.changeStatus(ctx, organizationID, actor, id, DeviceDecommissioned, AuditDeviceDecommissioned, EventDeviceDecommissioned)
+}
+
+func (service *DeviceService) changeStatus(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	id string,
+	target Status,
+	action AuditAction,
+	event EventType,
+) (SignatureDevice, error) {
+	device, found := service.repo.Get(ctx, organizationID, id)
+	if !found {
+		return SignatureDevice{}, NotFoundError{"signature device", id}
+	}
+	if err := device.Status.CanTransitionTo(target); err != nil {
+		return SignatureDevice{}, err
+	}
+
+	before := device
+	device.Status = target
+	device.StatusChangedAt = service.clock.Now()
+	if target == DeviceDecommissioned {
+		device.PrivateKey = nil
+	}
+
+	device, err := service.updateWithEvent(ctx, device, event)
+	if err != nil {
+		return SignatureDevice{}, err
+	}
+	if err = service.audit.Record(organizationID, actor, action, id, before, device); err != nil {
+		return SignatureDevice{}, err
+	}
+	slog.InfoContext(ctx, "Changed status of signature device", "device", device, "actor", actor)
+	return device, nil
+}
@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSuspendedDeviceRefusesToSign(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := newTestService(&repo)
+	device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if _, err = service.SuspendSignatureDevice(context.Background(), testOrganizationID, testActor, device.UUID); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = service.SignTransaction(context.Background(), testOrganizationID, device.UUID, "message"); !errors.Is(err, ErrDeviceSuspended) {
+		t.Errorf("SignTransaction() error = %v, want %v", err, ErrDeviceSuspended)
+	}
+
+	if _, err = service.ResumeSignatureDevice(context.Background(), testOrganizationID, testActor, device.UUID); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = service.SignTransaction(context.Background(), testOrganizationID, device.UUID, "message"); err != nil {
+		t.Errorf("resumed device should sign, got %v", err)
+	}
+}
+
+func TestDecommissionDestroysPrivateKey(t *testing.T) {
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := NewDeviceService(&repo, newTestIdempotencyRepository(), newTestAuditLog(), DefaultKeyPolicy, rand.Reader, fixedClock{now: now})
+	created, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(2), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	device, err := service.DecommissionSignatureDevice(context.Background(), testOrganizationID, testActor, created.UUID)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	stored := repo.storage[created.UUID]
+	if stored.PrivateKey != nil || device.PrivateKey != nil {
+		t.Errorf("private key wasn't destroyed")
+	}
+	if len(stored.PublicKey) == 0 {
+		t.Errorf("public key should be retained")
+	}
+	if stored.Status != DeviceDecommissioned || !stored.StatusChangedAt.Equal(now) {
+		t.Errorf("status change wasn't recorded")
+	}
+	if _, err = service.SignTransaction(context.Background(), testOrganizationID, created.UUID, "message"); !errors.Is(err, ErrDeviceDecommissioned) {
+		t.Errorf("SignTransaction() error = %v, want %v", err, ErrDeviceDecommissioned)
+	}
+	if _, err = service.ResumeSignatureDevice(context.Background(), testOrganizationID, testActor, created.UUID); !errors.Is(err, ErrDeviceDecommissioned) {
+		t.Errorf("decommissioning should be irreversible, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Metrics receives measurements of the DeviceService, NopMetrics discards them.
+type Metrics interface {
+	// ObserveSign is called with the time the signer took for every created signature
+	ObserveSign(algorithm Algorithm, duration time.Duration)
+	// ObserveKeyGeneration is called with the time every generated key pair took
+	ObserveKeyGeneration(algorithm Algorithm, duration time.Duration)
+	// RepositoryError is called when a repository operation like "update" fails unexpectedly
+	RepositoryError(operation string)
+}
+
+// NopMetrics is the Metrics of an uninstrumented DeviceService.
+type NopMetrics struct{}
+
+func (NopMetrics) ObserveSign(Algorithm, time.Duration)          {}
+func (NopMetrics) ObserveKeyGeneration(Algorithm, time.Duration) {}
+func (NopMetrics) RepositoryError(string)                        {}
+
+// DeviceCount is the number of devices of all organizations with an algorithm and status.
+type DeviceCount struct {
+	Algorithm Algorithm
+	Status    Status
+	Count     int
+}
+
+// DeviceCounter is implemented by repositories that can count the devices of all organizations.
+type DeviceCounter interface {
+	CountDevices() []DeviceCount
+}
+
+// SetMetrics instruments the service, it must be called before the service is used
+func (service *DeviceService) SetMetrics(metrics Metrics) {
+	service.metrics = metrics
+}
+
+// CountDevices counts the devices of all organizations by algorithm and status,
+// nothing if the repository can't count them
+func (service *DeviceService) CountDevices() []DeviceCount {
+	if counter, ok := service.repo.(DeviceCounter); ok {
+		return counter.CountDevices()
+	}
+	return nil
+}
+
+// repositoryError reports err of a repository operation to the metrics and returns it.
+// Conflicts are answers of a healthy repository, they aren't counted.
+func (service *DeviceService) repositoryError(ctx context.Context, operation string, err error) error {
+	if err != nil && !errors.Is(err, ErrDeviceExists) && !errors.Is(err, ErrVersionConflict) {
+		service.metrics.RepositoryError(operation)
+		slog.ErrorContext(ctx, "Repository operation failed", "operation", operation, "error", err)
+	}
+	return err
+}
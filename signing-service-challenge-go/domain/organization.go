@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"strings"
+	"time"
+)
+
+// Organization is a tenant owning signature devices and API keys.
+// The operator organization runs the node and may onboard further organizations.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Operator  bool      `json:"operator"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrganizationsRepository interface {
+	Get(id string) (Organization, bool)
+	GetAll() []Organization
+	Create(organization Organization) error
+}
+
+// OrganizationService manages the tenants hosted by the service.
+type OrganizationService struct {
+	repo   OrganizationsRepository
+	audit  *AuditLog
+	random io.Reader
+	clock  Clock
+}
+
+// NewOrganizationService is a factory to instantiate a new OrganizationService.
+func NewOrganizationService(
+	repo OrganizationsRepository,
+	audit *AuditLog,
+	random io.Reader,
+	clock Clock,
+) *OrganizationService {
+	return &OrganizationService{
+		repo:   repo,
+		audit:  audit,
+		random: random,
+		clock:  clock,
+	}
+}
+
+// CreateOrganization stores a new tenant on behalf of actor
+func (service *OrganizationService) CreateOrganization(actor string, name string) (Organization, error) {
+	return service.createOrganization(actor, name, false)
+}
+
+// CreateOperatorOrganization stores the tenant that operates the node
+func (service *OrganizationService) CreateOperatorOrganization(name string) (Organization, error) {
+	return service.createOrganization(SystemActor, name, true)
+}
+
+// GetOrganization returns stored Organization by id
+func (service *OrganizationService) GetOrganization(id string) (Organization, bool) {
+	return service.repo.Get(id)
+}
+
+// ListOrganizations returns all stored Organization
+func (service *OrganizationService) ListOrganizations() []Organization {
+	return service.repo.GetAll()
+}
+
+// IsOperator reports whether the organization operates the node
+func (service *OrganizationService) IsOperator(id string) bool {
+	organization, found := service.repo.Get(id)
+	return found && organization.Operator
+}
+
+func (service *OrganizationService) createOrganization(actor string, name string, operator bool) (Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxLabelLength {
+		return Organization{}, ValidationError{"name", fmt.Sprintf("must be between 1 and %d characters", maxLabelLength)}
+	}
+
+	id, err := uuid.NewRandomFromReader(service.random)
+	if err != nil {
+		return Organization{}, err
+	}
+	organization := Organization{
+		ID:        id.String(),
+		Name:      name,
+		Operator:  operator,
+		CreatedAt: service.clock.Now(),
+	}
+	if err = service.repo.Create(organization); err != nil {
+		return Organization{}, err
+	}
+	// the entry opens the audit chain of the new organization
+	err = service.audit.Record(organization.ID, actor, AuditOrganizationCreated, organization.ID, nil, organization)
+	if err != nil {
+		return Organization{}, err
+	}
+	return organization, nil
+}
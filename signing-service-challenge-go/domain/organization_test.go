@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testOrganizationsRepository struct {
+	storage map[string]Organization
+}
+
+func (repo *testOrganizationsRepository) Get(id string) (Organization, bool) {
+	organization, found := repo.storage[id]
+	return organization, found
+}
+func (repo *testOrganizationsRepository) GetAll() []Organization {
+	organizations := make([]Organization, 0, len(repo.storage))
+	for _, organization := range repo.storage {
+		organizations = append(organizations, organization)
+	}
+	return organizations
+}
+func (repo *testOrganizationsRepository) Create(organization Organization) error {
+	if _, found := repo.storage[organization.ID]; found {
+		return fmt.Errorf("organization with id %q already exists", organization.ID)
+	}
+	repo.storage[organization.ID] = organization
+	return nil
+}
+
+func newTestOrganizationService(log *AuditLog) *OrganizationService {
+	repo := testOrganizationsRepository{storage: make(map[string]Organization)}
+	return NewOrganizationService(&repo, log, rand.Reader, SystemClock{})
+}
+
+func TestOrganizationService_CreateOrganization(t *testing.T) {
+	log := newTestAuditLog()
+	service := newTestOrganizationService(log)
+
+	organization, err := service.CreateOrganization(testActor, "  shop  ")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if organization.Name != "shop" || organization.Operator || organization.ID == "" {
+		t.Errorf("CreateOrganization() = %+v, want a tenant named shop", organization)
+	}
+	if stored, found := service.GetOrganization(organization.ID); !found || stored != organization {
+		t.Errorf("GetOrganization() = %+v, want %+v", stored, organization)
+	}
+
+	entries := log.Entries(organization.ID, AuditFilter{})
+	if len(entries) != 1 || entries[0].Action != AuditOrganizationCreated || entries[0].Actor != testActor {
+		t.Errorf("Entries() = %+v, want the creation to open the audit chain", entries)
+	}
+}
+
+func TestOrganizationService_CreateOrganizationValidatesName(t *testing.T) {
+	service := newTestOrganizationService(newTestAuditLog())
+
+	for _, name := range []string{"", "   ", strings.Repeat("a", maxLabelLength+1)} {
+		if _, err := service.CreateOrganization(testActor, name); err == nil {
+			t.Errorf("CreateOrganization(%q) should fail", name)
+		}
+	}
+	if organizations := service.ListOrganizations(); len(organizations) != 0 {
+		t.Errorf("invalid organizations were stored: %+v", organizations)
+	}
+}
+
+func TestOrganizationService_IsOperator(t *testing.T) {
+	service := newTestOrganizationService(newTestAuditLog())
+	operator, err := service.CreateOperatorOrganization("operator")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tenant, err := service.CreateOrganization(operator.ID, "shop")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"operator", operator.ID, true},
+		{"tenant", tenant.ID, false},
+		{"unknown", "unknown", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := service.IsOperator(test.id); got != test.want {
+				t.Errorf("IsOperator() = %v, want %v", got, test.want)
+			}
+		})
+	}
+	if organizations := service.ListOrganizations(); len(organizations) != 2 {
+		t.Errorf("expected 2 organizations, got %d", len(organizations))
+	}
+}
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OutboxEvent is an event stored in the outbox, Sequence orders all events of the outbox.
+type OutboxEvent struct {
+	Sequence int64
+	Event    Event
+}
+
+// OutboxRepository is the log of events written together with the changes that raised them.
+// Every consumer tracks its own committed offset into the log.
+type OutboxRepository interface {
+	// Events returns up to limit events with a sequence greater than after in sequence order
+	Events(after int64, limit int) []OutboxEvent
+	// Offset returns the sequence of the last event the consumer committed
+	Offset(consumer string) int64
+	Commit(consumer string, sequence int64) error
+	// Prune drops events up to sequence once every consumer committed them
+	Prune(sequence int64)
+}
+
+// EventDispatcher publishes outbox events to sinks.
+// A sink's offset is committed only after it accepted an event, so a failing sink
+// retries from its first undelivered event and never blocks the other sinks.
+type EventDispatcher struct {
+	outbox    OutboxRepository
+	sinks     []EventSink
+	batchSize int
+	// dispatching serializes dispatch runs, so events are handed to a sink in order
+	dispatching sync.Mutex
+}
+
+// NewEventDispatcher is a factory to instantiate a new EventDispatcher.
+func NewEventDispatcher(outbox OutboxRepository, batchSize int, sinks ...EventSink) *EventDispatcher {
+	return &EventDispatcher{
+		outbox:    outbox,
+		sinks:     sinks,
+		batchSize: batchSize,
+	}
+}
+
+// Run dispatches pending events every interval until ctx is done
+func (dispatcher *EventDispatcher) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dispatcher.Dispatch(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Dispatch hands every pending event to the sinks that haven't accepted it yet
+func (dispatcher *EventDispatcher) Dispatch() error {
+	dispatcher.dispatching.Lock()
+	defer dispatcher.dispatching.Unlock()
+
+	var errs []error
+	var committed int64 = -1
+	for _, sink := range dispatcher.sinks {
+		offset, err := dispatcher.dispatchTo(sink)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", sink.Name(), err))
+		}
+		if committed < 0 || offset < committed {
+			committed = offset
+		}
+	}
+	if committed > 0 {
+		dispatcher.outbox.Prune(committed)
+	}
+	return errors.Join(errs...)
+}
+
+// dispatchTo delivers pending events to sink in order and returns its committed offset
+func (dispatcher *EventDispatcher) dispatchTo(sink EventSink) (int64, error) {
+	offset := dispatcher.outbox.Offset(sink.Name())
+	for {
+		events := dispatcher.outbox.Events(offset, dispatcher.batchSize)
+		if len(events) == 0 {
+			return offset, nil
+		}
+		for _, event := range events {
+			if err := sink.Deliver(event.Event); err != nil {
+				return offset, err
+			}
+			if err := dispatcher.outbox.Commit(sink.Name(), event.Sequence); err != nil {
+				return offset, err
+			}
+			offset = event.Sequence
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+type testOutboxRepository struct {
+	events  []OutboxEvent
+	offsets map[string]int64
+	pruned  int64
+}
+
+func newTestOutbox(events ...Event) *testOutboxRepository {
+	outbox := &testOutboxRepository{offsets: make(map[string]int64)}
+	for i, event := range events {
+		outbox.events = append(outbox.events, OutboxEvent{Sequence: int64(i + 1), Event: event})
+	}
+	return outbox
+}
+
+func (outbox *testOutboxRepository) Events(after int64, limit int) []OutboxEvent {
+	events := make([]OutboxEvent, 0)
+	for _, event := range outbox.events {
+		if event.Sequence > after && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+func (outbox *testOutboxRepository) Offset(consumer string) int64 {
+	return outbox.offsets[consumer]
+}
+func (outbox *testOutboxRepository) Commit(consumer string, sequence int64) error {
+	outbox.offsets[consumer] = sequence
+	return nil
+}
+func (outbox *testOutboxRepository) Prune(sequence int64) {
+	outbox.pruned = sequence
+}
+
+// testSink records delivered event ids and fails while failures is positive
+type testSink struct {
+	name      string
+	delivered []string
+	failures  int
+}
+
+func (sink *testSink) Name() string {
+	return sink.name
+}
+func (sink *testSink) Deliver(event Event) error {
+	if sink.failures > 0 {
+		sink.failures--
+		return errors.New("sink unavailable")
+	}
+	sink.delivered = append(sink.delivered, event.ID)
+	return nil
+}
+
+func TestEventDispatcherDeliversAtLeastOnce(t *testing.T) {
+	outbox := newTestOutbox(Event{ID: "1"}, Event{ID: "2"}, Event{ID: "3"})
+	healthy := &testSink{name: "healthy"}
+	flaky := &testSink{name: "flaky", failures: 1}
+	dispatcher := NewEventDispatcher(outbox, 2, healthy, flaky)
+
+	if err := dispatcher.Dispatch(); err == nil {
+		t.Errorf("Dispatch() succeeded, want the error of the flaky sink")
+	}
+	if len(healthy.delivered) != 3 || len(flaky.delivered) != 0 {
+		t.Fatalf("healthy got %v, flaky got %v, want a failing sink not to block others", healthy.delivered, flaky.delivered)
+	}
+	if outbox.pruned != 0 {
+		t.Errorf("Prune(%d) called before every sink committed", outbox.pruned)
+	}
+
+	if err := dispatcher.Dispatch(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(healthy.delivered) != 3 || len(flaky.delivered) != 3 || flaky.delivered[0] != "1" {
+		t.Errorf("healthy got %v, flaky got %v, want every event once and in order", healthy.delivered, flaky.delivered)
+	}
+	if outbox.pruned != 3 {
+		t.Errorf("pruned up to %d, want 3", outbox.pruned)
+	}
+}
+
+func TestDeviceServiceWritesEventsWithChanges(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := NewDeviceService(&repo, newTestIdempotencyRepository(), newTestAuditLog(), DefaultKeyPolicy, rand.Reader, SystemClock{})
+	device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = service.SignTransaction(context.Background(), testOrganizationID, device.UUID, "message"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = service.SuspendSignatureDevice(context.Background(), testOrganizationID, testActor, device.UUID); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	want := []EventType{EventDeviceCreated, EventSignatureCreated, EventDeviceSuspended}
+	if len(repo.events) != len(want) {
+		t.Fatalf("repository stored %d events, want %d", len(repo.events), len(want))
+	}
+	for i, event := range repo.events {
+		if event.Type != want[i] || event.DeviceID != device.UUID || event.OrganizationID != testOrganizationID {
+			t.Errorf("event %d = %+v, want %s of the device", i, event, want[i])
+		}
+		if _, ok := event.Data.(SignatureDevice); ok {
+			t.Errorf("event %d carries the device with its private key", i)
+		}
+	}
+	suspended := repo.events[2].Data.(DeviceChangedData)
+	if stored := repo.storage[device.UUID]; suspended.Version != stored.Version || suspended.Status != DeviceSuspended {
+		t.Errorf("event carries version %d, status %s, want the stored version %d", suspended.Version, suspended.Status, stored.Version)
+	}
+}
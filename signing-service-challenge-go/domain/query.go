@@ -0,0 +1,189 @@
+package domain
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDevicePageSize = 50
+	MaxDevicePageSize     = 500
+)
+
+// DeviceSortField is the key device listings are ordered by.
+type DeviceSortField string
+
+const (
+	SortByCreatedAt        DeviceSortField = "created_at"
+	SortByLabel            DeviceSortField = "label"
+	SortBySignatureCounter DeviceSortField = "signature_counter"
+)
+
+// ParseDeviceSortField from string
+func ParseDeviceSortField(s string) (DeviceSortField, error) {
+	switch field := DeviceSortField(s); field {
+	case SortByCreatedAt, SortByLabel, SortBySignatureCounter:
+		return field, nil
+	}
+	return "", fmt.Errorf("%q is not a valid sort field", s)
+}
+
+// DeviceFilter narrows down device listings, zero values match everything.
+type DeviceFilter struct {
+	Algorithm   Algorithm
+	LabelPrefix string
+	Status      *Status
+	Tag         string
+}
+
+// DeviceQuery selects a page of devices.
+// Devices are ordered by SortBy and then by UUID, so the order is stable even if sort keys repeat.
+type DeviceQuery struct {
+	DeviceFilter
+	SortBy     DeviceSortField
+	Descending bool
+	// After continues the listing behind the device the cursor points at
+	After *DeviceCursor
+	Limit int
+}
+
+// DeviceCursor is the position of a device in a listing, it holds the sort key of the device.
+type DeviceCursor struct {
+	SortBy           DeviceSortField `json:"sort"`
+	Descending       bool            `json:"desc,omitempty"`
+	CreatedAt        time.Time       `json:"created_at,omitempty"`
+	Label            string          `json:"label,omitempty"`
+	SignatureCounter int             `json:"signature_counter,omitempty"`
+	UUID             string          `json:"uuid"`
+}
+
+// DevicePage is one page of a device listing, NextCursor is empty on the last page.
+type DevicePage struct {
+	Devices    []SignatureDevice
+	NextCursor string
+}
+
+// Matches reports whether device passes the filter
+func (filter DeviceFilter) Matches(device SignatureDevice) bool {
+	if filter.Algorithm != 0 && device.Algorithm != filter.Algorithm {
+		return false
+	}
+	if !strings.HasPrefix(device.Label, filter.LabelPrefix) {
+		return false
+	}
+	if filter.Status != nil && device.Status != *filter.Status {
+		return false
+	}
+	if filter.Tag == "" {
+		return true
+	}
+	for _, tag := range device.Tags {
+		if tag == filter.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Before reports whether a is listed before b
+func (query DeviceQuery) Before(a SignatureDevice, b SignatureDevice) bool {
+	var compared int
+	switch query.SortBy {
+	case SortByLabel:
+		compared = strings.Compare(a.Label, b.Label)
+	case SortBySignatureCounter:
+		compared = a.SignatureCounter - b.SignatureCounter
+	default:
+		compared = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if compared == 0 {
+		compared = strings.Compare(a.UUID, b.UUID)
+	}
+	if query.Descending {
+		return compared > 0
+	}
+	return compared < 0
+}
+
+// IsAfterCursor reports whether device is listed behind the cursor of the query
+func (query DeviceQuery) IsAfterCursor(device SignatureDevice) bool {
+	if query.After == nil {
+		return true
+	}
+	return query.Before(SignatureDevice{
+		UUID:             query.After.UUID,
+		Label:            query.After.Label,
+		SignatureCounter: query.After.SignatureCounter,
+		CreatedAt:        query.After.CreatedAt,
+	}, device)
+}
+
+func (query DeviceQuery) cursorOf(device SignatureDevice) DeviceCursor {
+	cursor := DeviceCursor{SortBy: query.SortBy, Descending: query.Descending, UUID: device.UUID}
+	switch query.SortBy {
+	case SortByLabel:
+		cursor.Label = device.Label
+	case SortBySignatureCounter:
+		cursor.SignatureCounter = device.SignatureCounter
+	default:
+		cursor.CreatedAt = device.CreatedAt
+	}
+	return cursor
+}
+
+// EncodeDeviceCursor returns the opaque form of cursor handed to clients
+func EncodeDeviceCursor(cursor DeviceCursor) (string, error) {
+	encoded, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// ParseDeviceCursor from its opaque form
+func ParseDeviceCursor(s string) (DeviceCursor, error) {
+	var cursor DeviceCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(decoded, &cursor)
+	}
+	if err != nil || cursor.UUID == "" {
+		return DeviceCursor{}, ValidationError{"cursor", "is not a valid cursor"}
+	}
+	return cursor, nil
+}
+
+// ListSignatureDevices returns a page of the devices of the organization matching query
+func (service *DeviceService) ListSignatureDevices(ctx context.Context, organizationID string, query DeviceQuery) (DevicePage, error) {
+	if query.SortBy == "" {
+		query.SortBy = SortByCreatedAt
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultDevicePageSize
+	}
+	if query.Limit < 0 || query.Limit > MaxDevicePageSize {
+		return DevicePage{}, ValidationError{"limit", fmt.Sprintf("must be between 1 and %d", MaxDevicePageSize)}
+	}
+	if query.After != nil && (query.After.SortBy != query.SortBy || query.After.Descending != query.Descending) {
+		return DevicePage{}, ValidationError{"cursor", "belongs to a listing with a different sort order"}
+	}
+
+	// one more device than requested tells whether another page follows
+	limit := query.Limit
+	query.Limit++
+	devices := service.repo.List(ctx, organizationID, query)
+	if len(devices) <= limit {
+		return DevicePage{Devices: devices}, nil
+	}
+
+	devices = devices[:limit]
+	nextCursor, err := EncodeDeviceCursor(query.cursorOf(devices[limit-1]))
+	if err != nil {
+		return DevicePage{}, err
+	}
+	return DevicePage{Devices: devices, NextCursor: nextCursor}, nil
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestListSignatureDevicesPaginates(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	created := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("device-%d", i)
+		// equal timestamps make the UUID decide the order
+		repo.storage[id] = SignatureDevice{UUID: id, OrganizationID: testOrganizationID, CreatedAt: created.Add(time.Duration(i/2) * time.Second)}
+	}
+	service := newTestService(&repo)
+
+	var listed []string
+	query := DeviceQuery{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("pagination doesn't terminate")
+		}
+		page, err := service.ListSignatureDevices(context.Background(), testOrganizationID, query)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, device := range page.Devices {
+			listed = append(listed, device.UUID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor, err := ParseDeviceCursor(page.NextCursor)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		query.After = &cursor
+	}
+
+	want := "[device-0 device-1 device-2 device-3 device-4]"
+	if fmt.Sprint(listed) != want {
+		t.Errorf("listed %v, want %s", listed, want)
+	}
+}
+
+func TestListSignatureDevicesInvalidQuery(t *testing.T) {
+	service := newTestService(&testRepository{storage: make(map[string]SignatureDevice)})
+	tests := []struct {
+		name  string
+		query DeviceQuery
+	}{
+		{"limit too large", DeviceQuery{Limit: MaxDevicePageSize + 1}},
+		{"cursor of another sort", DeviceQuery{SortBy: SortByLabel, After: &DeviceCursor{SortBy: SortByCreatedAt, UUID: "a"}}},
+		{"cursor of another order", DeviceQuery{Descending: true, After: &DeviceCursor{SortBy: SortByCreatedAt, UUID: "a"}}},
+	}
+	for _, test := range tests {
+		if _, err := service.ListSignatureDevices(context.Background(), testOrganizationID, test.query); err == nil {
+			t.Errorf("%s: ListSignatureDevices() succeeded, want error", test.name)
+		}
+	}
+	if _, err := ParseDeviceCursor("not-a-cursor"); err == nil {
+		t.Errorf("ParseDeviceCursor() accepted garbage")
+	}
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Permission allows an operation on a group of resources.
+type Permission string
+
+const (
+	PermissionReadDevices         Permission = "devices:read"
+	PermissionSignTransactions    Permission = "devices:sign"
+	PermissionManageDevices       Permission = "devices:manage"
+	PermissionReadAudit           Permission = "audit:read"
+	PermissionManageAPIKeys       Permission = "api-keys:manage"
+	PermissionManageWebhooks      Permission = "webhooks:manage"
+	PermissionManageOrganizations Permission = "organizations:manage"
+)
+
+// Role bundles the permissions of a kind of API client.
+type Role string
+
+const (
+	// RoleViewer reads devices, e.g. for dashboards
+	RoleViewer Role = "viewer"
+	// RoleSigner is used by POS terminals to sign transactions
+	RoleSigner Role = "signer"
+	// RoleDeviceAdmin creates devices and manages their lifecycle
+	RoleDeviceAdmin Role = "device-admin"
+	// RoleAuditor reads devices and the audit trail
+	RoleAuditor Role = "auditor"
+	// RoleAdmin holds every permission, including credential management
+	RoleAdmin Role = "admin"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:      {PermissionReadDevices},
+	RoleSigner:      {PermissionReadDevices, PermissionSignTransactions},
+	RoleDeviceAdmin: {PermissionReadDevices, PermissionManageDevices},
+	RoleAuditor:     {PermissionReadDevices, PermissionReadAudit},
+	RoleAdmin: {
+		PermissionReadDevices,
+		PermissionSignTransactions,
+		PermissionManageDevices,
+		PermissionReadAudit,
+		PermissionManageAPIKeys,
+		PermissionManageWebhooks,
+		PermissionManageOrganizations,
+	},
+}
+
+// ParseRole from string
+func ParseRole(s string) (Role, error) {
+	role := Role(strings.TrimSpace(strings.ToLower(s)))
+	if _, found := rolePermissions[role]; !found {
+		return "", fmt.Errorf("%q is not a valid role", s)
+	}
+	return role, nil
+}
+
+// Grants reports whether the role includes permission
+func (role Role) Grants(permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// LogSink logs every event without its data, which may hold the data of a signed transaction.
+type LogSink struct {
+	logger *slog.Logger
+}
+
+// NewLogSink is a factory to instantiate a new LogSink.
+func NewLogSink(logger *slog.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+func (sink *LogSink) Name() string {
+	return "log"
+}
+
+func (sink *LogSink) Deliver(event Event) error {
+	sink.logger.Info("Delivered event", "event", event)
+	return nil
+}
+
+// MessageBroker is the producer side of a message broker client, e.g. for Kafka or NATS.
+type MessageBroker interface {
+	Publish(topic string, key string, payload []byte) error
+}
+
+// BrokerSink publishes events to one topic per event type.
+// Messages are keyed by device, so brokers partitioning by key keep the events of a device in order.
+type BrokerSink struct {
+	broker      MessageBroker
+	topicPrefix string
+}
+
+// NewBrokerSink is a factory to instantiate a new BrokerSink.
+func NewBrokerSink(broker MessageBroker, topicPrefix string) *BrokerSink {
+	return &BrokerSink{
+		broker:      broker,
+		topicPrefix: topicPrefix,
+	}
+}
+
+func (sink *BrokerSink) Name() string {
+	return "broker:" + sink.topicPrefix
+}
+
+func (sink *BrokerSink) Deliver(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return sink.broker.Publish(sink.topicPrefix+string(event.Type), event.DeviceID, payload)
+}
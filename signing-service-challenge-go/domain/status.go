@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Status is the lifecycle state of a SignatureDevice.
+type Status uint8
+
+const (
+	DeviceActive Status = iota
+	DeviceSuspended
+	DeviceDecommissioned
+)
+
+var statusName = map[uint8]string{
+	0: "active",
+	1: "suspended",
+	2: "decommissioned",
+}
+
+var statusValue = map[string]uint8{
+	"active":         0,
+	"suspended":      1,
+	"decommissioned": 2,
+}
+
+var (
+	// ErrDeviceSuspended is returned when a suspended device is asked to sign.
+	ErrDeviceSuspended = errors.New("signature device is suspended")
+	// ErrDeviceDecommissioned is returned when a decommissioned device is asked to sign or change state.
+	ErrDeviceDecommissioned = errors.New("signature device is decommissioned")
+)
+
+// allowedTransitions lists target statuses reachable from each status
+var allowedTransitions = map[Status][]Status{
+	DeviceActive:    {DeviceSuspended, DeviceDecommissioned},
+	DeviceSuspended: {DeviceActive, DeviceDecommissioned},
+}
+
+// String representation of Status object
+func (status Status) String() string {
+	return statusName[uint8(status)]
+}
+
+// ParseStatus from string
+func ParseStatus(s string) (Status, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	value, found := statusValue[s]
+	if !found {
+		return Status(0), fmt.Errorf("%q is not a valid status", s)
+	}
+	return Status(value), nil
+}
+
+// MarshalJSON converts Status to string representation for client
+func (status Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(status.String())
+}
+
+// UnmarshalJSON converts user's string input to Status object
+func (status *Status) UnmarshalJSON(data []byte) (err error) {
+	var stringValue string
+	if err = json.Unmarshal(data, &stringValue); err != nil {
+		return err
+	}
+	if *status, err = ParseStatus(stringValue); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CanSign reports whether a device in this status may create signatures
+func (status Status) CanSign() error {
+	switch status {
+	case DeviceActive:
+		return nil
+	case DeviceSuspended:
+		return ErrDeviceSuspended
+	default:
+		return ErrDeviceDecommissioned
+	}
+}
+
+// CanTransitionTo checks that the lifecycle allows moving from status to target
+func (status Status) CanTransitionTo(target Status) error {
+	if status == DeviceDecommissioned {
+		return ErrDeviceDecommissioned
+	}
+	for _, allowed := range allowedTransitions[status] {
+		if allowed == target {
+			return nil
+		}
+	}
+	return StatusTransitionError{status, target}
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Status
+		wantErr bool
+	}{
+		{"active", "active", DeviceActive, false},
+		{"suspended", "Suspended", DeviceSuspended, false},
+		{"decommissioned", "DECOMMISSIONED", DeviceDecommissioned, false},
+		{"invalid value", "deleted", Status(0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStatus(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseStatus() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatus_CanSign(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  Status
+		wantErr error
+	}{
+		{"active signs", DeviceActive, nil},
+		{"suspended refuses", DeviceSuspended, ErrDeviceSuspended},
+		{"decommissioned refuses", DeviceDecommissioned, ErrDeviceDecommissioned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.status.CanSign(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CanSign() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    Status
+		to      Status
+		wantErr bool
+	}{
+		{"suspend active", DeviceActive, DeviceSuspended, false},
+		{"decommission active", DeviceActive, DeviceDecommissioned, false},
+		{"resume suspended", DeviceSuspended, DeviceActive, false},
+		{"decommission suspended", DeviceSuspended, DeviceDecommissioned, false},
+		{"resume active", DeviceActive, DeviceActive, true},
+		{"suspend suspended", DeviceSuspended, DeviceSuspended, true},
+		{"resume decommissioned", DeviceDecommissioned, DeviceActive, true},
+		{"suspend decommissioned", DeviceDecommissioned, DeviceSuspended, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.from.CanTransitionTo(tt.to); (err != nil) != tt.wantErr {
+				t.Errorf("CanTransitionTo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
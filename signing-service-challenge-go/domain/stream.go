@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultEventHistoryRetention is how long events stay in the history for clients to resume after them
+const DefaultEventHistoryRetention = 7 * 24 * time.Hour
+
+// ErrEventsExpired is returned for resuming after an event that already left the history retention window
+var ErrEventsExpired = errors.New("events following the given id are no longer retained, restart the stream without it")
+
+// EventHistoryRepository keeps the events of the outbox for a retention window,
+// so clients can catch up on events they missed.
+type EventHistoryRepository interface {
+	// History returns up to limit events of the organization with a sequence greater than after
+	// in sequence order, restricted to the device unless deviceID is empty
+	History(organizationID string, deviceID string, after int64, limit int) []OutboxEvent
+	LastSequence() int64
+	// OldestSequence returns the sequence of the oldest retained event, LastSequence()+1 if none is retained
+	OldestSequence() int64
+	// SignatureSequence returns the sequence of the signature that raised the device's signature counter
+	// to signatureCounter, ErrEventsExpired if it left the history already
+	SignatureSequence(organizationID string, deviceID string, signatureCounter int) (int64, error)
+}
+
+// EventStream lets clients follow the event history live.
+// As EventSink it wakes the subscribers of an organization whenever one of its events is dispatched.
+type EventStream struct {
+	history     EventHistoryRepository
+	mutex       sync.Mutex
+	subscribers map[string]map[chan struct{}]bool
+}
+
+// NewEventStream is a factory to instantiate a new EventStream.
+func NewEventStream(history EventHistoryRepository) *EventStream {
+	return &EventStream{
+		history:     history,
+		subscribers: make(map[string]map[chan struct{}]bool),
+	}
+}
+
+func (stream *EventStream) Name() string {
+	return "stream"
+}
+
+// Deliver wakes the subscribers of the organization of event
+func (stream *EventStream) Deliver(event Event) error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	for wake := range stream.subscribers[event.OrganizationID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+			// the subscriber wasn't woken up yet and reads all new events then anyway
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel that receives a value whenever the organization has new events
+func (stream *EventStream) Subscribe(organizationID string) (<-chan struct{}, func()) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	wake := make(chan struct{}, 1)
+	if stream.subscribers[organizationID] == nil {
+		stream.subscribers[organizationID] = make(map[chan struct{}]bool)
+	}
+	stream.subscribers[organizationID][wake] = true
+
+	return wake, func() {
+		stream.mutex.Lock()
+		defer stream.mutex.Unlock()
+		delete(stream.subscribers[organizationID], wake)
+		if len(stream.subscribers[organizationID]) == 0 {
+			delete(stream.subscribers, organizationID)
+		}
+	}
+}
+
+// Events returns up to limit events following the sequence after
+func (stream *EventStream) Events(organizationID string, deviceID string, after int64, limit int) []OutboxEvent {
+	return stream.history.History(organizationID, deviceID, after, limit)
+}
+
+// LastSequence returns the position of the newest event, streams start there unless they resume
+func (stream *EventStream) LastSequence() int64 {
+	return stream.history.LastSequence()
+}
+
+// CheckRetained fails with ErrEventsExpired unless all events following the sequence after are retained
+func (stream *EventStream) CheckRetained(after int64) error {
+	if oldest := stream.history.OldestSequence(); after < oldest-1 {
+		return fmt.Errorf("event %d precedes the oldest retained event %d: %w", after, oldest, ErrEventsExpired)
+	}
+	return nil
+}
+
+// SequenceOfSignature returns the position of the signature that raised the device's
+// signature counter to signatureCounter, so a stream of the device resumes right after it
+func (stream *EventStream) SequenceOfSignature(organizationID string, deviceID string, signatureCounter int) (int64, error) {
+	return stream.history.SignatureSequence(organizationID, deviceID, signatureCounter)
+}
@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// attributeTypes maps the RFC 4514 keywords pkix.Name.String writes to their object identifiers
+var attributeTypes = map[string]asn1.ObjectIdentifier{
+	"CN":           {2, 5, 4, 3},
+	"SERIALNUMBER": {2, 5, 4, 5},
+	"C":            {2, 5, 4, 6},
+	"L":            {2, 5, 4, 7},
+	"ST":           {2, 5, 4, 8},
+	"STREET":       {2, 5, 4, 9},
+	"O":            {2, 5, 4, 10},
+	"OU":           {2, 5, 4, 11},
+	"POSTALCODE":   {2, 5, 4, 17},
+}
+
+// parseDistinguishedName parses an RFC 4514 distinguished name like "CN=till-7,O=organization".
+// The result's String is the form certificate subjects are looked up by, whatever spacing, keyword case,
+// escaping or attribute order subject uses.
+func parseDistinguishedName(subject string) (pkix.Name, error) {
+	var rdns pkix.RDNSequence
+	var rdn pkix.RelativeDistinguishedNameSET
+	for rest := subject; ; {
+		attribute, separator, remaining, err := parseAttribute(rest)
+		if err != nil {
+			return pkix.Name{}, err
+		}
+		rdn = append(rdn, attribute)
+		if separator != '+' {
+			// the string lists the most specific RDN first, the sequence last
+			rdns = append(pkix.RDNSequence{rdn}, rdns...)
+			rdn = nil
+		}
+		if separator == 0 {
+			break
+		}
+		rest = remaining
+	}
+
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdns)
+	return name, nil
+}
+
+// parseAttribute parses the first "type=value" of s, it returns the separator ending it, ',' or '+',
+// or 0 at the end of s, and what follows the separator
+func parseAttribute(s string) (pkix.AttributeTypeAndValue, byte, string, error) {
+	equals := strings.IndexByte(s, '=')
+	if equals < 0 {
+		return pkix.AttributeTypeAndValue{}, 0, "", fmt.Errorf("attribute %q has no value", strings.TrimSpace(s))
+	}
+	attributeType, err := parseAttributeType(strings.TrimSpace(s[:equals]))
+	if err != nil {
+		return pkix.AttributeTypeAndValue{}, 0, "", err
+	}
+
+	s = strings.TrimLeft(s[equals+1:], " ")
+	if strings.HasPrefix(s, "#") {
+		end := strings.IndexAny(s, ",+")
+		if end < 0 {
+			end = len(s)
+		}
+		value, err := parseEncodedValue(strings.TrimRight(s[1:end], " "))
+		if err != nil {
+			return pkix.AttributeTypeAndValue{}, 0, "", err
+		}
+		return pkix.AttributeTypeAndValue{Type: attributeType, Value: value}, separatorAt(s, end), remainderAt(s, end), nil
+	}
+
+	var value []byte
+	// kept is the length of value without unescaped trailing spaces
+	kept := 0
+	i := 0
+	for ; i < len(s) && s[i] != ',' && s[i] != '+'; i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && strings.IndexByte(" \"#+,;<=>\\", s[i+1]) >= 0:
+			i++
+			value = append(value, s[i])
+			kept = len(value)
+		case s[i] == '\\' && i+2 < len(s):
+			decoded, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return pkix.AttributeTypeAndValue{}, 0, "", fmt.Errorf("invalid escape %q", s[i:i+3])
+			}
+			i += 2
+			value = append(value, byte(decoded))
+			kept = len(value)
+		case s[i] == '\\':
+			return pkix.AttributeTypeAndValue{}, 0, "", errors.New("value ends with an incomplete escape")
+		default:
+			value = append(value, s[i])
+			if s[i] != ' ' {
+				kept = len(value)
+			}
+		}
+	}
+	if !utf8.Valid(value) {
+		return pkix.AttributeTypeAndValue{}, 0, "", errors.New("escaped value isn't UTF-8")
+	}
+	attribute := pkix.AttributeTypeAndValue{Type: attributeType, Value: string(value[:kept])}
+	return attribute, separatorAt(s, i), remainderAt(s, i), nil
+}
+
+// parseAttributeType resolves a keyword like "cn" or a dotted object identifier like "2.5.4.3"
+func parseAttributeType(s string) (asn1.ObjectIdentifier, error) {
+	if oid, found := attributeTypes[strings.ToUpper(s)]; found {
+		return oid, nil
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("unknown attribute type %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.Atoi(part)
+		if err != nil || arc < 0 {
+			return nil, fmt.Errorf("unknown attribute type %q", s)
+		}
+		oid[i] = arc
+	}
+	return oid, nil
+}
+
+// parseEncodedValue decodes the hex BER string value pkix.Name.String writes for unknown attribute types
+func parseEncodedValue(s string) (string, error) {
+	encoded, err := hex.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid hex value %q", s)
+	}
+	var value string
+	if rest, err := asn1.Unmarshal(encoded, &value); err != nil || len(rest) > 0 {
+		return "", fmt.Errorf("hex value %q isn't an encoded string", s)
+	}
+	return value, nil
+}
+
+func separatorAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+func remainderAt(s string, i int) string {
+	if i < len(s) {
+		return s[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"context"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TracerName is the instrumentation scope of the spans of the domain services.
+const TracerName = "github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+
+// Span attributes, data to be signed and keys are never recorded
+const (
+	attributeOrganizationID   = "signing.organization_id"
+	attributeDeviceID         = "signing.device_id"
+	attributeAlgorithm        = "signing.algorithm"
+	attributeSignatureCounter = "signing.signature_counter"
+)
+
+// nopTracer traces nothing until SetTracerProvider is called
+var nopTracer = noop.NewTracerProvider().Tracer(TracerName)
+
+// SetTracerProvider traces signatures and every repository call with spans of provider,
+// it must be called before the service is used
+func (service *DeviceService) SetTracerProvider(provider trace.TracerProvider) {
+	service.tracer = provider.Tracer(TracerName)
+	service.repo = tracedDevicesRepository{next: service.repo, tracer: service.tracer}
+}
+
+// sign signs data with the private key of device. Decoding the key is a span of its own,
+// as it can take longer than signing.
+func (service *DeviceService) sign(ctx context.Context, device SignatureDevice, data []byte) ([]byte, error) {
+	algorithm := attribute.String(attributeAlgorithm, device.Algorithm.String())
+	ctx, span := service.tracer.Start(ctx, "Signer.Sign", trace.WithAttributes(algorithm))
+	signer, err := device.Algorithm.Signer(device.PrivateKey, service.random)
+	if decoder, ok := signer.(crypto.KeyDecoder); ok && err == nil {
+		_, decodeSpan := service.tracer.Start(ctx, "Signer.DecodeKey", trace.WithAttributes(algorithm))
+		err = decoder.DecodeKey()
+		endSpan(decodeSpan, err)
+	}
+	var signedData []byte
+	if err == nil {
+		signedData, err = signer.Sign(data)
+	}
+	endSpan(span, err)
+	return signedData, err
+}
+
+// endSpan records err on span unless it is nil and ends span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedDevicesRepository wraps every call of a DevicesRepository in a span
+type tracedDevicesRepository struct {
+	next   DevicesRepository
+	tracer trace.Tracer
+}
+
+func (repo tracedDevicesRepository) start(
+	ctx context.Context,
+	operation string,
+	organizationID string,
+	deviceID string,
+) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{attribute.String(attributeOrganizationID, organizationID)}
+	if deviceID != "" {
+		attributes = append(attributes, attribute.String(attributeDeviceID, deviceID))
+	}
+	return repo.tracer.Start(
+		ctx,
+		"DevicesRepository."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+func (repo tracedDevicesRepository) Get(ctx context.Context, organizationID string, uuid string) (SignatureDevice, bool) {
+	ctx, span := repo.start(ctx, "Get", organizationID, uuid)
+	defer span.End()
+	device, found := repo.next.Get(ctx, organizationID, uuid)
+	span.SetAttributes(attribute.Bool("signing.found", found))
+	return device, found
+}
+
+func (repo tracedDevicesRepository) List(ctx context.Context, organizationID string, query DeviceQuery) []SignatureDevice {
+	ctx, span := repo.start(ctx, "List", organizationID, "")
+	defer span.End()
+	devices := repo.next.List(ctx, organizationID, query)
+	span.SetAttributes(attribute.Int("signing.devices", len(devices)))
+	return devices
+}
+
+func (repo tracedDevicesRepository) Create(ctx context.Context, device SignatureDevice, events ...Event) error {
+	ctx, span := repo.start(ctx, "Create", device.OrganizationID, device.UUID)
+	err := repo.next.Create(ctx, device, events...)
+	endSpan(span, err)
+	return err
+}
+
+func (repo tracedDevicesRepository) Update(ctx context.Context, device SignatureDevice, events ...Event) error {
+	ctx, span := repo.start(ctx, "Update", device.OrganizationID, device.UUID)
+	err := repo.next.Update(ctx, device, events...)
+	endSpan(span, err)
+	return err
+}
+
+func (repo tracedDevicesRepository) IncrementCounter(ctx context.Context, device SignatureDevice, events ...Event) error {
+	ctx, span := repo.start(ctx, "IncrementCounter", device.OrganizationID, device.UUID)
+	err := repo.next.IncrementCounter(ctx, device, events...)
+	endSpan(span, err)
+	return err
+}
+
+// CheckHealth passes the check on, the probes aren't traced
+func (repo tracedDevicesRepository) CheckHealth() error {
+	if checker, ok := repo.next.(HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	return nil
+}
+
+func (repo tracedDevicesRepository) CountDevices() []DeviceCount {
+	if counter, ok := repo.next.(DeviceCounter); ok {
+		return counter.CountDevices()
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTracedTestService(t *testing.T) (*DeviceService, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	service := newTestService(&testRepository{storage: make(map[string]SignatureDevice)})
+	service.SetTracerProvider(provider)
+	return service, exporter
+}
+
+func TestSignTransactionIsTraced(t *testing.T) {
+	for _, algorithm := range []Algorithm{ECC, RSA} {
+		service, exporter := newTracedTestService(t)
+		device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, algorithm, "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		exporter.Reset()
+		if _, err = service.SignTransaction(context.Background(), testOrganizationID, device.UUID, "receipt-4711"); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		spans := make(map[string]tracetest.SpanStub)
+		for _, span := range exporter.GetSpans() {
+			spans[span.Name] = span
+			for _, attribute := range span.Attributes {
+				if strings.Contains(attribute.Value.Emit(), "receipt-4711") {
+					t.Errorf("%s: span %s records the data to be signed", algorithm, span.Name)
+				}
+			}
+		}
+		root, found := spans["DeviceService.SignTransaction"]
+		if !found {
+			t.Fatalf("%s: SignTransaction isn't traced, spans %v", algorithm, exporter.GetSpans().Snapshots())
+		}
+		parents := map[string]string{
+			"DevicesRepository.Get":              "DeviceService.SignTransaction",
+			"Signer.Sign":                        "DeviceService.SignTransaction",
+			"Signer.DecodeKey":                   "Signer.Sign",
+			"DevicesRepository.IncrementCounter": "DeviceService.SignTransaction",
+		}
+		for name, parent := range parents {
+			span, found := spans[name]
+			if !found {
+				t.Errorf("%s: %s isn't traced", algorithm, name)
+				continue
+			}
+			if span.SpanContext.TraceID() != root.SpanContext.TraceID() || span.Parent.SpanID() != spans[parent].SpanContext.SpanID() {
+				t.Errorf("%s: %s isn't a child of %s", algorithm, name, parent)
+			}
+		}
+	}
+}
+
+func TestSignTransactionSpanRecordsErrors(t *testing.T) {
+	service, exporter := newTracedTestService(t)
+	if _, err := service.SignTransaction(context.Background(), testOrganizationID, "unknown", "receipt"); err == nil {
+		t.Fatalf("signing with an unknown device succeeded")
+	}
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "DeviceService.SignTransaction" {
+			if span.Status.Code != codes.Error || len(span.Events) == 0 {
+				t.Errorf("span has status %v and events %v, want the error", span.Status, span.Events)
+			}
+			return
+		}
+	}
+	t.Errorf("SignTransaction isn't traced")
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+const (
+	maxLabelLength    = 255
+	maxMetadataKeys   = 32
+	maxMetadataLength = 255
+	maxTags           = 32
+	maxTagLength      = 64
+)
+
+// ErrVersionConflict is returned when a device was modified since the client read it.
+var ErrVersionConflict = errors.New("signature device was modified concurrently")
+
+// SignatureDeviceUpdate holds the mutable fields of a SignatureDevice.
+// Nil fields are left unchanged, a nil Metadata value removes the key.
+type SignatureDeviceUpdate struct {
+	Version  int
+	Label    *string
+	Metadata map[string]*string
+	Tags     *[]string
+}
+
+// UpdateSignatureDevice applies update to the device if update.Version matches the stored version
+func (service *DeviceService) UpdateSignatureDevice(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	id string,
+	update SignatureDeviceUpdate,
+) (SignatureDevice, error) {
+	if err := update.validate(); err != nil {
+		return SignatureDevice{}, err
+	}
+
+	device, found := service.repo.Get(ctx, organizationID, id)
+	if !found {
+		return SignatureDevice{}, NotFoundError{"signature device", id}
+	}
+	if device.Version != update.Version {
+		return SignatureDevice{}, ErrVersionConflict
+	}
+	before := device
+
+	if update.Label != nil {
+		device.Label = *update.Label
+	}
+	if update.Metadata != nil {
+		device.Metadata = mergeMetadata(device.Metadata, update.Metadata)
+	}
+	if update.Tags != nil {
+		device.Tags = append([]string(nil), *update.Tags...)
+	}
+	if len(device.Metadata) > maxMetadataKeys {
+		return SignatureDevice{}, ValidationError{"metadata", fmt.Sprintf("at most %d keys are allowed", maxMetadataKeys)}
+	}
+
+	device, err := service.updateWithEvent(ctx, device, EventDeviceUpdated)
+	if err != nil {
+		return SignatureDevice{}, err
+	}
+	if err = service.audit.Record(organizationID, actor, AuditDeviceUpdated, id, before, device); err != nil {
+		return SignatureDevice{}, err
+	}
+	slog.InfoContext(ctx, "Updated signature device", "device", device, "actor", actor)
+	return device, nil
+}
+
+func (update SignatureDeviceUpdate) validate() error {
+	if update.Label != nil && len(*update.Label) > maxLabelLength {
+		return ValidationError{"label", fmt.Sprintf("must be at most %d characters", maxLabelLength)}
+	}
+	for key, value := range update.Metadata {
+		if strings.TrimSpace(key) == "" {
+			return ValidationError{"metadata", "keys must not be empty"}
+		}
+		if len(key) > maxMetadataLength || (value != nil && len(*value) > maxMetadataLength) {
+			return ValidationError{"metadata", fmt.Sprintf("keys and values must be at most %d characters", maxMetadataLength)}
+		}
+	}
+	if update.Tags == nil {
+		return nil
+	}
+	if len(*update.Tags) > maxTags {
+		return ValidationError{"tags", fmt.Sprintf("at most %d tags are allowed", maxTags)}
+	}
+	seen := make(map[string]bool, len(*update.Tags))
+	for _, tag := range *update.Tags {
+		if strings.TrimSpace(tag) == "" || len(tag) > maxTagLength {
+			return ValidationError{"tags", fmt.Sprintf("tags must be between 1 and %d characters", maxTagLength)}
+		}
+		if seen[tag] {
+			return ValidationError{"tags", fmt.Sprintf("duplicate tag %q", tag)}
+		}
+		seen[tag] = true
+	}
+	return nil
+}
+
+func mergeMetadata(current map[string]string, patch map[string]*string) map[string]string {
+	merged := make(map[string]string, len(current)+len(patch))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = *value
+	}
+	return merged
+}
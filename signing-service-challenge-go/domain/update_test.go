@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdateSignatureDevice(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := newTestService(&repo)
+	created, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "old")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	stored := repo.storage[created.UUID]
+	stored.Metadata = map[string]string{"store": "berlin", "till": "1"}
+	repo.storage[created.UUID] = stored
+
+	label := "new"
+	till := "2"
+	tags := []string{"front"}
+	device, err := service.UpdateSignatureDevice(context.Background(), testOrganizationID, testActor, created.UUID, SignatureDeviceUpdate{
+		Version:  created.Version,
+		Label:    &label,
+		Metadata: map[string]*string{"store": nil, "till": &till},
+		Tags:     &tags,
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if device.Label != "new" || !reflect.DeepEqual(device.Tags, tags) {
+		t.Errorf("label or tags weren't updated")
+	}
+	if !reflect.DeepEqual(device.Metadata, map[string]string{"till": "2"}) {
+		t.Errorf("Metadata = %v, want merged metadata", device.Metadata)
+	}
+	if device.Version != created.Version+1 || repo.storage[created.UUID].Version != device.Version {
+		t.Errorf("version wasn't incremented")
+	}
+}
+
+func TestUpdateSignatureDeviceVersionConflict(t *testing.T) {
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	service := newTestService(&repo)
+	created, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "old")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	label := "new"
+	_, err = service.UpdateSignatureDevice(context.Background(), testOrganizationID, testActor, created.UUID, SignatureDeviceUpdate{Version: created.Version + 1, Label: &label})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("UpdateSignatureDevice() error = %v, want %v", err, ErrVersionConflict)
+	}
+	if repo.storage[created.UUID].Label != "old" {
+		t.Errorf("stale update shouldn't be saved")
+	}
+}
+
+func TestSignatureDeviceUpdate_validate(t *testing.T) {
+	longLabel := strings.Repeat("a", maxLabelLength+1)
+	value := "value"
+	tests := []struct {
+		name    string
+		update  SignatureDeviceUpdate
+		wantErr bool
+	}{
+		{"empty update", SignatureDeviceUpdate{}, false},
+		{"label too long", SignatureDeviceUpdate{Label: &longLabel}, true},
+		{"empty metadata key", SignatureDeviceUpdate{Metadata: map[string]*string{" ": &value}}, true},
+		{"empty tag", SignatureDeviceUpdate{Tags: &[]string{""}}, true},
+		{"duplicate tag", SignatureDeviceUpdate{Tags: &[]string{"a", "a"}}, true},
+		{"valid tags", SignatureDeviceUpdate{Tags: &[]string{"a", "b"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.update.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
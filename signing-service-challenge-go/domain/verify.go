@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"context"
+	"encoding/base64"
+)
+
+// SignatureVerification identifies a signature by what SignTransaction was given and returned
+type SignatureVerification struct {
+	Data             string
+	SignatureCounter int
+	// Signature and PreviousSignature are base64url encoded as returned by SignTransaction,
+	// PreviousSignature is the one with the preceding counter and not needed for the first signature
+	Signature         string
+	PreviousSignature string
+}
+
+// VerifySignature reports whether the device created the signature, chained to the previous one
+func (service *DeviceService) VerifySignature(
+	ctx context.Context,
+	organizationID string,
+	id string,
+	verification SignatureVerification,
+) (bool, error) {
+	device, found := service.repo.Get(ctx, organizationID, id)
+	if !found {
+		return false, NotFoundError{"signature device", id}
+	}
+	return VerifySignature(device.UUID, device.Algorithm, device.PublicKey, verification)
+}
+
+// VerifySignature reports whether the signature was created with the private key of publicKey,
+// so clients holding the public key of a device can verify its signatures without the service
+func VerifySignature(
+	deviceID string,
+	algorithm Algorithm,
+	publicKey []byte,
+	verification SignatureVerification,
+) (bool, error) {
+	signature, err := base64.URLEncoding.DecodeString(verification.Signature)
+	if err != nil {
+		return false, ValidationError{"signature", "must be base64url encoded"}
+	}
+	if verification.SignatureCounter < 0 {
+		return false, ValidationError{"signature_counter", "must not be negative"}
+	}
+	// the first signature is chained to the device ID like in createSignatureDevice
+	lastSignature := []byte(base64.URLEncoding.EncodeToString([]byte(deviceID)))
+	if verification.SignatureCounter > 0 {
+		if lastSignature, err = base64.URLEncoding.DecodeString(verification.PreviousSignature); err != nil {
+			return false, ValidationError{"previous_signature", "must be base64url encoded"}
+		}
+		if len(lastSignature) == 0 {
+			return false, ValidationError{"previous_signature", "is required after the first signature"}
+		}
+	}
+
+	verifier, err := algorithm.Verifier(publicKey)
+	if err != nil {
+		return false, err
+	}
+	securedDataToBeSigned := buildSecuredDataToBeSigned(verification.SignatureCounter, verification.Data, lastSignature)
+	return verifier.Verify([]byte(securedDataToBeSigned), signature)
+}
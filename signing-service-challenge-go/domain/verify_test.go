@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVerifySignatureChain(t *testing.T) {
+	for _, algorithm := range []Algorithm{ECC, RSA} {
+		repo := testRepository{storage: make(map[string]SignatureDevice)}
+		service := newTestService(&repo)
+		device, err := service.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, algorithm, "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		first, err := service.SignTransaction(context.Background(), testOrganizationID, device.UUID, "first")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		second, err := service.SignTransaction(context.Background(), testOrganizationID, device.UUID, "second")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		tests := []struct {
+			name         string
+			verification SignatureVerification
+			want         bool
+		}{
+			{"first", SignatureVerification{"first", 0, first.Signature, ""}, true},
+			{"second", SignatureVerification{"second", 1, second.Signature, first.Signature}, true},
+			{"tampered data", SignatureVerification{"third", 1, second.Signature, first.Signature}, false},
+			{"wrong counter", SignatureVerification{"second", 2, second.Signature, first.Signature}, false},
+			{"broken chain", SignatureVerification{"second", 1, second.Signature, second.Signature}, false},
+		}
+		for _, test := range tests {
+			valid, err := service.VerifySignature(context.Background(), testOrganizationID, device.UUID, test.verification)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if valid != test.want {
+				t.Errorf("%s %s: VerifySignature() = %v, want %v", algorithm, test.name, valid, test.want)
+			}
+		}
+
+		if _, err = service.VerifySignature(context.Background(), testOrganizationID, device.UUID, SignatureVerification{"second", 1, second.Signature, ""}); err == nil {
+			t.Errorf("%s: VerifySignature() without the previous signature succeeded", algorithm)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC of "<timestamp>.<body>" keyed with the subscription secret
+	WebhookSignatureHeader = "Webhook-Signature"
+	// WebhookTimestampHeader carries the unix time the payload was signed at
+	WebhookTimestampHeader = "Webhook-Timestamp"
+	WebhookEventHeader     = "Webhook-Event"
+	WebhookDeliveryHeader  = "Webhook-Delivery"
+
+	minWebhookSecretLength = 16
+	// webhookDeliveryWorkers bounds the subscriptions DeliverDue delivers to concurrently
+	webhookDeliveryWorkers = 8
+	// WebhookDeliveryRetention is how long finished deliveries, dead letters included, stay in the delivery log
+	WebhookDeliveryRetention = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrDeliveryNotDead is returned when redelivering a delivery that isn't a dead letter.
+	ErrDeliveryNotDead = errors.New("only dead deliveries can be redelivered")
+	// ErrSubscriptionDeleted is returned when redelivering a dead letter of a deleted subscription.
+	ErrSubscriptionDeleted = errors.New("subscription of the delivery was deleted")
+)
+
+// DeliveryStatus is the state of a webhook delivery.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryDead marks deliveries that exhausted their attempts, they form the dead-letter list
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// WebhookRetryPolicy controls the exponential backoff of failed deliveries.
+type WebhookRetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultWebhookRetryPolicy retries for roughly a day before giving up
+var DefaultWebhookRetryPolicy = WebhookRetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     6 * time.Hour,
+}
+
+// Backoff returns the delay before the attempt following the given failed attempt
+func (policy WebhookRetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := policy.InitialBackoff
+	for i := 1; i < attempt && backoff < policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	return backoff
+}
+
+// WebhookSubscription sends events of the subscribed types to URL.
+type WebhookSubscription struct {
+	ID             string      `json:"id"`
+	OrganizationID string      `json:"organization_id"`
+	URL            string      `json:"url"`
+	EventTypes     []EventType `json:"event_types"`
+	Secret         string      `json:"-"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// WebhookDelivery is the delivery of one event to one subscription, including its log of attempts.
+type WebhookDelivery struct {
+	ID             string           `json:"id"`
+	OrganizationID string           `json:"organization_id"`
+	SubscriptionID string           `json:"subscription_id"`
+	EventID        string           `json:"event_id"`
+	EventType      EventType        `json:"event_type"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         DeliveryStatus   `json:"status"`
+	Attempts       []WebhookAttempt `json:"attempts"`
+	// FailedAttempts counts failures since the delivery was (re)scheduled and drives the backoff
+	FailedAttempts int        `json:"failed_attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	// ExpiresAt is set once the delivery succeeded or died, it is removed from the delivery log then
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// WebhookAttempt logs one HTTP request of a delivery.
+type WebhookAttempt struct {
+	AttemptedAt    time.Time `json:"attempted_at"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	DurationMillis int64     `json:"duration_ms"`
+}
+
+type WebhooksRepository interface {
+	CreateSubscription(subscription WebhookSubscription) error
+	GetSubscription(organizationID string, id string) (WebhookSubscription, bool)
+	GetSubscriptions(organizationID string) []WebhookSubscription
+	DeleteSubscription(organizationID string, id string) error
+	// SaveDelivery creates or replaces the delivery
+	SaveDelivery(delivery WebhookDelivery) error
+	GetDelivery(organizationID string, id string) (WebhookDelivery, bool)
+	// GetDeliveries returns deliveries of the subscription in creation order, an empty status matches all
+	GetDeliveries(organizationID string, subscriptionID string, status DeliveryStatus) []WebhookDelivery
+	// GetDueDeliveries returns pending deliveries of all organizations due at now in creation order,
+	// it runs every delivery interval, so it should only cost in proportion to the due deliveries
+	GetDueDeliveries(now time.Time) []WebhookDelivery
+	// DeleteExpiredDeliveries removes the deliveries that expired at now
+	DeleteExpiredDeliveries(now time.Time)
+}
+
+// WebhookService manages webhook subscriptions and delivers published events to them.
+type WebhookService struct {
+	repo   WebhooksRepository
+	audit  *AuditLog
+	client *http.Client
+	policy WebhookRetryPolicy
+	random io.Reader
+	clock  Clock
+	// addresses restricts the hosts subscriptions may target
+	addresses WebhookAddressPolicy
+	// delivering serializes delivery runs, so a delivery is never sent twice concurrently
+	delivering sync.Mutex
+}
+
+// NewWebhookService is a factory to instantiate a new WebhookService.
+func NewWebhookService(
+	repo WebhooksRepository,
+	audit *AuditLog,
+	client *http.Client,
+	policy WebhookRetryPolicy,
+	random io.Reader,
+	clock Clock,
+) *WebhookService {
+	return &WebhookService{
+		repo:   repo,
+		audit:  audit,
+		client: client,
+		policy: policy,
+		random: random,
+		clock:  clock,
+	}
+}
+
+// SetAddressPolicy replaces the policy subscription URLs are checked against, by default only public addresses
+// are allowed. Deliveries are checked by the dialer of the HTTP client, see NewWebhookHTTPClient.
+func (service *WebhookService) SetAddressPolicy(policy WebhookAddressPolicy) {
+	service.addresses = policy
+}
+
+// CreateSubscription registers url for the event types on behalf of actor.
+// The host of url must resolve to addresses the address policy allows.
+func (service *WebhookService) CreateSubscription(
+	ctx context.Context,
+	organizationID string,
+	actor string,
+	rawURL string,
+	eventTypes []string,
+	secret string,
+) (WebhookSubscription, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return WebhookSubscription{}, ValidationError{"url", "must be an absolute http or https URL"}
+	}
+	if _, err = service.addresses.resolve(ctx, parsedURL.Hostname()); errors.Is(err, ErrWebhookAddressNotAllowed) {
+		return WebhookSubscription{}, ValidationError{"url", "must not resolve to loopback, private or link-local addresses"}
+	} else if err != nil {
+		return WebhookSubscription{}, ValidationError{"url", "host can't be resolved"}
+	}
+	if len(eventTypes) == 0 {
+		return WebhookSubscription{}, ValidationError{"event_types", "at least one event type is required"}
+	}
+	parsedEventTypes := make([]EventType, 0, len(eventTypes))
+	for _, s := range eventTypes {
+		eventType, err := ParseEventType(s)
+		if err != nil {
+			return WebhookSubscription{}, ValidationError{"event_types", err.Error()}
+		}
+		parsedEventTypes = append(parsedEventTypes, eventType)
+	}
+	if len(secret) < minWebhookSecretLength {
+		return WebhookSubscription{}, ValidationError{"secret", fmt.Sprintf("must be at least %d characters", minWebhookSecretLength)}
+	}
+
+	id, err := uuid.NewRandomFromReader(service.random)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	subscription := WebhookSubscription{
+		ID:             id.String(),
+		OrganizationID: organizationID,
+		URL:            parsedURL.String(),
+		EventTypes:     parsedEventTypes,
+		Secret:         secret,
+		CreatedAt:      service.clock.Now(),
+	}
+	if err = service.repo.CreateSubscription(subscription); err != nil {
+		return WebhookSubscription{}, err
+	}
+	err = service.audit.Record(organizationID, actor, AuditWebhookCreated, subscription.ID, nil, subscription)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	return subscription, nil
+}
+
+// GetSubscription returns stored WebhookSubscription of the organization by id
+func (service *WebhookService) GetSubscription(organizationID string, id string) (WebhookSubscription, bool) {
+	return service.repo.GetSubscription(organizationID, id)
+}
+
+// ListSubscriptions returns all stored WebhookSubscription of the organization
+func (service *WebhookService) ListSubscriptions(organizationID string) []WebhookSubscription {
+	return service.repo.GetSubscriptions(organizationID)
+}
+
+// DeleteSubscription stops deliveries to the subscription, pending deliveries become dead letters
+func (service *WebhookService) DeleteSubscription(organizationID string, actor string, id string) error {
+	subscription, found := service.repo.GetSubscription(organizationID, id)
+	if !found {
+		return NotFoundError{"webhook subscription", id}
+	}
+	if err := service.repo.DeleteSubscription(organizationID, id); err != nil {
+		return err
+	}
+	return service.audit.Record(organizationID, actor, AuditWebhookDeleted, id, subscription, nil)
+}
+
+// ListDeliveries returns the delivery log of the subscription, filtered by status if given
+func (service *WebhookService) ListDeliveries(
+	organizationID string,
+	subscriptionID string,
+	status DeliveryStatus,
+) []WebhookDelivery {
+	return service.repo.GetDeliveries(organizationID, subscriptionID, status)
+}
+
+// RedeliverDeadLetter schedules a dead delivery of the subscription for another round of attempts
+func (service *WebhookService) RedeliverDeadLetter(
+	organizationID string,
+	subscriptionID string,
+	id string,
+) (WebhookDelivery, error) {
+	delivery, found := service.repo.GetDelivery(organizationID, id)
+	if !found || delivery.SubscriptionID != subscriptionID {
+		return WebhookDelivery{}, NotFoundError{"webhook delivery", id}
+	}
+	if delivery.Status != DeliveryDead {
+		return WebhookDelivery{}, fmt.Errorf("webhook delivery %q is %s: %w", id, delivery.Status, ErrDeliveryNotDead)
+	}
+	if _, found = service.repo.GetSubscription(organizationID, delivery.SubscriptionID); !found {
+		return WebhookDelivery{}, ErrSubscriptionDeleted
+	}
+
+	now := service.clock.Now()
+	delivery.Status = DeliveryPending
+	delivery.FailedAttempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.ExpiresAt = nil
+	if err := service.repo.SaveDelivery(delivery); err != nil {
+		return WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// Name identifies the webhooks as EventSink
+func (service *WebhookService) Name() string {
+	return "webhooks"
+}
+
+// Deliver queues a delivery of event for every subscription of its organization and type
+func (service *WebhookService) Deliver(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := service.clock.Now()
+	for _, subscription := range service.repo.GetSubscriptions(event.OrganizationID) {
+		if !subscription.subscribes(event.Type) {
+			continue
+		}
+		id, err := uuid.NewRandomFromReader(service.random)
+		if err != nil {
+			return err
+		}
+		err = service.repo.SaveDelivery(WebhookDelivery{
+			ID:             id.String(),
+			OrganizationID: event.OrganizationID,
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         DeliveryPending,
+			Attempts:       []WebhookAttempt{},
+			NextAttemptAt:  &now,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run delivers due deliveries every interval until ctx is done
+func (service *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.DeliverDue(ctx)
+		}
+	}
+}
+
+// DeliverDue sends every delivery that is due and schedules retries of failed ones.
+// Subscriptions are delivered to concurrently by a bounded pool of workers, deliveries of one subscription
+// are sent in order, so a slow receiver only holds up its own deliveries.
+// Finished deliveries older than WebhookDeliveryRetention are removed.
+func (service *WebhookService) DeliverDue(ctx context.Context) {
+	service.delivering.Lock()
+	defer service.delivering.Unlock()
+
+	now := service.clock.Now()
+	service.repo.DeleteExpiredDeliveries(now)
+	var queues [][]WebhookDelivery
+	queueOf := make(map[string]int)
+	for _, delivery := range service.repo.GetDueDeliveries(now) {
+		i, found := queueOf[delivery.SubscriptionID]
+		if !found {
+			i = len(queues)
+			queueOf[delivery.SubscriptionID] = i
+			queues = append(queues, nil)
+		}
+		queues[i] = append(queues[i], delivery)
+	}
+
+	work := make(chan []WebhookDelivery)
+	var workers sync.WaitGroup
+	for i := 0; i < min(webhookDeliveryWorkers, len(queues)); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for queue := range work {
+				for _, delivery := range queue {
+					if ctx.Err() != nil {
+						break
+					}
+					service.deliver(ctx, delivery)
+				}
+			}
+		}()
+	}
+	for _, queue := range queues {
+		work <- queue
+	}
+	close(work)
+	workers.Wait()
+}
+
+func (service *WebhookService) deliver(ctx context.Context, delivery WebhookDelivery) {
+	subscription, found := service.repo.GetSubscription(delivery.OrganizationID, delivery.SubscriptionID)
+	if !found {
+		service.repo.SaveDelivery(delivery.finish(DeliveryDead, service.clock.Now()))
+		return
+	}
+
+	attempt := service.send(ctx, subscription, delivery)
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	if attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300 {
+		service.repo.SaveDelivery(delivery.finish(DeliverySucceeded, attempt.AttemptedAt))
+		return
+	}
+
+	delivery.FailedAttempts++
+	if delivery.FailedAttempts >= service.policy.MaxAttempts {
+		delivery = delivery.finish(DeliveryDead, attempt.AttemptedAt)
+	} else {
+		next := attempt.AttemptedAt.Add(service.policy.Backoff(delivery.FailedAttempts))
+		delivery.NextAttemptAt = &next
+	}
+	service.repo.SaveDelivery(delivery)
+}
+
+// finish ends the attempts of the delivery with status at finishedAt
+func (delivery WebhookDelivery) finish(status DeliveryStatus, finishedAt time.Time) WebhookDelivery {
+	expiresAt := finishedAt.Add(WebhookDeliveryRetention)
+	delivery.Status = status
+	delivery.NextAttemptAt = nil
+	delivery.ExpiresAt = &expiresAt
+	return delivery
+}
+
+func (service *WebhookService) send(
+	ctx context.Context,
+	subscription WebhookSubscription,
+	delivery WebhookDelivery,
+) WebhookAttempt {
+	attempt := WebhookAttempt{AttemptedAt: service.clock.Now()}
+	request, err := http.NewRequestWithContext(ctx, "POST", subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := strconv.FormatInt(attempt.AttemptedAt.Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookEventHeader, string(delivery.EventType))
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(subscription.Secret, timestamp, delivery.Payload))
+
+	started := time.Now()
+	response, err := service.client.Do(request)
+	attempt.DurationMillis = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	attempt.StatusCode = response.StatusCode
+	return attempt
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 receivers recompute to verify a delivery
+func SignWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (subscription WebhookSubscription) subscribes(eventType EventType) bool {
+	for _, subscribed := range subscription.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
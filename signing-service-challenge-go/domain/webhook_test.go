@@ -0,0 +1,496 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "0123456789abcdef"
+
+// allowAllAddresses lets tests deliver to receivers on loopback
+var allowAllAddresses = WebhookAddressPolicy{Allowed: func(net.IP) bool { return true }}
+
+// testResolver resolves the hosts it knows without DNS
+type testResolver map[string][]string
+
+func (resolver testResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addresses, found := resolver[host]
+	if !found {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	ipAddresses := make([]net.IPAddr, 0, len(addresses))
+	for _, address := range addresses {
+		ipAddresses = append(ipAddresses, net.IPAddr{IP: net.ParseIP(address)})
+	}
+	return ipAddresses, nil
+}
+
+type testWebhooksRepository struct {
+	subscriptions map[string]WebhookSubscription
+	deliveries    []WebhookDelivery
+	// mutex guards concurrent deliveries
+	mutex sync.Mutex
+}
+
+func (repo *testWebhooksRepository) CreateSubscription(subscription WebhookSubscription) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.subscriptions[subscription.ID] = subscription
+	return nil
+}
+func (repo *testWebhooksRepository) GetSubscription(organizationID string, id string) (WebhookSubscription, bool) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	subscription, found := repo.subscriptions[id]
+	return subscription, found && subscription.OrganizationID == organizationID
+}
+func (repo *testWebhooksRepository) GetSubscriptions(organizationID string) []WebhookSubscription {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	subscriptions := make([]WebhookSubscription, 0)
+	for _, subscription := range repo.subscriptions {
+		if subscription.OrganizationID == organizationID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+func (repo *testWebhooksRepository) DeleteSubscription(organizationID string, id string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	delete(repo.subscriptions, id)
+	return nil
+}
+func (repo *testWebhooksRepository) SaveDelivery(delivery WebhookDelivery) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for i := range repo.deliveries {
+		if repo.deliveries[i].ID == delivery.ID {
+			repo.deliveries[i] = delivery
+			return nil
+		}
+	}
+	repo.deliveries = append(repo.deliveries, delivery)
+	return nil
+}
+func (repo *testWebhooksRepository) GetDelivery(organizationID string, id string) (WebhookDelivery, bool) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for _, delivery := range repo.deliveries {
+		if delivery.ID == id && delivery.OrganizationID == organizationID {
+			return delivery, true
+		}
+	}
+	return WebhookDelivery{}, false
+}
+func (repo *testWebhooksRepository) GetDeliveries(
+	organizationID string,
+	subscriptionID string,
+	status DeliveryStatus,
+) []WebhookDelivery {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	deliveries := make([]WebhookDelivery, 0)
+	for _, delivery := range repo.deliveries {
+		if delivery.SubscriptionID == subscriptionID && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+func (repo *testWebhooksRepository) GetDueDeliveries(now time.Time) []WebhookDelivery {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	deliveries := make([]WebhookDelivery, 0)
+	for _, delivery := range repo.deliveries {
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
+func (repo *testWebhooksRepository) DeleteExpiredDeliveries(now time.Time) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	kept := repo.deliveries[:0]
+	for _, delivery := range repo.deliveries {
+		if delivery.ExpiresAt == nil || now.Before(*delivery.ExpiresAt) {
+			kept = append(kept, delivery)
+		}
+	}
+	repo.deliveries = kept
+}
+
+// testReceiver records webhook requests and answers with status
+type testReceiver struct {
+	mutex    sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (receiver *testReceiver) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	body, _ := io.ReadAll(request.Body)
+	receiver.requests = append(receiver.requests, request)
+	receiver.bodies = append(receiver.bodies, body)
+	response.WriteHeader(receiver.status)
+}
+
+func newWebhookTestService(
+	t *testing.T,
+	clock Clock,
+	receiver *testReceiver,
+	eventTypes []string,
+) (*WebhookService, WebhookSubscription) {
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	policy := WebhookRetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	repo := &testWebhooksRepository{subscriptions: make(map[string]WebhookSubscription)}
+	service := NewWebhookService(repo, newTestAuditLog(), server.Client(), policy, rand.Reader, clock)
+	service.SetAddressPolicy(allowAllAddresses)
+	subscription, err := service.CreateSubscription(
+		context.Background(),
+		testOrganizationID,
+		testActor,
+		server.URL,
+		eventTypes,
+		testWebhookSecret,
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return service, subscription
+}
+
+func TestWebhookDeliversSignedEvents(t *testing.T) {
+	receiver := &testReceiver{status: http.StatusNoContent}
+	webhooks, subscription := newWebhookTestService(t, SystemClock{}, receiver, []string{"signature.created"})
+	repo := testRepository{storage: make(map[string]SignatureDevice)}
+	devices := NewDeviceService(&repo, newTestIdempotencyRepository(), newTestAuditLog(), DefaultKeyPolicy, rand.Reader, SystemClock{})
+
+	device, err := devices.CreateSignatureDevice(context.Background(), testOrganizationID, testActor, Algorithm(1), "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = devices.SignTransaction(context.Background(), testOrganizationID, device.UUID, "message"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, event := range repo.events {
+		if err = webhooks.Deliver(event); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	webhooks.DeliverDue(context.Background())
+
+	if len(receiver.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want only the signature event", len(receiver.requests))
+	}
+	request, body := receiver.requests[0], receiver.bodies[0]
+	signature := "sha256=" + SignWebhookPayload(testWebhookSecret, request.Header.Get(WebhookTimestampHeader), body)
+	if request.Header.Get(WebhookSignatureHeader) != signature {
+		t.Errorf("signature header = %q, want %q", request.Header.Get(WebhookSignatureHeader), signature)
+	}
+	var event struct {
+		Type     EventType            `json:"type"`
+		DeviceID string               `json:"device_id"`
+		Data     SignatureCreatedData `json:"data"`
+	}
+	if err = json.Unmarshal(body, &event); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if event.Type != EventSignatureCreated || event.DeviceID != device.UUID || event.Data.Signature == "" {
+		t.Errorf("payload = %s, want the signature of device %s", body, device.UUID)
+	}
+
+	deliveries := webhooks.ListDeliveries(testOrganizationID, subscription.ID, DeliverySucceeded)
+	if len(deliveries) != 1 || deliveries[0].Attempts[0].StatusCode != http.StatusNoContent {
+		t.Errorf("ListDeliveries() = %+v, want one successful delivery", deliveries)
+	}
+}
+
+func TestWebhookRetriesWithBackoffIntoDeadLetters(t *testing.T) {
+	clock := &manualClock{now: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	receiver := &testReceiver{status: http.StatusInternalServerError}
+	webhooks, subscription := newWebhookTestService(t, clock, receiver, []string{"device.created"})
+	webhooks.Deliver(Event{ID: "event", Type: EventDeviceCreated, OrganizationID: testOrganizationID})
+	webhooks.Deliver(Event{ID: "other", Type: EventDeviceCreated, OrganizationID: "other"})
+
+	started := clock.now
+	webhooks.DeliverDue(context.Background())
+	delivery := webhooks.ListDeliveries(testOrganizationID, subscription.ID, DeliveryPending)[0]
+	if !delivery.NextAttemptAt.Equal(started.Add(time.Minute)) {
+		t.Errorf("first retry at %v, want %v", delivery.NextAttemptAt, started.Add(time.Minute))
+	}
+
+	clock.now = started.Add(59 * time.Second)
+	webhooks.DeliverDue(context.Background())
+	if len(receiver.requests) != 1 {
+		t.Errorf("receiver got %d requests before the backoff passed, want 1", len(receiver.requests))
+	}
+
+	clock.now = started.Add(time.Minute)
+	webhooks.DeliverDue(context.Background())
+	delivery = webhooks.ListDeliveries(testOrganizationID, subscription.ID, DeliveryPending)[0]
+	if !delivery.NextAttemptAt.Equal(clock.now.Add(2 * time.Minute)) {
+		t.Errorf("second retry at %v, want doubled backoff", delivery.NextAttemptAt)
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	webhooks.DeliverDue(context.Background())
+	deadLetters := webhooks.ListDeliveries(testOrganizationID, subscription.ID, DeliveryDead)
+	if len(deadLetters) != 1 || len(deadLetters[0].Attempts) != 3 || deadLetters[0].NextAttemptAt != nil {
+		t.Fatalf("dead letters = %+v, want the delivery after 3 attempts", deadLetters)
+	}
+
+	receiver.status = http.StatusOK
+	if _, err := webhooks.RedeliverDeadLetter(testOrganizationID, subscription.ID, deadLetters[0].ID); err != nil {
+		t.Fatalf(err.Error())
+	}
+	webhooks.DeliverDue(context.Background())
+	delivered := webhooks.ListDeliveries(testOrganizationID, subscription.ID, DeliverySucceeded)
+	if len(delivered) != 1 || len(delivered[0].Attempts) != 4 {
+		t.Errorf("redelivered = %+v, want success keeping the attempt log", delivered)
+	}
+}
+
+func TestRedeliverDeadLetterConflicts(t *testing.T) {
+	clock := &manualClock{now: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	receiver := &testReceiver{status: http.StatusInternalServerError}
+	webhooks, subscription := newWebhookTestService(t, clock, receiver, []string{"device.created"})
+	webhooks.Deliver(Event{ID: "event", Type: EventDeviceCreated, OrganizationID: testOrganizationID})
+
+	webhooks.DeliverDue(context.Background())
+	pending := webhooks.ListDeliveries(testOrganizationID, subscription.ID, DeliveryPending)[0]
+	if _, err := webhooks.RedeliverDeadLetter(testOrganizationID, subscription.ID, pending.ID); !errors.Is(err, ErrDeliveryNotDead) {
+		t.Errorf("redelivering a pending delivery returned %v, want %v", err, ErrDeliveryNotDead)
+	}
+
+	for _, backoff := range []time.Duration{time.Minute, 2 * time.Minute} {
+		clock.now = clock.now.Add(backoff)
+		webhooks.DeliverDue(context.Background())
+	}
+	if err := webhooks.DeleteSubscription(testOrganizationID, testActor, subscription.ID); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := webhooks.RedeliverDeadLetter(testOrganizationID, subscription.ID, pending.ID); !errors.Is(err, ErrSubscriptionDeleted) {
+		t.Errorf("redelivering to a deleted subscription returned %v, want %v", err, ErrSubscriptionDeleted)
+	}
+}
+
+func TestWebhookRemovesFinishedDeliveriesAfterRetention(t *testing.T) {
+	clock := &manualClock{now: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	receiver := &testReceiver{status: http.StatusOK}
+	webhooks, subscription := newWebhookTestService(t, clock, receiver, []string{"device.created"})
+	webhooks.Deliver(Event{ID: "event", Type: EventDeviceCreated, OrganizationID: testOrganizationID})
+
+	finished := clock.now
+	webhooks.DeliverDue(context.Background())
+	delivered := webhooks.ListDeliveries(testOrganizationID, subscription.ID, DeliverySucceeded)
+	if len(delivered) != 1 || delivered[0].ExpiresAt == nil || !delivered[0].ExpiresAt.Equal(finished.Add(WebhookDeliveryRetention)) {
+		t.Fatalf("delivered = %+v, want a delivery expiring after the retention", delivered)
+	}
+
+	clock.now = finished.Add(WebhookDeliveryRetention - time.Second)
+	webhooks.DeliverDue(context.Background())
+	if deliveries := webhooks.ListDeliveries(testOrganizationID, subscription.ID, ""); len(deliveries) != 1 {
+		t.Errorf("delivery was removed before it expired")
+	}
+	clock.now = finished.Add(WebhookDeliveryRetention)
+	webhooks.DeliverDue(context.Background())
+	if deliveries := webhooks.ListDeliveries(testOrganizationID, subscription.ID, ""); len(deliveries) != 0 {
+		t.Errorf("ListDeliveries() = %+v, want the expired delivery removed", deliveries)
+	}
+}
+
+func TestWebhookRetryPolicyBackoff(t *testing.T) {
+	policy := WebhookRetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{60, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got := policy.Backoff(test.attempt); got != test.want {
+			t.Errorf("Backoff(%d) = %v, want %v", test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestCreateWebhookSubscriptionInvalid(t *testing.T) {
+	repo := &testWebhooksRepository{subscriptions: make(map[string]WebhookSubscription)}
+	service := NewWebhookService(repo, newTestAuditLog(), http.DefaultClient, DefaultWebhookRetryPolicy, rand.Reader, SystemClock{})
+	service.SetAddressPolicy(WebhookAddressPolicy{Resolver: testResolver{
+		"example.com":          {"93.184.215.14"},
+		"internal.example.com": {"192.168.1.10"},
+		"rebound.example.com":  {"93.184.215.14", "127.0.0.1"},
+	}})
+	if _, err := service.CreateSubscription(
+		context.Background(),
+		testOrganizationID,
+		testActor,
+		"https://example.com/hook",
+		[]string{"device.created"},
+		testWebhookSecret,
+	); err != nil {
+		t.Fatalf("public URL should be accepted, got %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		eventTypes []string
+		secret     string
+	}{
+		{"relative url", "/hook", []string{"device.created"}, testWebhookSecret},
+		{"loopback", "http://127.0.0.1:8080/hook", []string{"device.created"}, testWebhookSecret},
+		{"IPv6 loopback", "http://[::1]/hook", []string{"device.created"}, testWebhookSecret},
+		{"cloud metadata", "http://169.254.169.254/latest/meta-data", []string{"device.created"}, testWebhookSecret},
+		{"private network", "http://10.0.0.1/hook", []string{"device.created"}, testWebhookSecret},
+		{"host resolving to a private network", "https://internal.example.com", []string{"device.created"}, testWebhookSecret},
+		{"host resolving to loopback among others", "https://rebound.example.com", []string{"device.created"}, testWebhookSecret},
+		{"unresolvable host", "https://unknown.example.com", []string{"device.created"}, testWebhookSecret},
+		{"unsupported scheme", "ftp://example.com", []string{"device.created"}, testWebhookSecret},
+		{"no event types", "https://example.com", nil, testWebhookSecret},
+		{"unknown event type", "https://example.com", []string{"device.deleted"}, testWebhookSecret},
+		{"short secret", "https://example.com", []string{"device.created"}, "secret"},
+	}
+	for _, test := range tests {
+		_, err := service.CreateSubscription(context.Background(), testOrganizationID, testActor, test.url, test.eventTypes, test.secret)
+		if err == nil {
+			t.Errorf("%s: CreateSubscription() succeeded, want error", test.name)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, test := range tests {
+		if got := IsPublicIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestWebhookHTTPClientRefusesNonPublicAddresses(t *testing.T) {
+	receiver := &testReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// the host passed the check when subscribing but resolves to loopback by the time of the delivery
+	client := NewWebhookHTTPClient(time.Second, WebhookAddressPolicy{Resolver: testResolver{"rebound.example.com": {"127.0.0.1"}}})
+	for _, url := range []string{server.URL, "http://rebound.example.com:" + port} {
+		_, err := client.Post(url, "application/json", nil)
+		if !errors.Is(err, ErrWebhookAddressNotAllowed) {
+			t.Errorf("POST %s error = %v, want %v", url, err, ErrWebhookAddressNotAllowed)
+		}
+	}
+	if len(receiver.requests) != 0 {
+		t.Errorf("receiver on loopback got %d requests", len(receiver.requests))
+	}
+
+	allowed := NewWebhookHTTPClient(time.Second, allowAllAddresses)
+	response, err := allowed.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	response.Body.Close()
+}
+
+// blockingReceiver holds requests until release is closed
+type blockingReceiver struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (receiver *blockingReceiver) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	receiver.entered <- struct{}{}
+	<-receiver.release
+	response.WriteHeader(http.StatusOK)
+}
+
+func TestWebhookDeliversToSubscriptionsConcurrently(t *testing.T) {
+	slow := &blockingReceiver{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	slowServer := httptest.NewServer(slow)
+	defer slowServer.Close()
+	fast := &testReceiver{status: http.StatusOK}
+	fastServer := httptest.NewServer(fast)
+	defer fastServer.Close()
+
+	repo := &testWebhooksRepository{subscriptions: make(map[string]WebhookSubscription)}
+	service := NewWebhookService(repo, newTestAuditLog(), http.DefaultClient, DefaultWebhookRetryPolicy, rand.Reader, SystemClock{})
+	service.SetAddressPolicy(allowAllAddresses)
+	for _, url := range []string{slowServer.URL, fastServer.URL} {
+		_, err := service.CreateSubscription(context.Background(), testOrganizationID, testActor, url, []string{"device.created"}, testWebhookSecret)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for _, id := range []string{"first", "second"} {
+		if err := service.Deliver(Event{ID: id, Type: EventDeviceCreated, OrganizationID: testOrganizationID}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	delivered := make(chan struct{})
+	go func() {
+		service.DeliverDue(context.Background())
+		close(delivered)
+	}()
+	<-slow.entered
+	// the fast receiver gets both events while the slow one still holds the first
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fast.mutex.Lock()
+		received := len(fast.requests)
+		fast.mutex.Unlock()
+		if received == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("fast receiver got %d requests while the slow one was blocked, want 2", received)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(slow.release)
+	<-slow.entered
+	<-delivered
+}
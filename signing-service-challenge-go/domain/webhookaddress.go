@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrWebhookAddressNotAllowed is returned for webhook hosts resolving to loopback, private or otherwise
+// non-public addresses, so tenants can't make the service call into its own network.
+var ErrWebhookAddressNotAllowed = errors.New("webhook host doesn't resolve to public addresses only")
+
+// nonPublicNetworks complements the net.IP predicates with reserved ranges that aren't routed publicly
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+}
+
+// HostResolver looks up the addresses of a host, net.DefaultResolver implements it
+type HostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// WebhookAddressPolicy decides which addresses webhooks may be delivered to.
+// The zero value resolves hosts with net.DefaultResolver and only allows public addresses.
+type WebhookAddressPolicy struct {
+	Resolver HostResolver
+	// Allowed replaces IsPublicIP, e.g. to deliver to loopback receivers in tests
+	Allowed func(ip net.IP) bool
+}
+
+// IsPublicIP reports whether ip is publicly routable, it rejects loopback, RFC 1918 and unique local,
+// link-local (including the cloud metadata address 169.254.169.254), multicast and other reserved addresses
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// DialContext dials only allowed addresses of the host. It resolves the host itself and connects to the
+// checked address, so a DNS answer changing between the check and the connection can't slip through.
+func (policy WebhookAddressPolicy) DialContext(
+	dialer *net.Dialer,
+) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := policy.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var errs []error
+		for _, ip := range ips {
+			connection, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return connection, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// NewWebhookHTTPClient returns a client for webhook deliveries that only connects to addresses policy allows
+func NewWebhookHTTPClient(timeout time.Duration, policy WebhookAddressPolicy) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would connect to the receiver on the service's behalf, bypassing the check
+	transport.Proxy = nil
+	transport.DialContext = policy.DialContext(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// resolve returns the addresses of host and fails unless all of them are allowed
+func (policy WebhookAddressPolicy) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		resolver := policy.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		addresses, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("host %q has no addresses", host)
+	}
+
+	allowed := policy.Allowed
+	if allowed == nil {
+		allowed = IsPublicIP
+	}
+	for _, ip := range ips {
+		if !allowed(ip) {
+			return nil, fmt.Errorf("host %q resolves to %s: %w", host, ip, ErrWebhookAddressNotAllowed)
+		}
+	}
+	return ips, nil
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
@@ -0,0 +1,132 @@
+// Package logging carries request IDs through a context.Context into structured log records.
+//
+// Loggers built on Handler add the request ID and the OpenTelemetry span of the context to every record logged
+// with one of the *Context functions of log/slog, and redact attributes that could hold data to be signed or
+// key material.
+package logging
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"strings"
+	"unicode"
+)
+
+// RequestIDKey is the attribute of the request ID in log records.
+const RequestIDKey = "request_id"
+
+// Attributes correlating log records with the span they were logged in
+const (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+)
+
+// MaxRequestIDLength limits request IDs chosen by clients.
+const MaxRequestIDLength = 128
+
+// redactedKeys are attributes that must never reach the log, whatever is logged under them.
+// Keys are compared in lower case, so "Authorization" headers are redacted too.
+var redactedKeys = map[string]bool{
+	"api_key":       true,
+	"authorization": true,
+	"data":          true,
+	"private_key":   true,
+	"privatekey":    true,
+	"secret":        true,
+	"token":         true,
+}
+
+const redacted = "<redacted>"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID ctx carries, "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// ValidRequestID reports whether a request ID chosen by a client may be used, it must be short printable ASCII
+// so it can't forge log lines.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) || r == ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler adds the request ID and span of the context to records and redacts sensitive attributes before passing them on.
+type Handler struct {
+	next slog.Handler
+}
+
+// NewHandler wraps next.
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{next: next}
+}
+
+func (handler *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return handler.next.Enabled(ctx, level)
+}
+
+func (handler *Handler) Handle(ctx context.Context, record slog.Record) error {
+	// records can't drop attributes, so a copy is built
+	handled := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		handled.AddAttrs(redact(attr))
+		return true
+	})
+	if id := RequestID(ctx); id != "" {
+		handled.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		handled.AddAttrs(slog.String(TraceIDKey, span.TraceID().String()), slog.String(SpanIDKey, span.SpanID().String()))
+	}
+	return handler.next.Handle(ctx, handled)
+}
+
+func (handler *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redactedAttrs[i] = redact(attr)
+	}
+	return &Handler{next: handler.next.WithAttrs(redactedAttrs)}
+}
+
+func (handler *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: handler.next.WithGroup(name)}
+}
+
+// redact replaces sensitive attributes, also inside groups and values implementing slog.LogValuer
+func redact(attr slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redacted)
+	}
+	value := attr.Value.Resolve()
+	if value.Kind() != slog.KindGroup {
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+	group := value.Group()
+	redactedGroup := make([]slog.Attr, len(group))
+	for i, member := range group {
+		redactedGroup[i] = redact(member)
+	}
+	return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redactedGroup...)}
+}
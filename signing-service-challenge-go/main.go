@@ -1,22 +1,262 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/config"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
-)
-
-const (
-	ListenAddress = ":8080"
-	// TODO: add further configuration parameters here ...
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/rpc"
 )
 
 func main() {
+	cfg, printConfig, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if printConfig {
+		if err = cfg.Write(os.Stdout); err != nil {
+			fatal("Could not print configuration", err)
+		}
+		return
+	}
+	// the standard logger writes through the configured handler too, so all records are redacted
+	slog.SetDefault(cfg.Logging.NewLogger(os.Stderr))
+	keyPolicy, _ := cfg.Keys.Policy()
+
+	// storage.backend is validated, memory is the only backend so far
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
 	devicesRepo := persistence.NewInMemoryDevicesRepository()
-	server := api.NewServer(ListenAddress, devicesRepo)
+	devicesRepo.SetHistoryRetention(time.Duration(cfg.Events.HistoryRetention))
+	idempotencyRepo := persistence.NewInMemoryIdempotencyRepository()
+	webhookService := domain.NewWebhookService(
+		persistence.NewInMemoryWebhooksRepository(),
+		auditLog,
+		domain.NewWebhookHTTPClient(time.Duration(cfg.Webhooks.Timeout), domain.WebhookAddressPolicy{}),
+		domain.DefaultWebhookRetryPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	// background work stops only after the servers drained, so the last signatures still get dispatched
+	background, stopBackground := context.WithCancel(context.Background())
+	var backgroundDone sync.WaitGroup
+	backgroundDone.Add(3)
+	go func() {
+		defer backgroundDone.Done()
+		webhookService.Run(background, time.Duration(cfg.Webhooks.DeliveryInterval))
+	}()
+
+	eventStream := domain.NewEventStream(devicesRepo)
+	sinks := []domain.EventSink{webhookService, eventStream}
+	if cfg.Events.Log {
+		sinks = append(sinks, domain.NewLogSink(slog.Default()))
+	}
+	dispatcher := domain.NewEventDispatcher(devicesRepo, cfg.Events.DispatchBatchSize, sinks...)
+	go func() {
+		defer backgroundDone.Done()
+		dispatcher.Run(background, time.Duration(cfg.Events.DispatchInterval), func(err error) {
+			slog.Warn("Could not dispatch events, retrying", "error", err)
+		})
+	}()
+	go func() {
+		defer backgroundDone.Done()
+		auditLog.Run(background, domain.AuditRetryInterval, func(err error) {
+			slog.Warn("Could not write pending audit entries, retrying", "error", err)
+		})
+	}()
+
+	deviceService := domain.NewDeviceService(devicesRepo, idempotencyRepo, auditLog, keyPolicy, rand.Reader, domain.SystemClock{})
+	apiKeyService := domain.NewAPIKeyService(
+		persistence.NewInMemoryAPIKeysRepository(),
+		auditLog,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	organizationService := domain.NewOrganizationService(
+		persistence.NewInMemoryOrganizationsRepository(),
+		auditLog,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	bootstrapOperator(organizationService, apiKeyService, cfg.BootstrapAPIKey)
+	server := api.NewServer(
+		cfg.HTTP.ListenAddress,
+		deviceService,
+		apiKeyService,
+		organizationService,
+		auditLog,
+		webhookService,
+		eventStream,
+	)
+
+	if cfg.Metrics.Enabled {
+		registry := metrics.NewRegistry(deviceService)
+		deviceService.SetMetrics(registry)
+		server.EnableMetrics(registry)
+	}
+
+	tracerProvider, err := cfg.Tracing.NewTracerProvider(context.Background(), os.Stdout)
+	if err != nil {
+		fatal("Could not set up tracing", err)
+	}
+	if tracerProvider != nil {
+		deviceService.SetTracerProvider(tracerProvider)
+		server.EnableTracing(tracerProvider)
+	}
+
+	rpcServer := rpc.NewServer(cfg.GRPC.ListenAddress, deviceService, apiKeyService, eventStream)
+
+	tlsFiles := api.TLSFiles{
+		CertFile:     cfg.TLS.CertFile,
+		KeyFile:      cfg.TLS.KeyFile,
+		ClientCAFile: cfg.TLS.ClientCAFile,
+	}
+	var reloader *api.CertificateReloader
+	if tlsFiles.CertFile != "" {
+		if reloader, err = api.NewCertificateReloader(tlsFiles); err != nil {
+			fatal("Could not load TLS certificates", err)
+		}
+		go reloadCertificatesOnSIGHUP(reloader)
+	}
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+	// SIGTERM or SIGINT stop all servers, so does any server failing
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	timeouts := cfg.Timeouts()
+	served := make(chan error, 3)
+	go func() {
+		var err error
+		switch {
+		case cfg.GRPC.ListenAddress == "":
+			slog.Info("gRPC API disabled")
+			<-ctx.Done()
+		case reloader == nil:
+			err = rpcServer.Run(ctx, timeouts.Shutdown)
+		default:
+			err = rpcServer.RunTLS(ctx, reloader.TLSConfig(), timeouts.Shutdown)
+		}
+		if err != nil {
+			served <- fmt.Errorf("gRPC server on %s: %w", cfg.GRPC.ListenAddress, err)
+			return
+		}
+		served <- nil
+	}()
+	go func() {
+		var err error
+		if reloader == nil {
+			err = server.Run(ctx, timeouts)
+		} else {
+			err = server.RunTLS(ctx, reloader, timeouts)
+		}
+		if err != nil {
+			served <- fmt.Errorf("server on %s: %w", cfg.HTTP.ListenAddress, err)
+			return
+		}
+		served <- nil
+	}()
+
+	go func() {
+		var err error
+		if cfg.Metrics.Enabled {
+			err = server.RunMetrics(ctx, cfg.Metrics.ListenAddress, timeouts)
+		} else {
+			<-ctx.Done()
+		}
+		if err != nil {
+			served <- fmt.Errorf("metrics server on %s: %w", cfg.Metrics.ListenAddress, err)
+			return
+		}
+		served <- nil
+	}()
+
+	var errs []error
+	for i := 0; i < cap(served); i++ {
+		if err := <-served; err != nil {
+			errs = append(errs, err)
+			stop()
+		}
+	}
+	slog.Info("Servers stopped, flushing events")
+	stopBackground()
+	backgroundDone.Wait()
+	// the in-memory repositories have nothing to flush, the outbox is handed to the sinks one last time
+	if err := dispatcher.Dispatch(); err != nil {
+		errs = append(errs, fmt.Errorf("could not dispatch events: %w", err))
+	}
+	if tracerProvider != nil {
+		// spans are exported in batches, the last one is flushed
+		flushCtx, cancel := context.WithTimeout(context.Background(), timeouts.Shutdown)
+		if err := tracerProvider.Shutdown(flushCtx); err != nil {
+			errs = append(errs, fmt.Errorf("could not export spans: %w", err))
+		}
+		cancel()
+	}
+	if err := errors.Join(errs...); err != nil {
+		fatal("Shut down with errors", err)
+	}
+	slog.Info("Shut down cleanly")
+}
+
+// fatal logs err as an attribute of message and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
+
+// reloadCertificatesOnSIGHUP swaps the TLS certificates without restarting the listener.
+func reloadCertificatesOnSIGHUP(reloader *api.CertificateReloader) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		if err := reloader.Reload(); err != nil {
+			slog.Error("Could not reload TLS certificates, keeping the previous ones", "error", err)
+			continue
+		}
+		slog.Info("Reloaded TLS certificates")
+	}
+}
+
+// bootstrapOperator creates the operator organization and registers its admin key,
+// which is used to onboard organizations and create all further API keys.
+// Without a configured token a random one is generated and written once to stderr, bypassing the log
+// so it never reaches a log pipeline.
+func bootstrapOperator(
+	organizationService *domain.OrganizationService,
+	apiKeyService *domain.APIKeyService,
+	token string,
+) {
+	operator, err := organizationService.CreateOperatorOrganization("operator")
+	if err != nil {
+		fatal("Could not create operator organization", err)
+	}
+
+	generated := token == ""
+	if generated {
+		if token, err = domain.NewAPIKeyToken(rand.Reader); err != nil {
+			fatal("Could not generate bootstrap API key", err)
+		}
+	}
+
+	if _, err := apiKeyService.ImportAPIKey(operator.ID, "bootstrap", token, []domain.Role{domain.RoleAdmin}); err != nil {
+		fatal("Could not register bootstrap API key", err)
+	}
+	if generated {
+		slog.Warn("bootstrap_api_key is not configured, generated a bootstrap admin API key and wrote it to stderr")
+		fmt.Fprintf(os.Stderr, "Bootstrap admin API key, it is shown only once: %s\n", token)
 	}
 }
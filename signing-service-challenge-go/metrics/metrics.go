@@ -0,0 +1,188 @@
+// Package metrics exposes Prometheus metrics of the REST API and the domain services.
+package metrics
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "signing_service"
+
+// unmatchedRoute labels requests no route matched, so unknown paths can't create new series
+const unmatchedRoute = "unmatched"
+
+// Registry holds the metrics of the service, it is the domain.Metrics of the instrumented services.
+type Registry struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	signDuration     *prometheus.HistogramVec
+	keyGeneration    *prometheus.HistogramVec
+	repositoryErrors *prometheus.CounterVec
+}
+
+// NewRegistry registers the metrics of the service, devices are counted by deviceService whenever metrics are scraped.
+func NewRegistry(deviceService *domain.DeviceService) *Registry {
+	registry := &Registry{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route template, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		signDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sign_duration_seconds",
+			Help:      "Time the signer takes for a signature by algorithm.",
+			// 100µs to 3.2s
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+		}, []string{"algorithm"}),
+		keyGeneration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Time the key pair of a new device takes to generate by algorithm.",
+			// 1ms to 8s, large RSA keys take seconds
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"algorithm"}),
+		repositoryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_errors_total",
+			Help:      "Failed repository operations, conflicts aren't counted.",
+		}, []string{"operation"}),
+	}
+	registry.registry.MustRegister(
+		registry.requests,
+		registry.requestDuration,
+		registry.signDuration,
+		registry.keyGeneration,
+		registry.repositoryErrors,
+		newDevicesCollector(deviceService),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (registry *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(registry.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts and times the requests router serves, labelled with the template of the matched route.
+func (registry *Registry) Middleware(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		route := unmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(request, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		start := time.Now()
+		router.ServeHTTP(recorder, request)
+
+		labels := prometheus.Labels{"route": route, "method": methodLabel(request.Method), "status": strconv.Itoa(recorder.status)}
+		registry.requests.With(labels).Inc()
+		registry.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel keeps arbitrary methods from creating new series
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "other"
+	}
+}
+
+func (registry *Registry) ObserveSign(algorithm domain.Algorithm, duration time.Duration) {
+	registry.signDuration.WithLabelValues(algorithm.String()).Observe(duration.Seconds())
+}
+
+func (registry *Registry) ObserveKeyGeneration(algorithm domain.Algorithm, duration time.Duration) {
+	registry.keyGeneration.WithLabelValues(algorithm.String()).Observe(duration.Seconds())
+}
+
+func (registry *Registry) RepositoryError(operation string) {
+	registry.repositoryErrors.WithLabelValues(operation).Inc()
+}
+
+// statusRecorder remembers the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(bytes []byte) (int, error) {
+	recorder.wroteHeader = true
+	return recorder.ResponseWriter.Write(bytes)
+}
+
+// Flush keeps event streams working, they require an http.Flusher
+func (recorder *statusRecorder) Flush() {
+	_ = http.NewResponseController(recorder.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the deadlines of the connection
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// devicesCollector counts the devices by algorithm and status when metrics are scraped
+type devicesCollector struct {
+	deviceService *domain.DeviceService
+	description   *prometheus.Desc
+}
+
+func newDevicesCollector(deviceService *domain.DeviceService) *devicesCollector {
+	return &devicesCollector{
+		deviceService: deviceService,
+		description: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "devices"),
+			"Signature devices of all organizations by algorithm and status.",
+			[]string{"algorithm", "status"},
+			nil,
+		),
+	}
+}
+
+func (collector *devicesCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- collector.description
+}
+
+func (collector *devicesCollector) Collect(metrics chan<- prometheus.Metric) {
+	for _, count := range collector.deviceService.CountDevices() {
+		metrics <- prometheus.MustNewConstMetric(
+			collector.description,
+			prometheus.GaugeValue,
+			float64(count.Count),
+			count.Algorithm.String(),
+			count.Status.String(),
+		)
+	}
+}
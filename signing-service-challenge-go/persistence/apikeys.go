@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"sync"
+	"time"
+)
+
+type InMemoryAPIKeysRepository struct {
+	storage   map[string]domain.APIKey
+	byHash    map[[32]byte]string
+	bySubject map[certificateSubject]string
+	mutex     sync.Mutex
+}
+
+// certificateSubject scopes a subject to its organization, organizations can't claim each other's subjects
+type certificateSubject struct {
+	organizationID string
+	subject        string
+}
+
+func NewInMemoryAPIKeysRepository() *InMemoryAPIKeysRepository {
+	return &InMemoryAPIKeysRepository{
+		storage:   make(map[string]domain.APIKey),
+		byHash:    make(map[[32]byte]string),
+		bySubject: make(map[certificateSubject]string),
+	}
+}
+
+func (repository *InMemoryAPIKeysRepository) Get(organizationID string, id string) (domain.APIKey, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	apiKey, found := repository.storage[id]
+	if !found || apiKey.OrganizationID != organizationID {
+		return domain.APIKey{}, false
+	}
+	return apiKey, true
+}
+
+func (repository *InMemoryAPIKeysRepository) GetByHash(hash [32]byte) (domain.APIKey, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	id, found := repository.byHash[hash]
+	if !found {
+		return domain.APIKey{}, false
+	}
+	return repository.storage[id], true
+}
+
+func (repository *InMemoryAPIKeysRepository) GetByCertificateSubject(
+	organizationID string,
+	subject string,
+) (domain.APIKey, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	id, found := repository.bySubject[certificateSubject{organizationID, subject}]
+	if !found {
+		return domain.APIKey{}, false
+	}
+	return repository.storage[id], true
+}
+
+func (repository *InMemoryAPIKeysRepository) GetAll(organizationID string) []domain.APIKey {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	apiKeys := make([]domain.APIKey, 0)
+	for _, apiKey := range repository.storage {
+		if apiKey.OrganizationID == organizationID {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+	return apiKeys
+}
+
+func (repository *InMemoryAPIKeysRepository) Create(apiKey domain.APIKey) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.storage[apiKey.ID]; found {
+		return fmt.Errorf("API key with id %q already exists", apiKey.ID)
+	}
+	if _, found := repository.byHash[apiKey.Hash]; found {
+		return fmt.Errorf("API key token is already registered")
+	}
+	subject := certificateSubject{apiKey.OrganizationID, apiKey.CertificateSubject}
+	if _, found := repository.bySubject[subject]; found && apiKey.CertificateSubject != "" {
+		return domain.ErrCertificateSubjectBound
+	}
+	repository.storage[apiKey.ID] = apiKey
+	repository.byHash[apiKey.Hash] = apiKey.ID
+	if apiKey.CertificateSubject != "" {
+		repository.bySubject[subject] = apiKey.ID
+	}
+	return nil
+}
+
+func (repository *InMemoryAPIKeysRepository) Update(apiKey domain.APIKey) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, found := repository.storage[apiKey.ID]
+	if !found {
+		return fmt.Errorf("API key with id %q doesn't exists", apiKey.ID)
+	}
+	// the token hash and the owning organization are immutable
+	apiKey.Hash = stored.Hash
+	apiKey.OrganizationID = stored.OrganizationID
+	if apiKey.CertificateSubject != stored.CertificateSubject {
+		subject := certificateSubject{apiKey.OrganizationID, apiKey.CertificateSubject}
+		if id, found := repository.bySubject[subject]; found && id != apiKey.ID {
+			return domain.ErrCertificateSubjectBound
+		}
+		delete(repository.bySubject, certificateSubject{stored.OrganizationID, stored.CertificateSubject})
+		if apiKey.CertificateSubject != "" {
+			repository.bySubject[subject] = apiKey.ID
+		}
+	}
+	repository.storage[apiKey.ID] = apiKey
+	return nil
+}
+
+func (repository *InMemoryAPIKeysRepository) Touch(id string, usedAt time.Time) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	apiKey, found := repository.storage[id]
+	if !found {
+		return fmt.Errorf("API key with id %q doesn't exists", id)
+	}
+	apiKey.LastUsedAt = &usedAt
+	repository.storage[id] = apiKey
+	return nil
+}
@@ -0,0 +1,135 @@
+package persistence
+
+import (
+	"errors"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"testing"
+	"time"
+)
+
+func seededAPIKeysRepo(t *testing.T, apiKeys []domain.APIKey) *InMemoryAPIKeysRepository {
+	repo := NewInMemoryAPIKeysRepository()
+	for _, apiKey := range apiKeys {
+		if err := repo.Create(apiKey); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	return repo
+}
+
+func TestInMemoryAPIKeysRepository_GetIsScopedToOrganization(t *testing.T) {
+	apiKey := domain.APIKey{ID: "key", OrganizationID: testOrganizationID, Hash: [32]byte{1}}
+	repo := seededAPIKeysRepo(t, []domain.APIKey{apiKey})
+
+	if found, ok := repo.Get(testOrganizationID, apiKey.ID); !ok || found.ID != apiKey.ID {
+		t.Errorf("couldn't retrieve API key")
+	}
+	if _, ok := repo.Get("other", apiKey.ID); ok {
+		t.Errorf("API key should not be visible to other organizations")
+	}
+}
+
+func TestInMemoryAPIKeysRepository_GetByHash(t *testing.T) {
+	apiKey := domain.APIKey{ID: "key", OrganizationID: testOrganizationID, Hash: [32]byte{1}}
+	repo := seededAPIKeysRepo(t, []domain.APIKey{apiKey})
+
+	if found, ok := repo.GetByHash(apiKey.Hash); !ok || found.ID != apiKey.ID {
+		t.Errorf("couldn't retrieve API key by hash")
+	}
+	if _, ok := repo.GetByHash([32]byte{2}); ok {
+		t.Errorf("unknown hash should not resolve")
+	}
+}
+
+func TestInMemoryAPIKeysRepository_GetAll(t *testing.T) {
+	repo := seededAPIKeysRepo(t, []domain.APIKey{
+		{ID: "first", OrganizationID: testOrganizationID, Hash: [32]byte{1}},
+		{ID: "second", OrganizationID: testOrganizationID, Hash: [32]byte{2}},
+		{ID: "other", OrganizationID: "other", Hash: [32]byte{3}},
+	})
+
+	if apiKeys := repo.GetAll(testOrganizationID); len(apiKeys) != 2 {
+		t.Errorf("expected 2 API keys of the organization, got %d", len(apiKeys))
+	}
+	if apiKeys := repo.GetAll("unknown"); apiKeys == nil || len(apiKeys) != 0 {
+		t.Errorf("expected an empty list, got %v", apiKeys)
+	}
+}
+
+func TestInMemoryAPIKeysRepository_CreateRejectsDuplicates(t *testing.T) {
+	repo := seededAPIKeysRepo(t, []domain.APIKey{{ID: "key", OrganizationID: testOrganizationID, Hash: [32]byte{1}}})
+
+	if err := repo.Create(domain.APIKey{ID: "key", OrganizationID: testOrganizationID, Hash: [32]byte{2}}); err == nil {
+		t.Errorf("duplicate id should be rejected")
+	}
+	if err := repo.Create(domain.APIKey{ID: "other", OrganizationID: "other", Hash: [32]byte{1}}); err == nil {
+		t.Errorf("duplicate token hash should be rejected")
+	}
+}
+
+func TestInMemoryAPIKeysRepository_UpdateKeepsHashAndOrganization(t *testing.T) {
+	apiKey := domain.APIKey{ID: "key", OrganizationID: testOrganizationID, Hash: [32]byte{1}}
+	repo := seededAPIKeysRepo(t, []domain.APIKey{apiKey})
+
+	revokedAt := time.Now()
+	if err := repo.Update(domain.APIKey{ID: "key", OrganizationID: "other", Hash: [32]byte{2}, RevokedAt: &revokedAt}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	updated, found := repo.GetByHash(apiKey.Hash)
+	if !found || updated.OrganizationID != testOrganizationID || updated.RevokedAt == nil {
+		t.Errorf("update should change the API key but keep its hash and organization, got %+v", updated)
+	}
+	if err := repo.Update(domain.APIKey{ID: "unknown"}); err == nil {
+		t.Errorf("updating an unknown API key should fail")
+	}
+}
+
+func TestInMemoryAPIKeysRepository_Touch(t *testing.T) {
+	apiKey := domain.APIKey{ID: "key", OrganizationID: testOrganizationID, Hash: [32]byte{1}}
+	repo := seededAPIKeysRepo(t, []domain.APIKey{apiKey})
+
+	usedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := repo.Touch(apiKey.ID, usedAt); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if touched, _ := repo.Get(testOrganizationID, apiKey.ID); touched.LastUsedAt == nil || !touched.LastUsedAt.Equal(usedAt) {
+		t.Errorf("last usage = %v, want %v", touched.LastUsedAt, usedAt)
+	}
+	if err := repo.Touch("unknown", usedAt); err == nil {
+		t.Errorf("touching an unknown API key should fail")
+	}
+}
+
+func TestInMemoryAPIKeysRepository_CertificateSubjectsAreScopedToOrganizations(t *testing.T) {
+	first := domain.APIKey{ID: "first", OrganizationID: testOrganizationID, Hash: [32]byte{1}}
+	second := domain.APIKey{ID: "second", OrganizationID: testOrganizationID, Hash: [32]byte{2}}
+	other := domain.APIKey{ID: "other", OrganizationID: "other", Hash: [32]byte{3}}
+	repo := seededAPIKeysRepo(t, []domain.APIKey{first, second, other})
+
+	subject := "CN=till-7,O=" + testOrganizationID
+	first.CertificateSubject = subject
+	if err := repo.Update(first); err != nil {
+		t.Fatalf(err.Error())
+	}
+	second.CertificateSubject = subject
+	if err := repo.Update(second); !errors.Is(err, domain.ErrCertificateSubjectBound) {
+		t.Errorf("binding a bound subject again returned %v, want %v", err, domain.ErrCertificateSubjectBound)
+	}
+	// another organization binding the same subject neither fails nor takes it over
+	other.CertificateSubject = subject
+	if err := repo.Update(other); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if apiKey, found := repo.GetByCertificateSubject(testOrganizationID, subject); !found || apiKey.ID != first.ID {
+		t.Errorf("subject resolves to %v in its organization, want %s", apiKey.ID, first.ID)
+	}
+
+	// rebinding frees the previous subject
+	first.CertificateSubject = "CN=till-8,O=" + testOrganizationID
+	if err := repo.Update(first); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, found := repo.GetByCertificateSubject(testOrganizationID, subject); found {
+		t.Errorf("previous subject still resolves")
+	}
+}
@@ -0,0 +1,52 @@
+package persistence
+
+import (
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"sync"
+)
+
+type InMemoryAuditRepository struct {
+	storage map[string][]domain.AuditEntry
+	mutex   sync.Mutex
+}
+
+func NewInMemoryAuditRepository() *InMemoryAuditRepository {
+	return &InMemoryAuditRepository{storage: make(map[string][]domain.AuditEntry)}
+}
+
+func (repository *InMemoryAuditRepository) Append(entry domain.AuditEntry) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	entries := repository.storage[entry.OrganizationID]
+	previousHash := ""
+	if len(entries) > 0 {
+		previousHash = entries[len(entries)-1].Hash
+	}
+	if entry.Sequence != len(entries)+1 || entry.PreviousHash != previousHash {
+		return fmt.Errorf("audit entry %d: %w", entry.Sequence, domain.ErrAuditChainConflict)
+	}
+	repository.storage[entry.OrganizationID] = append(entries, entry)
+	return nil
+}
+
+func (repository *InMemoryAuditRepository) Last(organizationID string) (domain.AuditEntry, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	entries := repository.storage[organizationID]
+	if len(entries) == 0 {
+		return domain.AuditEntry{}, false
+	}
+	return entries[len(entries)-1], true
+}
+
+func (repository *InMemoryAuditRepository) GetAll(organizationID string) []domain.AuditEntry {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	entries := make([]domain.AuditEntry, len(repository.storage[organizationID]))
+	copy(entries, repository.storage[organizationID])
+	return entries
+}
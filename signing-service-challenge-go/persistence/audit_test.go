@@ -0,0 +1,39 @@
+package persistence
+
+import (
+	"errors"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"testing"
+)
+
+func TestInMemoryAuditRepositoryAppend(t *testing.T) {
+	repo := NewInMemoryAuditRepository()
+	first := domain.AuditEntry{Sequence: 1, OrganizationID: testOrganizationID, Hash: "first"}
+	if err := repo.Append(first); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tests := []struct {
+		name  string
+		entry domain.AuditEntry
+	}{
+		{"sequence gap", domain.AuditEntry{Sequence: 3, OrganizationID: testOrganizationID, PreviousHash: "first"}},
+		{"stale sequence", domain.AuditEntry{Sequence: 1, OrganizationID: testOrganizationID}},
+		{"wrong previous hash", domain.AuditEntry{Sequence: 2, OrganizationID: testOrganizationID, PreviousHash: "other"}},
+	}
+	for _, test := range tests {
+		if err := repo.Append(test.entry); !errors.Is(err, domain.ErrAuditChainConflict) {
+			t.Errorf("%s: Append() error = %v, want %v", test.name, err, domain.ErrAuditChainConflict)
+		}
+	}
+
+	if err := repo.Append(domain.AuditEntry{Sequence: 2, OrganizationID: testOrganizationID, PreviousHash: "first"}); err != nil {
+		t.Errorf("Append() error = %v", err)
+	}
+	if last, found := repo.Last(testOrganizationID); !found || last.Sequence != 2 {
+		t.Errorf("Last() = %+v, want sequence 2", last)
+	}
+	if entries := repo.GetAll("other"); len(entries) != 0 {
+		t.Errorf("GetAll() of another organization returned %d entries", len(entries))
+	}
+}
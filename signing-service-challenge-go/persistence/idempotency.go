@@ -0,0 +1,101 @@
+package persistence
+
+import (
+	"container/heap"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"sync"
+	"time"
+)
+
+type InMemoryIdempotencyRepository struct {
+	storage map[string]domain.IdempotencyRecord
+	// expiries orders the keys by expiry, so DeleteExpired only visits expired records
+	expiries expiryHeap
+	locks    map[string]*keyLock
+	mutex    sync.Mutex
+}
+
+// expiry is an entry of expiryHeap, it is stale once its key was saved again with another expiry
+type expiry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// expiryHeap implements heap.Interface with the earliest expiry first
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// keyLock serializes requests of one key, waiters tracks when it can be released
+type keyLock struct {
+	mutex   sync.Mutex
+	waiters int
+}
+
+func NewInMemoryIdempotencyRepository() *InMemoryIdempotencyRepository {
+	return &InMemoryIdempotencyRepository{
+		storage: make(map[string]domain.IdempotencyRecord),
+		locks:   make(map[string]*keyLock),
+	}
+}
+
+func (repository *InMemoryIdempotencyRepository) Lock(key string) func() {
+	repository.mutex.Lock()
+	lock, found := repository.locks[key]
+	if !found {
+		lock = &keyLock{}
+		repository.locks[key] = lock
+	}
+	lock.waiters++
+	repository.mutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+
+		repository.mutex.Lock()
+		defer repository.mutex.Unlock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(repository.locks, key)
+		}
+	}
+}
+
+func (repository *InMemoryIdempotencyRepository) Get(key string) (domain.IdempotencyRecord, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	record, found := repository.storage[key]
+	return record, found
+}
+
+func (repository *InMemoryIdempotencyRepository) Save(record domain.IdempotencyRecord) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.storage[record.Key] = record
+	heap.Push(&repository.expiries, expiry{record.Key, record.ExpiresAt})
+	return nil
+}
+
+func (repository *InMemoryIdempotencyRepository) DeleteExpired(now time.Time) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for len(repository.expiries) > 0 && !now.Before(repository.expiries[0].expiresAt) {
+		expired := heap.Pop(&repository.expiries).(expiry)
+		if record, found := repository.storage[expired.key]; found && record.ExpiresAt.Equal(expired.expiresAt) {
+			delete(repository.storage, expired.key)
+		}
+	}
+}
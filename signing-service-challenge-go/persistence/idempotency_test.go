@@ -0,0 +1,69 @@
+package persistence
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"testing"
+	"time"
+)
+
+func TestInMemoryIdempotencyRepository_LockSerializesKey(t *testing.T) {
+	repo := NewInMemoryIdempotencyRepository()
+	unlock := repo.Lock("key")
+
+	acquired := make(chan struct{})
+	go func() {
+		repo.Lock("key")()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("second caller acquired a held key")
+	case <-time.After(20 * time.Millisecond):
+	}
+	repo.Lock("other")()
+
+	unlock()
+	<-acquired
+	if len(repo.locks) != 0 {
+		t.Errorf("released locks weren't cleaned up")
+	}
+}
+
+func TestInMemoryIdempotencyRepository_DeleteExpired(t *testing.T) {
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewInMemoryIdempotencyRepository()
+	repo.Save(domain.IdempotencyRecord{Key: "expired", ExpiresAt: now})
+	repo.Save(domain.IdempotencyRecord{Key: "valid", ExpiresAt: now.Add(time.Second)})
+
+	repo.DeleteExpired(now)
+
+	if _, found := repo.Get("expired"); found {
+		t.Errorf("expired record wasn't deleted")
+	}
+	if _, found := repo.Get("valid"); !found {
+		t.Errorf("valid record was deleted")
+	}
+}
+
+func TestInMemoryIdempotencyRepository_DeleteExpiredInExpiryOrder(t *testing.T) {
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewInMemoryIdempotencyRepository()
+	repo.Save(domain.IdempotencyRecord{Key: "late", ExpiresAt: now.Add(2 * time.Second)})
+	repo.Save(domain.IdempotencyRecord{Key: "early", ExpiresAt: now})
+	repo.Save(domain.IdempotencyRecord{Key: "saved again", ExpiresAt: now})
+	repo.Save(domain.IdempotencyRecord{Key: "saved again", ExpiresAt: now.Add(time.Second)})
+
+	repo.DeleteExpired(now)
+	if _, found := repo.Get("early"); found {
+		t.Errorf("expired record wasn't deleted")
+	}
+	if _, found := repo.Get("saved again"); !found {
+		t.Errorf("record saved again was deleted at its previous expiry")
+	}
+
+	repo.DeleteExpired(now.Add(2 * time.Second))
+	if len(repo.storage) != 0 || len(repo.expiries) != 0 {
+		t.Errorf("expected every record to expire, %d records and %d expiries left", len(repo.storage), len(repo.expiries))
+	}
+}
@@ -1,64 +1,157 @@
 package persistence
 
 import (
+	"context"
 	"fmt"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"log/slog"
+	"sort"
 	"sync"
 )
 
+// deviceKey scopes device UUIDs to their organization, so equal UUIDs of different organizations never collide
+type deviceKey struct {
+	organizationID string
+	uuid           string
+}
+
+// InMemoryDevicesRepository also holds the outbox, so events are stored under the same lock as the devices.
 type InMemoryDevicesRepository struct {
-	storage map[string]domain.SignatureDevice
+	storage map[deviceKey]domain.SignatureDevice
+	outbox  outbox
 	mutex   sync.Mutex
 }
 
 func NewInMemoryDevicesRepository() *InMemoryDevicesRepository {
-	repo := InMemoryDevicesRepository{storage: make(map[string]domain.SignatureDevice)}
+	repo := InMemoryDevicesRepository{
+		storage: make(map[deviceKey]domain.SignatureDevice),
+		outbox:  newOutbox(),
+	}
 	return &repo
 }
 
-func (repository *InMemoryDevicesRepository) Get(uuid string) (domain.SignatureDevice, bool) {
-	device, found := repository.storage[uuid]
+func (repository *InMemoryDevicesRepository) Get(
+	_ context.Context,
+	organizationID string,
+	uuid string,
+) (domain.SignatureDevice, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	device, found := repository.storage[deviceKey{organizationID, uuid}]
 	return device, found
 }
 
-func (repository *InMemoryDevicesRepository) GetAll() []domain.SignatureDevice {
-	devices := make([]domain.SignatureDevice, 0, len(repository.storage))
-	for _, device := range repository.storage {
-		devices = append(devices, device)
+func (repository *InMemoryDevicesRepository) List(
+	_ context.Context,
+	organizationID string,
+	query domain.DeviceQuery,
+) []domain.SignatureDevice {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	devices := make([]domain.SignatureDevice, 0)
+	for key, device := range repository.storage {
+		if key.organizationID == organizationID && query.Matches(device) && query.IsAfterCursor(device) {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return query.Before(devices[i], devices[j])
+	})
+	if len(devices) > query.Limit {
+		devices = devices[:query.Limit]
 	}
 	return devices
 }
 
-func (repository *InMemoryDevicesRepository) Create(device domain.SignatureDevice) error {
+func (repository *InMemoryDevicesRepository) Create(
+	ctx context.Context,
+	device domain.SignatureDevice,
+	events ...domain.Event,
+) error {
 	repository.mutex.Lock()
 	defer repository.mutex.Unlock()
 
-	if _, found := repository.storage[device.UUID]; found {
-		return fmt.Errorf(`device with UUID "%q" already exists`, device.UUID)
+	key := deviceKey{device.OrganizationID, device.UUID}
+	if _, found := repository.storage[key]; found {
+		return fmt.Errorf("device with UUID %q: %w", device.UUID, domain.ErrDeviceExists)
 	}
-	repository.storage[device.UUID] = device
+	repository.storage[key] = device
+	repository.outbox.append(events)
+	slog.DebugContext(ctx, "Stored signature device", "device", device, "events", len(events))
 	return nil
 }
 
-func (repository *InMemoryDevicesRepository) Update(device domain.SignatureDevice) error {
+func (repository *InMemoryDevicesRepository) Update(
+	ctx context.Context,
+	device domain.SignatureDevice,
+	events ...domain.Event,
+) error {
 	repository.mutex.Lock()
 	defer repository.mutex.Unlock()
 
-	if _, found := repository.storage[device.UUID]; !found {
+	key := deviceKey{device.OrganizationID, device.UUID}
+	stored, found := repository.storage[key]
+	if !found {
 		return fmt.Errorf(`device with UUID "%q" doesn't exists`, device.UUID)
 	}
-	repository.storage[device.UUID] = device
+	if stored.Version != device.Version {
+		return fmt.Errorf("device with UUID %q: %w", device.UUID, domain.ErrVersionConflict)
+	}
+	device.Version++
+	repository.storage[key] = device
+	repository.outbox.append(events)
+	slog.DebugContext(ctx, "Updated signature device", "device", device, "events", len(events))
 	return nil
 }
 
-func (repository *InMemoryDevicesRepository) IncrementCounter(uuid string) error {
+func (repository *InMemoryDevicesRepository) IncrementCounter(
+	ctx context.Context,
+	signed domain.SignatureDevice,
+	events ...domain.Event,
+) error {
 	repository.mutex.Lock()
 	defer repository.mutex.Unlock()
-	device, found := repository.storage[uuid]
+	key := deviceKey{signed.OrganizationID, signed.UUID}
+	device, found := repository.storage[key]
 	if !found {
-		return fmt.Errorf(`device with UUID "%q" doesn't exists`, uuid)
+		return fmt.Errorf(`device with UUID "%q" doesn't exists`, signed.UUID)
+	}
+	if device.Version != signed.Version {
+		return fmt.Errorf("device with UUID %q: %w", signed.UUID, domain.ErrVersionConflict)
 	}
+	device.LastSignature = signed.LastSignature
 	device.SignatureCounter += 1
-	repository.storage[uuid] = device
+	device.Version++
+	repository.storage[key] = device
+	repository.outbox.append(events)
+	slog.DebugContext(ctx, "Incremented signature counter", "device", device, "events", len(events))
 	return nil
 }
+
+// CheckHealth always succeeds once the lock is free, memory can't become unreachable
+func (repository *InMemoryDevicesRepository) CheckHealth() error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	return nil
+}
+
+func (repository *InMemoryDevicesRepository) CountDevices() []domain.DeviceCount {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	type group struct {
+		algorithm domain.Algorithm
+		status    domain.Status
+	}
+	counts := make(map[group]int)
+	for _, device := range repository.storage {
+		counts[group{device.Algorithm, device.Status}]++
+	}
+	deviceCounts := make([]domain.DeviceCount, 0, len(counts))
+	for group, count := range counts {
+		deviceCounts = append(deviceCounts, domain.DeviceCount{Algorithm: group.algorithm, Status: group.status, Count: count})
+	}
+	return deviceCounts
+}
@@ -1,16 +1,22 @@
 package persistence
 
 import (
+	"context"
+	"errors"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 	"github.com/google/uuid"
+	"reflect"
 	"testing"
+	"time"
 )
 
+const testOrganizationID = "organization"
+
 func TestInMemoryDevicesRepository_GetSuccessful(t *testing.T) {
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
 	repo := seededRepo([]domain.SignatureDevice{device})
 
-	foundDevice, _ := repo.Get(device.UUID)
+	foundDevice, _ := repo.Get(context.Background(), testOrganizationID, device.UUID)
 
 	if foundDevice.UUID != device.UUID {
 		t.Errorf("couldn't retrieve signature device")
@@ -18,27 +24,27 @@ func TestInMemoryDevicesRepository_GetSuccessful(t *testing.T) {
 }
 
 func TestInMemoryDevicesRepository_GetNotFound(t *testing.T) {
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
 	repo := seededRepo([]domain.SignatureDevice{})
 
-	_, found := repo.Get(device.UUID)
+	_, found := repo.Get(context.Background(), testOrganizationID, device.UUID)
 
 	if found {
 		t.Errorf("device should not present in repository")
 	}
 }
 
-func TestInMemoryDevicesRepository_GetAll(t *testing.T) {
+func TestInMemoryDevicesRepository_List(t *testing.T) {
 	devices := []domain.SignatureDevice{
-		domain.SignatureDevice{UUID: uuid.NewString()},
-		domain.SignatureDevice{UUID: uuid.NewString()},
-		domain.SignatureDevice{UUID: uuid.NewString()},
-		domain.SignatureDevice{UUID: uuid.NewString()},
-		domain.SignatureDevice{UUID: uuid.NewString()},
+		domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID},
+		domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID},
+		domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID},
+		domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID},
+		domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID},
 	}
 
 	repo := seededRepo(devices)
-	foundDevices := repo.GetAll()
+	foundDevices := repo.List(context.Background(), testOrganizationID, domain.DeviceQuery{Limit: 10})
 	if len(foundDevices) != len(devices) || len(foundDevices) == 0 {
 		t.Errorf("incorrect amount of devices returned")
 	}
@@ -46,13 +52,13 @@ func TestInMemoryDevicesRepository_GetAll(t *testing.T) {
 
 func TestInMemoryDevicesRepository_CreateSuccessful(t *testing.T) {
 	repo := seededRepo([]domain.SignatureDevice{})
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
 
-	err := repo.Create(device)
+	err := repo.Create(context.Background(), device)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
-	_, found := repo.storage[device.UUID]
+	_, found := repo.storage[deviceKey{testOrganizationID, device.UUID}]
 	if !found {
 		t.Errorf("device wasn't saved")
 	}
@@ -60,29 +66,29 @@ func TestInMemoryDevicesRepository_CreateSuccessful(t *testing.T) {
 
 func TestInMemoryDevicesRepository_CreateDuplicateError(t *testing.T) {
 	repo := seededRepo([]domain.SignatureDevice{})
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
-	err := repo.Create(device)
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
+	err := repo.Create(context.Background(), device)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	err = repo.Create(device)
+	err = repo.Create(context.Background(), device)
 	if err == nil {
 		t.Errorf("should not be allowed to save multiple devices with same uuid")
 	}
 }
 
 func TestInMemoryDevicesRepository_UpdateSuccessful(t *testing.T) {
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
 	repo := seededRepo([]domain.SignatureDevice{device})
 	device.Label = "label"
 
-	err := repo.Update(device)
+	err := repo.Update(context.Background(), device)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	updatedDevice := repo.storage[device.UUID]
+	updatedDevice := repo.storage[deviceKey{testOrganizationID, device.UUID}]
 	if updatedDevice.Label != device.Label || updatedDevice.Label == "" {
 		t.Errorf("device wasn't saved")
 	}
@@ -90,10 +96,10 @@ func TestInMemoryDevicesRepository_UpdateSuccessful(t *testing.T) {
 
 func TestInMemoryDevicesRepository_UpdateNotFound(t *testing.T) {
 	repo := seededRepo([]domain.SignatureDevice{})
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
 	device.Label = "label"
 
-	err := repo.Update(device)
+	err := repo.Update(context.Background(), device)
 	if err == nil {
 		t.Errorf("no such device to update")
 	}
@@ -102,33 +108,126 @@ func TestInMemoryDevicesRepository_UpdateNotFound(t *testing.T) {
 func seededRepo(devices []domain.SignatureDevice) *InMemoryDevicesRepository {
 	repo := NewInMemoryDevicesRepository()
 	for _, device := range devices {
-		repo.storage[device.UUID] = device
+		repo.storage[deviceKey{device.OrganizationID, device.UUID}] = device
 	}
 
 	return repo
 }
 
 func TestInMemoryDevicesRepository_IncrementCounterSuccessful(t *testing.T) {
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
 	repo := seededRepo([]domain.SignatureDevice{device})
 
-	err := repo.IncrementCounter(device.UUID)
+	err := repo.IncrementCounter(context.Background(), device)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	updatedDevice := repo.storage[device.UUID]
+	updatedDevice := repo.storage[deviceKey{testOrganizationID, device.UUID}]
 	if updatedDevice.SignatureCounter != 1 {
 		t.Errorf("signature counter wasn't incremented")
 	}
 }
 
 func TestInMemoryDevicesRepository_IncrementCounterNotFound(t *testing.T) {
-	device := domain.SignatureDevice{UUID: uuid.NewString()}
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
 	repo := seededRepo([]domain.SignatureDevice{})
 
-	err := repo.IncrementCounter(device.UUID)
+	err := repo.IncrementCounter(context.Background(), device)
 	if err == nil {
 		t.Errorf("no such device to update")
 	}
 }
+
+func TestInMemoryDevicesRepository_UpdateVersionConflict(t *testing.T) {
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID, Version: 2}
+	repo := seededRepo([]domain.SignatureDevice{device})
+	device.Version = 1
+	device.Label = "label"
+
+	err := repo.Update(context.Background(), device)
+	if !errors.Is(err, domain.ErrVersionConflict) {
+		t.Errorf("Update() error = %v, want %v", err, domain.ErrVersionConflict)
+	}
+	if repo.storage[deviceKey{testOrganizationID, device.UUID}].Label != "" {
+		t.Errorf("stale device shouldn't be saved")
+	}
+}
+
+func TestInMemoryDevicesRepository_UpdateIncrementsVersion(t *testing.T) {
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
+	repo := seededRepo([]domain.SignatureDevice{device})
+
+	if err := repo.Update(context.Background(), device); err != nil {
+		t.Errorf(err.Error())
+	}
+	device.Version++
+	if err := repo.IncrementCounter(context.Background(), device); err != nil {
+		t.Errorf(err.Error())
+	}
+	if repo.storage[deviceKey{testOrganizationID, device.UUID}].Version != 2 {
+		t.Errorf("version wasn't incremented on every write")
+	}
+}
+
+func TestInMemoryDevicesRepository_OrganizationIsolation(t *testing.T) {
+	device := domain.SignatureDevice{UUID: uuid.NewString(), OrganizationID: testOrganizationID}
+	repo := seededRepo([]domain.SignatureDevice{device})
+
+	if _, found := repo.Get(context.Background(), "other", device.UUID); found {
+		t.Errorf("device is visible to another organization")
+	}
+	if len(repo.List(context.Background(), "other", domain.DeviceQuery{Limit: 10})) != 0 {
+		t.Errorf("device is listed for another organization")
+	}
+	if err := repo.IncrementCounter(context.Background(), domain.SignatureDevice{UUID: device.UUID, OrganizationID: "other"}); err == nil {
+		t.Errorf("another organization incremented the counter")
+	}
+
+	sameUUID := domain.SignatureDevice{UUID: device.UUID, OrganizationID: "other"}
+	if err := repo.Create(context.Background(), sameUUID); err != nil {
+		t.Errorf("organizations should not share the UUID space: %v", err)
+	}
+}
+
+func TestInMemoryDevicesRepository_ListQuery(t *testing.T) {
+	created := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	suspended := domain.DeviceSuspended
+	repo := seededRepo([]domain.SignatureDevice{
+		{UUID: "a", OrganizationID: testOrganizationID, Label: "till-2", Algorithm: domain.ECC, CreatedAt: created, Tags: []string{"berlin"}},
+		{UUID: "b", OrganizationID: testOrganizationID, Label: "till-1", Algorithm: domain.RSA, CreatedAt: created},
+		{UUID: "c", OrganizationID: testOrganizationID, Label: "kiosk", Algorithm: domain.ECC, CreatedAt: created.Add(time.Second), Status: suspended},
+		{UUID: "d", OrganizationID: testOrganizationID, Label: "till-3", Algorithm: domain.ECC, CreatedAt: created.Add(-time.Second), Tags: []string{"berlin"}},
+	})
+
+	tests := []struct {
+		name  string
+		query domain.DeviceQuery
+		want  []string
+	}{
+		{"created_at with uuid tiebreak", domain.DeviceQuery{SortBy: domain.SortByCreatedAt}, []string{"d", "a", "b", "c"}},
+		{"label descending", domain.DeviceQuery{SortBy: domain.SortByLabel, Descending: true}, []string{"d", "a", "b", "c"}},
+		{"algorithm", domain.DeviceQuery{DeviceFilter: domain.DeviceFilter{Algorithm: domain.RSA}}, []string{"b"}},
+		{"label prefix", domain.DeviceQuery{DeviceFilter: domain.DeviceFilter{LabelPrefix: "till-"}, SortBy: domain.SortByLabel}, []string{"b", "a", "d"}},
+		{"status", domain.DeviceQuery{DeviceFilter: domain.DeviceFilter{Status: &suspended}}, []string{"c"}},
+		{"tag", domain.DeviceQuery{DeviceFilter: domain.DeviceFilter{Tag: "berlin"}}, []string{"d", "a"}},
+		{"limit", domain.DeviceQuery{Limit: 2}, []string{"d", "a"}},
+		{
+			"after cursor",
+			domain.DeviceQuery{After: &domain.DeviceCursor{SortBy: domain.SortByCreatedAt, CreatedAt: created, UUID: "a"}},
+			[]string{"b", "c"},
+		},
+	}
+	for _, test := range tests {
+		if test.query.Limit == 0 {
+			test.query.Limit = 10
+		}
+		var got []string
+		for _, device := range repo.List(context.Background(), testOrganizationID, test.query) {
+			got = append(got, device.UUID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: List() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
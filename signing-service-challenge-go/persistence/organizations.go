@@ -0,0 +1,46 @@
+package persistence
+
+import (
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"sync"
+)
+
+type InMemoryOrganizationsRepository struct {
+	storage map[string]domain.Organization
+	mutex   sync.Mutex
+}
+
+func NewInMemoryOrganizationsRepository() *InMemoryOrganizationsRepository {
+	return &InMemoryOrganizationsRepository{storage: make(map[string]domain.Organization)}
+}
+
+func (repository *InMemoryOrganizationsRepository) Get(id string) (domain.Organization, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	organization, found := repository.storage[id]
+	return organization, found
+}
+
+func (repository *InMemoryOrganizationsRepository) GetAll() []domain.Organization {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	organizations := make([]domain.Organization, 0, len(repository.storage))
+	for _, organization := range repository.storage {
+		organizations = append(organizations, organization)
+	}
+	return organizations
+}
+
+func (repository *InMemoryOrganizationsRepository) Create(organization domain.Organization) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.storage[organization.ID]; found {
+		return fmt.Errorf("organization with id %q already exists", organization.ID)
+	}
+	repository.storage[organization.ID] = organization
+	return nil
+}
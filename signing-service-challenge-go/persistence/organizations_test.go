@@ -0,0 +1,51 @@
+package persistence
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"testing"
+)
+
+func TestInMemoryOrganizationsRepository_Get(t *testing.T) {
+	repo := NewInMemoryOrganizationsRepository()
+	organization := domain.Organization{ID: testOrganizationID, Name: "shop"}
+	if err := repo.Create(organization); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if found, ok := repo.Get(testOrganizationID); !ok || found != organization {
+		t.Errorf("couldn't retrieve organization")
+	}
+	if _, ok := repo.Get("unknown"); ok {
+		t.Errorf("organization should not present in repository")
+	}
+}
+
+func TestInMemoryOrganizationsRepository_GetAll(t *testing.T) {
+	repo := NewInMemoryOrganizationsRepository()
+	if organizations := repo.GetAll(); organizations == nil || len(organizations) != 0 {
+		t.Errorf("expected an empty list, got %v", organizations)
+	}
+	for _, id := range []string{"first", "second"} {
+		if err := repo.Create(domain.Organization{ID: id}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	if organizations := repo.GetAll(); len(organizations) != 2 {
+		t.Errorf("expected 2 organizations, got %d", len(organizations))
+	}
+}
+
+func TestInMemoryOrganizationsRepository_CreateRejectsDuplicates(t *testing.T) {
+	repo := NewInMemoryOrganizationsRepository()
+	if err := repo.Create(domain.Organization{ID: testOrganizationID, Name: "shop"}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if err := repo.Create(domain.Organization{ID: testOrganizationID, Name: "other"}); err == nil {
+		t.Errorf("duplicate id should be rejected")
+	}
+	if organization, _ := repo.Get(testOrganizationID); organization.Name != "shop" {
+		t.Errorf("duplicate overwrote the stored organization")
+	}
+}
@@ -0,0 +1,183 @@
+package persistence
+
+import (
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"sort"
+	"time"
+)
+
+// outbox is the event log of a repository, callers hold the repository lock.
+// Dispatched events are pruned from events, history keeps them for replays until they leave the retention window.
+type outbox struct {
+	events       []domain.OutboxEvent
+	history      []domain.OutboxEvent
+	lastSequence int64
+	offsets      map[string]int64
+	retention    time.Duration
+	// expiredSequence is the sequence of the newest event trimmed from history
+	expiredSequence int64
+	// signatures indexes the sequences of the retained signatures by the counter they raised the device to
+	signatures map[deviceKey]map[int]int64
+	// expiredSignatures holds the highest signature counter trimmed from history per device
+	expiredSignatures map[deviceKey]int
+}
+
+func newOutbox() outbox {
+	return outbox{
+		offsets:           make(map[string]int64),
+		retention:         domain.DefaultEventHistoryRetention,
+		signatures:        make(map[deviceKey]map[int]int64),
+		expiredSignatures: make(map[deviceKey]int),
+	}
+}
+
+func (outbox *outbox) append(events []domain.Event) {
+	for _, event := range events {
+		outbox.lastSequence++
+		outboxEvent := domain.OutboxEvent{Sequence: outbox.lastSequence, Event: event}
+		outbox.events = append(outbox.events, outboxEvent)
+		outbox.history = append(outbox.history, outboxEvent)
+		if data, ok := event.Data.(domain.SignatureCreatedData); ok {
+			key := deviceKey{event.OrganizationID, event.DeviceID}
+			if outbox.signatures[key] == nil {
+				outbox.signatures[key] = make(map[int]int64)
+			}
+			outbox.signatures[key][data.SignatureCounter+1] = outboxEvent.Sequence
+		}
+	}
+	if len(events) > 0 {
+		outbox.trim(events[len(events)-1].OccurredAt.Add(-outbox.retention))
+	}
+}
+
+// trim drops the events that occurred before cutoff from history
+func (outbox *outbox) trim(cutoff time.Time) {
+	trimmed := 0
+	for trimmed < len(outbox.history) && outbox.history[trimmed].Event.OccurredAt.Before(cutoff) {
+		event := outbox.history[trimmed]
+		if data, ok := event.Event.Data.(domain.SignatureCreatedData); ok {
+			key := deviceKey{event.Event.OrganizationID, event.Event.DeviceID}
+			delete(outbox.signatures[key], data.SignatureCounter+1)
+			if len(outbox.signatures[key]) == 0 {
+				delete(outbox.signatures, key)
+			}
+			outbox.expiredSignatures[key] = data.SignatureCounter + 1
+		}
+		outbox.expiredSequence = event.Sequence
+		trimmed++
+	}
+	outbox.history = outbox.history[trimmed:]
+}
+
+// SetHistoryRetention sets how long events stay in the history, older ones are dropped as new events arrive
+func (repository *InMemoryDevicesRepository) SetHistoryRetention(retention time.Duration) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.outbox.retention = retention
+}
+
+func (repository *InMemoryDevicesRepository) Events(after int64, limit int) []domain.OutboxEvent {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	events := make([]domain.OutboxEvent, 0, limit)
+	for _, event := range repository.outbox.events {
+		if len(events) == limit {
+			break
+		}
+		if event.Sequence > after {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (repository *InMemoryDevicesRepository) Offset(consumer string) int64 {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return repository.outbox.offsets[consumer]
+}
+
+func (repository *InMemoryDevicesRepository) Commit(consumer string, sequence int64) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if sequence < repository.outbox.offsets[consumer] || sequence > repository.outbox.lastSequence {
+		return fmt.Errorf("can't commit sequence %d for %q", sequence, consumer)
+	}
+	repository.outbox.offsets[consumer] = sequence
+	return nil
+}
+
+func (repository *InMemoryDevicesRepository) Prune(sequence int64) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	pruned := 0
+	for pruned < len(repository.outbox.events) && repository.outbox.events[pruned].Sequence <= sequence {
+		pruned++
+	}
+	repository.outbox.events = append([]domain.OutboxEvent(nil), repository.outbox.events[pruned:]...)
+}
+
+func (repository *InMemoryDevicesRepository) History(
+	organizationID string,
+	deviceID string,
+	after int64,
+	limit int,
+) []domain.OutboxEvent {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	history := repository.outbox.history
+	start := sort.Search(len(history), func(i int) bool { return history[i].Sequence > after })
+	events := make([]domain.OutboxEvent, 0)
+	for _, event := range history[start:] {
+		if len(events) == limit {
+			break
+		}
+		if event.Event.OrganizationID == organizationID && (deviceID == "" || event.Event.DeviceID == deviceID) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (repository *InMemoryDevicesRepository) LastSequence() int64 {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return repository.outbox.lastSequence
+}
+
+func (repository *InMemoryDevicesRepository) OldestSequence() int64 {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return repository.outbox.expiredSequence + 1
+}
+
+func (repository *InMemoryDevicesRepository) SignatureSequence(
+	organizationID string,
+	deviceID string,
+	signatureCounter int,
+) (int64, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := deviceKey{organizationID, deviceID}
+	expired, anyExpired := repository.outbox.expiredSignatures[key]
+	if sequence, found := repository.outbox.signatures[key][signatureCounter]; found {
+		return sequence, nil
+	}
+	if anyExpired && signatureCounter <= expired {
+		return 0, fmt.Errorf("signature %d of device %q: %w", signatureCounter, deviceID, domain.ErrEventsExpired)
+	}
+	if signatureCounter == 0 {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("device %q has no signature with counter %d", deviceID, signatureCounter)
+}
@@ -0,0 +1,117 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"testing"
+	"time"
+)
+
+func TestInMemoryDevicesRepositoryOutbox(t *testing.T) {
+	repo := NewInMemoryDevicesRepository()
+	device := domain.SignatureDevice{UUID: "device", OrganizationID: testOrganizationID}
+	if err := repo.Create(context.Background(), device, domain.Event{ID: "created", OrganizationID: testOrganizationID, DeviceID: "device"}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := repo.IncrementCounter(context.Background(), device, domain.Event{ID: "signed", OrganizationID: testOrganizationID, DeviceID: "device"}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// a rejected write must not leave its events behind
+	if err := repo.Update(context.Background(), device, domain.Event{ID: "stale", OrganizationID: testOrganizationID, DeviceID: "device"}); err == nil {
+		t.Fatalf("Update() with a stale version succeeded")
+	}
+
+	events := repo.Events(0, 10)
+	if len(events) != 2 || events[0].Event.ID != "created" || events[1].Sequence != 2 {
+		t.Fatalf("Events() = %+v, want created and signed", events)
+	}
+
+	if err := repo.Commit("sink", 1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := repo.Commit("sink", 0); err == nil {
+		t.Errorf("Commit() moved the offset backwards")
+	}
+	if offset := repo.Offset("sink"); offset != 1 {
+		t.Errorf("Offset() = %d, want 1", offset)
+	}
+
+	repo.Prune(1)
+	if events = repo.Events(0, 10); len(events) != 1 || events[0].Event.ID != "signed" {
+		t.Errorf("Events() after Prune() = %+v, want only signed", events)
+	}
+	if history := repo.History(testOrganizationID, "device", 0, 10); len(history) != 2 {
+		t.Errorf("History() returned %d events, want pruned events to stay in the history", len(history))
+	}
+	if history := repo.History("other", "", 0, 10); len(history) != 0 {
+		t.Errorf("History() of another organization returned %d events", len(history))
+	}
+}
+
+func TestInMemoryDevicesRepositoryHistoryRetention(t *testing.T) {
+	repo := NewInMemoryDevicesRepository()
+	repo.SetHistoryRetention(time.Hour)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	device := domain.SignatureDevice{UUID: "device", OrganizationID: testOrganizationID}
+	if err := repo.Create(context.Background(), device, domain.Event{ID: "created", OrganizationID: testOrganizationID, DeviceID: "device", OccurredAt: start}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	sign := func(counter int, occurredAt time.Time) {
+		event := domain.Event{
+			OrganizationID: testOrganizationID,
+			DeviceID:       "device",
+			OccurredAt:     occurredAt,
+			Data:           domain.SignatureCreatedData{SignatureCounter: counter},
+		}
+		stored, _ := repo.Get(context.Background(), testOrganizationID, "device")
+		if err := repo.IncrementCounter(context.Background(), stored, event); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	sign(0, start)
+	sign(1, start.Add(30*time.Minute))
+
+	if sequence, err := repo.SignatureSequence(testOrganizationID, "device", 2); err != nil || sequence != 3 {
+		t.Errorf("SignatureSequence(2) = %d, %v, want 3", sequence, err)
+	}
+	if sequence, err := repo.SignatureSequence(testOrganizationID, "device", 0); err != nil || sequence != 0 {
+		t.Errorf("SignatureSequence(0) = %d, %v, want 0 before anything expired", sequence, err)
+	}
+	if _, err := repo.SignatureSequence("other", "device", 1); err == nil || errors.Is(err, domain.ErrEventsExpired) {
+		t.Errorf("SignatureSequence() of another organization = %v, want an unknown signature", err)
+	}
+
+	// the third signature pushes the events of the start out of the window
+	sign(2, start.Add(90*time.Minute))
+
+	if oldest := repo.OldestSequence(); oldest != 3 {
+		t.Errorf("OldestSequence() = %d, want 3", oldest)
+	}
+	if history := repo.History(testOrganizationID, "device", 0, 10); len(history) != 2 || history[0].Sequence != 3 {
+		t.Errorf("History() = %+v, want the retained sequences 3 and 4", history)
+	}
+	tests := []struct {
+		counter  int
+		sequence int64
+		err      error
+	}{
+		{0, 0, domain.ErrEventsExpired},
+		{1, 0, domain.ErrEventsExpired},
+		{2, 3, nil},
+		{3, 4, nil},
+	}
+	for _, test := range tests {
+		sequence, err := repo.SignatureSequence(testOrganizationID, "device", test.counter)
+		if sequence != test.sequence || !errors.Is(err, test.err) {
+			t.Errorf("SignatureSequence(%d) = %d, %v, want %d, %v", test.counter, sequence, err, test.sequence, test.err)
+		}
+	}
+	if _, err := repo.SignatureSequence(testOrganizationID, "device", 4); err == nil || errors.Is(err, domain.ErrEventsExpired) {
+		t.Errorf("SignatureSequence(4) = %v, want an unknown signature", err)
+	}
+	// expiry doesn't affect dispatching
+	if events := repo.Events(0, 10); len(events) != 4 {
+		t.Errorf("Events() returned %d events, want the 4 undispatched ones", len(events))
+	}
+}
@@ -0,0 +1,218 @@
+package persistence
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+type InMemoryWebhooksRepository struct {
+	subscriptions map[string]domain.WebhookSubscription
+	deliveries    map[string]storedDelivery
+	// logs keeps the delivery ids of every subscription in creation order for the delivery log
+	logs map[subscriptionKey][]string
+	// due orders the pending deliveries by their next attempt and expiries the finished ones by their expiry,
+	// so neither GetDueDeliveries nor DeleteExpiredDeliveries visit the whole log.
+	// Entries are stale once their delivery was saved again with another time.
+	due          expiryHeap
+	expiries     expiryHeap
+	lastSequence int64
+	mutex        sync.Mutex
+}
+
+type storedDelivery struct {
+	delivery domain.WebhookDelivery
+	// sequence orders deliveries by creation
+	sequence int64
+}
+
+type subscriptionKey struct {
+	organizationID string
+	subscriptionID string
+}
+
+func NewInMemoryWebhooksRepository() *InMemoryWebhooksRepository {
+	return &InMemoryWebhooksRepository{
+		subscriptions: make(map[string]domain.WebhookSubscription),
+		deliveries:    make(map[string]storedDelivery),
+		logs:          make(map[subscriptionKey][]string),
+	}
+}
+
+func (repository *InMemoryWebhooksRepository) CreateSubscription(subscription domain.WebhookSubscription) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.subscriptions[subscription.ID]; found {
+		return fmt.Errorf("webhook subscription with id %q already exists", subscription.ID)
+	}
+	repository.subscriptions[subscription.ID] = subscription
+	return nil
+}
+
+func (repository *InMemoryWebhooksRepository) GetSubscription(
+	organizationID string,
+	id string,
+) (domain.WebhookSubscription, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	subscription, found := repository.subscriptions[id]
+	if !found || subscription.OrganizationID != organizationID {
+		return domain.WebhookSubscription{}, false
+	}
+	return subscription, true
+}
+
+func (repository *InMemoryWebhooksRepository) GetSubscriptions(organizationID string) []domain.WebhookSubscription {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	subscriptions := make([]domain.WebhookSubscription, 0)
+	for _, subscription := range repository.subscriptions {
+		if subscription.OrganizationID == organizationID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+
+func (repository *InMemoryWebhooksRepository) DeleteSubscription(organizationID string, id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	subscription, found := repository.subscriptions[id]
+	if !found || subscription.OrganizationID != organizationID {
+		return fmt.Errorf("webhook subscription with id %q doesn't exists", id)
+	}
+	delete(repository.subscriptions, id)
+	return nil
+}
+
+func (repository *InMemoryWebhooksRepository) SaveDelivery(delivery domain.WebhookDelivery) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, found := repository.deliveries[delivery.ID]
+	if !found {
+		repository.lastSequence++
+		stored.sequence = repository.lastSequence
+		key := subscriptionKey{delivery.OrganizationID, delivery.SubscriptionID}
+		repository.logs[key] = append(repository.logs[key], delivery.ID)
+	}
+	previous := stored.delivery
+	delivery.Attempts = append([]domain.WebhookAttempt{}, delivery.Attempts...)
+	stored.delivery = delivery
+	repository.deliveries[delivery.ID] = stored
+
+	if dueAt, due := dueTime(delivery); due {
+		if previousDueAt, wasDue := dueTime(previous); !found || !wasDue || !previousDueAt.Equal(dueAt) {
+			heap.Push(&repository.due, expiry{delivery.ID, dueAt})
+		}
+	}
+	if delivery.ExpiresAt != nil && (!found || previous.ExpiresAt == nil || !previous.ExpiresAt.Equal(*delivery.ExpiresAt)) {
+		heap.Push(&repository.expiries, expiry{delivery.ID, *delivery.ExpiresAt})
+	}
+	return nil
+}
+
+func (repository *InMemoryWebhooksRepository) GetDelivery(organizationID string, id string) (domain.WebhookDelivery, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, found := repository.deliveries[id]
+	if !found || stored.delivery.OrganizationID != organizationID {
+		return domain.WebhookDelivery{}, false
+	}
+	return stored.delivery, true
+}
+
+func (repository *InMemoryWebhooksRepository) GetDeliveries(
+	organizationID string,
+	subscriptionID string,
+	status domain.DeliveryStatus,
+) []domain.WebhookDelivery {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	for _, id := range repository.logs[subscriptionKey{organizationID, subscriptionID}] {
+		if delivery := repository.deliveries[id].delivery; status == "" || delivery.Status == status {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
+func (repository *InMemoryWebhooksRepository) GetDueDeliveries(now time.Time) []domain.WebhookDelivery {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var due []storedDelivery
+	var entries []expiry
+	seen := make(map[string]bool)
+	for len(repository.due) > 0 && !now.Before(repository.due[0].expiresAt) {
+		entry := heap.Pop(&repository.due).(expiry)
+		stored, found := repository.deliveries[entry.key]
+		dueAt, isDue := dueTime(stored.delivery)
+		// stale entries and duplicates of a delivery saved due at the same time again are dropped
+		if !found || !isDue || !dueAt.Equal(entry.expiresAt) || seen[entry.key] {
+			continue
+		}
+		seen[entry.key] = true
+		due = append(due, stored)
+		entries = append(entries, entry)
+	}
+	// due deliveries stay indexed until they are saved with their next attempt
+	for _, entry := range entries {
+		heap.Push(&repository.due, entry)
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].sequence < due[j].sequence })
+	deliveries := make([]domain.WebhookDelivery, 0, len(due))
+	for _, stored := range due {
+		deliveries = append(deliveries, stored.delivery)
+	}
+	return deliveries
+}
+
+func (repository *InMemoryWebhooksRepository) DeleteExpiredDeliveries(now time.Time) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	expiredLogs := make(map[subscriptionKey]bool)
+	for len(repository.expiries) > 0 && !now.Before(repository.expiries[0].expiresAt) {
+		expired := heap.Pop(&repository.expiries).(expiry)
+		stored, found := repository.deliveries[expired.key]
+		if !found || stored.delivery.ExpiresAt == nil || !stored.delivery.ExpiresAt.Equal(expired.expiresAt) {
+			continue
+		}
+		delete(repository.deliveries, expired.key)
+		expiredLogs[subscriptionKey{stored.delivery.OrganizationID, stored.delivery.SubscriptionID}] = true
+	}
+
+	for key := range expiredLogs {
+		log := repository.logs[key][:0]
+		for _, id := range repository.logs[key] {
+			if _, found := repository.deliveries[id]; found {
+				log = append(log, id)
+			}
+		}
+		if len(log) == 0 {
+			delete(repository.logs, key)
+		} else {
+			repository.logs[key] = log
+		}
+	}
+}
+
+// dueTime returns when a pending delivery is due, finished deliveries aren't
+func dueTime(delivery domain.WebhookDelivery) (time.Time, bool) {
+	if delivery.Status != domain.DeliveryPending || delivery.NextAttemptAt == nil {
+		return time.Time{}, false
+	}
+	return *delivery.NextAttemptAt, true
+}
@@ -0,0 +1,112 @@
+package persistence
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"testing"
+	"time"
+)
+
+func TestInMemoryWebhooksRepositoryDeliveries(t *testing.T) {
+	repo := NewInMemoryWebhooksRepository()
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	deliveries := []domain.WebhookDelivery{
+		{ID: "due", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryPending, NextAttemptAt: &now},
+		{ID: "later", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryPending, NextAttemptAt: &later},
+		{ID: "dead", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryDead},
+		{ID: "other", OrganizationID: "other", SubscriptionID: "hook", Status: domain.DeliveryPending, NextAttemptAt: &now},
+	}
+	for _, delivery := range deliveries {
+		if err := repo.SaveDelivery(delivery); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	if due := repo.GetDueDeliveries(now); len(due) != 2 || due[0].ID != "due" || due[1].ID != "other" {
+		t.Errorf("GetDueDeliveries() = %+v, want due deliveries of all organizations", due)
+	}
+	if all := repo.GetDeliveries(testOrganizationID, "hook", ""); len(all) != 3 || all[2].ID != "dead" {
+		t.Errorf("GetDeliveries() = %+v, want 3 deliveries in creation order", all)
+	}
+	if dead := repo.GetDeliveries(testOrganizationID, "hook", domain.DeliveryDead); len(dead) != 1 {
+		t.Errorf("GetDeliveries() of dead letters returned %d deliveries, want 1", len(dead))
+	}
+	if _, found := repo.GetDelivery("other", "due"); found {
+		t.Errorf("GetDelivery() found a delivery of another organization")
+	}
+}
+
+func TestInMemoryWebhooksRepository_DueIndex(t *testing.T) {
+	repo := NewInMemoryWebhooksRepository()
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	save := func(delivery domain.WebhookDelivery) {
+		if err := repo.SaveDelivery(delivery); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	first := domain.WebhookDelivery{ID: "first", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryPending, NextAttemptAt: &later}
+	second := domain.WebhookDelivery{ID: "second", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryPending, NextAttemptAt: &now}
+	save(first)
+	save(second)
+	first.NextAttemptAt = &now
+	save(first)
+	save(first)
+
+	if due := repo.GetDueDeliveries(now); len(due) != 2 || due[0].ID != "first" || due[1].ID != "second" {
+		t.Errorf("GetDueDeliveries() = %+v, want each due delivery once in creation order", due)
+	}
+	if due := repo.GetDueDeliveries(now); len(due) != 2 {
+		t.Errorf("GetDueDeliveries() again returned %d deliveries, want them due until they are saved", len(due))
+	}
+
+	second.NextAttemptAt = &later
+	save(second)
+	first.Status = domain.DeliverySucceeded
+	first.NextAttemptAt = nil
+	save(first)
+	if due := repo.GetDueDeliveries(now); len(due) != 0 {
+		t.Errorf("GetDueDeliveries() = %+v, want rescheduled and finished deliveries to leave the index", due)
+	}
+	if due := repo.GetDueDeliveries(later); len(due) != 1 || due[0].ID != "second" {
+		t.Errorf("GetDueDeliveries() at the retry = %+v, want the rescheduled delivery", due)
+	}
+}
+
+func TestInMemoryWebhooksRepository_DeleteExpiredDeliveries(t *testing.T) {
+	repo := NewInMemoryWebhooksRepository()
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	deliveries := []domain.WebhookDelivery{
+		{ID: "expired", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliverySucceeded, ExpiresAt: &now},
+		{ID: "redelivered", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryDead, ExpiresAt: &now},
+		{ID: "retained", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryDead, ExpiresAt: &later},
+		{ID: "pending", OrganizationID: testOrganizationID, SubscriptionID: "hook", Status: domain.DeliveryPending, NextAttemptAt: &later},
+	}
+	for _, delivery := range deliveries {
+		if err := repo.SaveDelivery(delivery); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	redelivered := deliveries[1]
+	redelivered.Status = domain.DeliveryPending
+	redelivered.ExpiresAt = nil
+	redelivered.NextAttemptAt = &later
+	if err := repo.SaveDelivery(redelivered); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	repo.DeleteExpiredDeliveries(now)
+	log := repo.GetDeliveries(testOrganizationID, "hook", "")
+	if len(log) != 3 || log[0].ID != "redelivered" || log[1].ID != "retained" || log[2].ID != "pending" {
+		t.Errorf("GetDeliveries() = %+v, want only the expired delivery removed", log)
+	}
+	if _, found := repo.GetDelivery(testOrganizationID, "expired"); found {
+		t.Errorf("GetDelivery() found the expired delivery")
+	}
+
+	repo.DeleteExpiredDeliveries(later)
+	if log = repo.GetDeliveries(testOrganizationID, "hook", ""); len(log) != 2 {
+		t.Errorf("GetDeliveries() = %+v, want the pending deliveries only", log)
+	}
+}
@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/rpc/signingpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+type apiKeyContextKey struct{}
+
+// methodPermissions maps the full gRPC method names to the permission they require
+var methodPermissions = map[string]domain.Permission{
+	signingpb.SigningService_CreateDevice_FullMethodName:     domain.PermissionManageDevices,
+	signingpb.SigningService_GetDevice_FullMethodName:        domain.PermissionReadDevices,
+	signingpb.SigningService_ListDevices_FullMethodName:      domain.PermissionReadDevices,
+	signingpb.SigningService_SignTransaction_FullMethodName:  domain.PermissionSignTransactions,
+	signingpb.SigningService_Verify_FullMethodName:           domain.PermissionReadDevices,
+	signingpb.SigningService_StreamSignatures_FullMethodName: domain.PermissionReadDevices,
+}
+
+// authenticate checks the client certificate or bearer token of ctx and the permission of the API key for method.
+// Like on the REST API a certificate bound to an API key takes precedence, other ones fall back to the token.
+// It returns ctx carrying the API key.
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	subject, hasCertificate := clientCertificateSubject(ctx)
+	token, hasToken := bearerToken(ctx)
+	if !hasCertificate && !hasToken {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	var apiKey domain.APIKey
+	err := domain.ErrUnauthenticated
+	if hasCertificate {
+		apiKey, err = s.apiKeyService.AuthenticateCertificate(subject)
+	}
+	if errors.Is(err, domain.ErrUnauthenticated) && hasToken {
+		apiKey, err = s.apiKeyService.Authenticate(token)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	permission, found := methodPermissions[method]
+	if !found {
+		permission = domain.PermissionManageAPIKeys
+	}
+	if !apiKey.Can(permission) {
+		return nil, status.Error(codes.PermissionDenied, "API key lacks permission "+string(permission))
+	}
+	return context.WithValue(ctx, apiKeyContextKey{}, apiKey), nil
+}
+
+// clientCertificateSubject returns the subject of the client certificate the TLS handshake verified
+func clientCertificateSubject(ctx context.Context) (pkix.Name, bool) {
+	client, found := peer.FromContext(ctx)
+	if !found {
+		return pkix.Name{}, false
+	}
+	info, ok := client.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return pkix.Name{}, false
+	}
+	return info.State.VerifiedChains[0][0].Subject, true
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := md.Get("authorization")
+	if len(authorization) == 0 {
+		return "", false
+	}
+	scheme, token, found := strings.Cut(authorization[0], " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func (s *Server) unaryAuthentication(
+	ctx context.Context,
+	request interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+func (s *Server) streamAuthentication(
+	server interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, err := s.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(server, contextStream{stream, ctx})
+}
+
+// contextStream replaces the context of a stream, e.g. with one carrying the API key
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream contextStream) Context() context.Context {
+	return stream.ctx
+}
+
+// apiKey returns the API key that authenticated the call.
+func apiKey(ctx context.Context) domain.APIKey {
+	apiKey, _ := ctx.Value(apiKeyContextKey{}).(domain.APIKey)
+	return apiKey
+}
+
+// organizationID returns the organization of the API key that authenticated the call.
+func organizationID(ctx context.Context) string {
+	return apiKey(ctx).OrganizationID
+}
+
+// actor returns the ID of the API key that authenticated the call, as recorded in the audit log.
+func actor(ctx context.Context) string {
+	return apiKey(ctx).ID
+}
@@ -0,0 +1,52 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+)
+
+// sentinelCodes maps domain sentinel errors to their gRPC status code
+var sentinelCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{domain.ErrDeviceSuspended, codes.FailedPrecondition},
+	{domain.ErrDeviceDecommissioned, codes.FailedPrecondition},
+	{domain.ErrDeviceConflict, codes.AlreadyExists},
+	{domain.ErrDeviceExists, codes.AlreadyExists},
+	{domain.ErrVersionConflict, codes.Aborted},
+	{domain.ErrIdempotencyKeyMismatch, codes.FailedPrecondition},
+	{domain.ErrCertificateSubjectBound, codes.AlreadyExists},
+	{domain.ErrUnauthenticated, codes.Unauthenticated},
+	{domain.ErrEventsExpired, codes.OutOfRange},
+}
+
+// statusError maps err to the gRPC status describing it, like api.ProblemFor does for HTTP.
+// Errors the domain doesn't define become internal errors without leaking their message, it is logged instead.
+func statusError(ctx context.Context, err error) error {
+	for _, sentinel := range sentinelCodes {
+		if errors.Is(err, sentinel.err) {
+			return status.Error(sentinel.code, err.Error())
+		}
+	}
+
+	var notFound domain.NotFoundError
+	var validation domain.ValidationError
+	var invalidAlgorithm domain.InvalidAlgorithmError
+	var transition domain.StatusTransitionError
+	switch {
+	case errors.As(err, &notFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &validation), errors.As(err, &invalidAlgorithm):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &transition):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		slog.ErrorContext(ctx, "Unexpected error", "error", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"context"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"time"
+)
+
+// requestIDMetadata carries the request ID of a call like the X-Request-ID header of the REST API
+const requestIDMetadata = "x-request-id"
+
+// withRequestID returns ctx carrying the request ID the client sent, or a generated one if it sent none
+// or an invalid one. The ID is sent back in the header of the response.
+func withRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if ids := md.Get(requestIDMetadata); len(ids) > 0 && logging.ValidRequestID(ids[0]) {
+		id = ids[0]
+	} else {
+		id = logging.NewRequestID()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	return logging.WithRequestID(ctx, id)
+}
+
+// logCall logs a finished call like the REST API logs requests
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	slog.InfoContext(ctx, "Handled call", "method", method, "code", status.Code(err).String(), "duration", time.Since(start))
+}
+
+func (s *Server) unaryRequestID(
+	ctx context.Context,
+	request interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx = withRequestID(ctx)
+	start := time.Now()
+	response, err := handler(ctx, request)
+	logCall(ctx, info.FullMethod, start, err)
+	return response, err
+}
+
+func (s *Server) streamRequestID(
+	server interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx := withRequestID(stream.Context())
+	start := time.Now()
+	err := handler(server, contextStream{stream, ctx})
+	logCall(ctx, info.FullMethod, start, err)
+	return err
+}
@@ -0,0 +1,341 @@
+// Package rpc serves the signing service over gRPC, next to the REST API of package api.
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/rpc/signingpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxIdempotencyKeyLength is the same limit as for the Idempotency-Key header of the REST API
+	maxIdempotencyKeyLength = 255
+	streamBatchSize         = 100
+)
+
+// Server implements signingpb.SigningServiceServer with the same domain services as api.Server.
+type Server struct {
+	signingpb.UnimplementedSigningServiceServer
+	listenAddress string
+	deviceService *domain.DeviceService
+	apiKeyService *domain.APIKeyService
+	eventStream   *domain.EventStream
+	// shutdown is closed when the server shuts down, so signature streams end instead of holding up the shutdown
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// NewServer is a factory to instantiate a new Server.
+func NewServer(
+	listenAddress string,
+	deviceService *domain.DeviceService,
+	apiKeyService *domain.APIKeyService,
+	eventStream *domain.EventStream,
+) *Server {
+	return &Server{
+		listenAddress: listenAddress,
+		deviceService: deviceService,
+		apiKeyService: apiKeyService,
+		eventStream:   eventStream,
+		shutdown:      make(chan struct{}),
+	}
+}
+
+// Run starts the Server on a TCP listener and serves until ctx is done, see Serve.
+func (s *Server) Run(ctx context.Context, shutdownTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener, shutdownTimeout)
+}
+
+// RunTLS is Run over TLS with config, e.g. the one of api.CertificateReloader.
+// Clients presenting a certificate config verifies authenticate with it like on the REST API.
+func (s *Server) RunTLS(ctx context.Context, config *tls.Config, shutdownTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(ctx, listener, config, shutdownTimeout)
+}
+
+// ServeTLS is Serve over TLS with config
+func (s *Server) ServeTLS(ctx context.Context, listener net.Listener, config *tls.Config, shutdownTimeout time.Duration) error {
+	return s.Serve(ctx, listener, shutdownTimeout, grpc.Creds(credentials.NewTLS(withHTTP2(config))))
+}
+
+// Serve accepts gRPC connections on listener until ctx is done. Then it stops accepting calls, ends signature
+// streams and waits up to shutdownTimeout for in-flight calls before cancelling them.
+func (s *Server) Serve(
+	ctx context.Context,
+	listener net.Listener,
+	shutdownTimeout time.Duration,
+	options ...grpc.ServerOption,
+) error {
+	server := s.GRPCServer(options...)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(shutdownTimeout):
+		server.Stop()
+		return fmt.Errorf("in-flight calls didn't finish within %s", shutdownTimeout)
+	}
+}
+
+// GRPCServer returns a grpc.Server that assigns request IDs, authenticates calls and serves the SigningService.
+func (s *Server) GRPCServer(options ...grpc.ServerOption) *grpc.Server {
+	options = append(options,
+		grpc.ChainUnaryInterceptor(s.unaryRequestID, s.unaryAuthentication),
+		grpc.ChainStreamInterceptor(s.streamRequestID, s.streamAuthentication),
+	)
+	server := grpc.NewServer(options...)
+	signingpb.RegisterSigningServiceServer(server, s)
+	return server
+}
+
+// withHTTP2 offers HTTP/2 in the handshake, which gRPC requires, also in configs resolved per client
+func withHTTP2(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	if getConfigForClient := config.GetConfigForClient; getConfigForClient != nil {
+		config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			clientConfig, err := getConfigForClient(hello)
+			if err != nil || clientConfig == nil {
+				return clientConfig, err
+			}
+			clientConfig = clientConfig.Clone()
+			clientConfig.NextProtos = append(clientConfig.NextProtos, "h2")
+			return clientConfig, nil
+		}
+	}
+	return config
+}
+
+func (s *Server) CreateDevice(ctx context.Context, request *signingpb.CreateDeviceRequest) (*signingpb.Device, error) {
+	algorithm := domain.Algorithm(request.Algorithm)
+	var created domain.CreateSignatureDeviceResponse
+	var err error
+	if request.Id == "" {
+		created, err = s.deviceService.CreateSignatureDevice(ctx, organizationID(ctx), actor(ctx), algorithm, request.Label)
+	} else {
+		created, _, err = s.deviceService.CreateSignatureDeviceWithID(
+			ctx,
+			organizationID(ctx),
+			actor(ctx),
+			request.Id,
+			algorithm,
+			request.Label,
+		)
+	}
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return s.GetDevice(ctx, &signingpb.GetDeviceRequest{Id: created.UUID})
+}
+
+func (s *Server) GetDevice(ctx context.Context, request *signingpb.GetDeviceRequest) (*signingpb.Device, error) {
+	device, found := s.deviceService.GetSignatureDevice(ctx, organizationID(ctx), request.Id)
+	if !found {
+		return nil, statusError(ctx, domain.NotFoundError{Resource: "signature device", ID: request.Id})
+	}
+	return toDevice(device), nil
+}
+
+func (s *Server) ListDevices(ctx context.Context, request *signingpb.ListDevicesRequest) (*signingpb.ListDevicesResponse, error) {
+	query := domain.DeviceQuery{
+		DeviceFilter: domain.DeviceFilter{
+			Algorithm:   domain.Algorithm(request.Algorithm),
+			LabelPrefix: request.LabelPrefix,
+			Tag:         request.Tag,
+		},
+		Limit: int(request.PageSize),
+	}
+	if request.Status != signingpb.Status_STATUS_UNSPECIFIED {
+		deviceStatus := domain.Status(request.Status - 1)
+		query.Status = &deviceStatus
+	}
+	if request.PageToken != "" {
+		after, err := domain.ParseDeviceCursor(request.PageToken)
+		if err != nil {
+			return nil, statusError(ctx, err)
+		}
+		query.After = &after
+	}
+
+	page, err := s.deviceService.ListSignatureDevices(ctx, organizationID(ctx), query)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	response := &signingpb.ListDevicesResponse{NextPageToken: page.NextCursor}
+	for _, device := range page.Devices {
+		response.Devices = append(response.Devices, toDevice(device))
+	}
+	return response, nil
+}
+
+func (s *Server) SignTransaction(
+	ctx context.Context,
+	request *signingpb.SignTransactionRequest,
+) (*signingpb.SignTransactionResponse, error) {
+	if _, found := s.deviceService.GetSignatureDevice(ctx, organizationID(ctx), request.DeviceId); !found {
+		return nil, statusError(ctx, domain.NotFoundError{Resource: "signature device", ID: request.DeviceId})
+	}
+	if !apiKey(ctx).CanSignWith(request.DeviceId) {
+		return nil, status.Error(codes.PermissionDenied, "API key isn't granted to sign with this device")
+	}
+
+	var signature domain.SignatureResponse
+	var err error
+	if request.IdempotencyKey != "" {
+		if len(request.IdempotencyKey) > maxIdempotencyKeyLength {
+			return nil, status.Error(codes.InvalidArgument, "idempotency key is too long")
+		}
+		signature, _, err = s.deviceService.SignTransactionIdempotently(
+			ctx,
+			organizationID(ctx),
+			request.DeviceId,
+			request.Data,
+			request.IdempotencyKey,
+		)
+	} else {
+		signature, err = s.deviceService.SignTransaction(ctx, organizationID(ctx), request.DeviceId, request.Data)
+	}
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &signingpb.SignTransactionResponse{
+		Signature:        signature.Signature,
+		SignedData:       []byte(signature.SignedData),
+		SignatureCounter: int64(signature.SignatureCounter),
+	}, nil
+}
+
+func (s *Server) Verify(ctx context.Context, request *signingpb.VerifyRequest) (*signingpb.VerifyResponse, error) {
+	valid, err := s.deviceService.VerifySignature(ctx, organizationID(ctx), request.DeviceId, domain.SignatureVerification{
+		Data:              request.Data,
+		SignatureCounter:  int(request.SignatureCounter),
+		Signature:         request.Signature,
+		PreviousSignature: request.PreviousSignature,
+	})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &signingpb.VerifyResponse{Valid: valid}, nil
+}
+
+// StreamSignatures follows the event history like the server-sent event streams of the REST API,
+// but only sends signatures
+func (s *Server) StreamSignatures(
+	request *signingpb.StreamSignaturesRequest,
+	stream signingpb.SigningService_StreamSignaturesServer,
+) error {
+	ctx := stream.Context()
+	if request.DeviceId != "" {
+		if _, found := s.deviceService.GetSignatureDevice(ctx, organizationID(ctx), request.DeviceId); !found {
+			return statusError(ctx, domain.NotFoundError{Resource: "signature device", ID: request.DeviceId})
+		}
+	}
+
+	after := s.eventStream.LastSequence()
+	if request.ResumeAfterSignatureCounter != nil {
+		if request.DeviceId == "" {
+			return status.Error(codes.InvalidArgument, "resuming requires a device_id")
+		}
+		var err error
+		// the event history identifies signatures by the counter they raised the device to
+		after, err = s.eventStream.SequenceOfSignature(
+			organizationID(ctx),
+			request.DeviceId,
+			int(*request.ResumeAfterSignatureCounter)+1,
+		)
+		if errors.Is(err, domain.ErrEventsExpired) {
+			return statusError(ctx, err)
+		}
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	// subscribe before reading the history, so no event falls between both
+	wake, cancel := s.eventStream.Subscribe(organizationID(ctx))
+	defer cancel()
+	for {
+		for {
+			events := s.eventStream.Events(organizationID(ctx), request.DeviceId, after, streamBatchSize)
+			if len(events) == 0 {
+				break
+			}
+			for _, event := range events {
+				if data, ok := event.Event.Data.(domain.SignatureCreatedData); ok {
+					if err := stream.Send(toSignatureEvent(event.Event, data)); err != nil {
+						return err
+					}
+				}
+				after = event.Sequence
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.shutdown:
+			return status.Error(codes.Unavailable, "server is shutting down, resume the stream later")
+		case <-wake:
+		}
+	}
+}
+
+func toDevice(device domain.SignatureDevice) *signingpb.Device {
+	return &signingpb.Device{
+		Uuid:             device.UUID,
+		Label:            device.Label,
+		PublicKey:        device.PublicKey,
+		Algorithm:        signingpb.Algorithm(device.Algorithm),
+		SignatureCounter: int64(device.SignatureCounter),
+		Status:           signingpb.Status(device.Status + 1),
+		CreatedAt:        timestamppb.New(device.CreatedAt),
+		Metadata:         device.Metadata,
+		Tags:             device.Tags,
+		Version:          int64(device.Version),
+	}
+}
+
+func toSignatureEvent(event domain.Event, data domain.SignatureCreatedData) *signingpb.SignatureEvent {
+	return &signingpb.SignatureEvent{
+		EventId:          event.ID,
+		DeviceId:         data.DeviceID,
+		Signature:        data.Signature,
+		SignedData:       []byte(data.SignedData),
+		SignatureCounter: int64(data.SignatureCounter),
+		OccurredAt:       timestamppb.New(event.OccurredAt),
+	}
+}
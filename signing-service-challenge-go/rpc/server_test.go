@@ -0,0 +1,416 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/rpc/signingpb"
+)
+
+type testServer struct {
+	client     signingpb.SigningServiceClient
+	apiKeys    *domain.APIKeyService
+	dispatcher *domain.EventDispatcher
+	repo       *persistence.InMemoryDevicesRepository
+	token      string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	devicesRepo := persistence.NewInMemoryDevicesRepository()
+	eventStream := domain.NewEventStream(devicesRepo)
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	deviceService := domain.NewDeviceService(
+		devicesRepo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "till", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewServer("", deviceService, apiKeyService, eventStream).GRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	connection, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	t.Cleanup(func() { connection.Close() })
+
+	return &testServer{
+		client:     signingpb.NewSigningServiceClient(connection),
+		apiKeys:    apiKeyService,
+		dispatcher: domain.NewEventDispatcher(devicesRepo, 10, eventStream),
+		repo:       devicesRepo,
+		token:      apiKey.Token,
+	}
+}
+
+// context authenticates calls with token
+func (server *testServer) context(t *testing.T, token string) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	server := newTestServer(t)
+	ctx := server.context(t, server.token)
+
+	device, err := server.client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{
+		Algorithm: signingpb.Algorithm_ALGORITHM_ECC,
+		Label:     "till",
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if device.Status != signingpb.Status_STATUS_ACTIVE || len(device.PublicKey) == 0 {
+		t.Errorf("CreateDevice() = %v, want an active device with public key", device)
+	}
+
+	first, err := server.client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: device.Uuid, Data: "first"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	second, err := server.client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: device.Uuid, Data: "second"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	verified, err := server.client.Verify(ctx, &signingpb.VerifyRequest{
+		DeviceId:          device.Uuid,
+		Data:              "second",
+		SignatureCounter:  second.SignatureCounter,
+		Signature:         second.Signature,
+		PreviousSignature: first.Signature,
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !verified.Valid {
+		t.Errorf("Verify() rejected the second signature")
+	}
+
+	fetched, err := server.client.GetDevice(ctx, &signingpb.GetDeviceRequest{Id: device.Uuid})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if fetched.SignatureCounter != 2 {
+		t.Errorf("signature counter = %d, want 2", fetched.SignatureCounter)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	server := newTestServer(t)
+	tests := []struct {
+		name      string
+		requestID string
+		echoed    bool
+	}{
+		{"client ID", "till-7/receipt-42", true},
+		{"missing ID", "", false},
+		{"invalid ID", "two words", false},
+	}
+	for _, test := range tests {
+		ctx := server.context(t, server.token)
+		if test.requestID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadata, test.requestID)
+		}
+		var header metadata.MD
+		_, err := server.client.ListDevices(ctx, &signingpb.ListDevicesRequest{}, grpc.Header(&header))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		ids := header.Get(requestIDMetadata)
+		if len(ids) != 1 {
+			t.Fatalf("%s: response has request IDs %v, want one", test.name, ids)
+		}
+		if test.echoed != (ids[0] == test.requestID) || ids[0] == "" {
+			t.Errorf("%s: response has request ID %q for %q", test.name, ids[0], test.requestID)
+		}
+	}
+}
+
+func TestListDevicesPages(t *testing.T) {
+	server := newTestServer(t)
+	ctx := server.context(t, server.token)
+	for _, label := range []string{"a", "b", "c"} {
+		request := &signingpb.CreateDeviceRequest{Algorithm: signingpb.Algorithm_ALGORITHM_ECC, Label: label}
+		if _, err := server.client.CreateDevice(ctx, request); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	var labels []string
+	request := &signingpb.ListDevicesRequest{PageSize: 2}
+	for {
+		page, err := server.client.ListDevices(ctx, request)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, device := range page.Devices {
+			labels = append(labels, device.Label)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		request.PageToken = page.NextPageToken
+	}
+	if len(labels) != 3 {
+		t.Errorf("listed %v, want all 3 devices", labels)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	server := newTestServer(t)
+	viewer, err := server.apiKeys.CreateAPIKey("organization", "admin", "dashboard", []string{"viewer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		call  func(ctx context.Context) error
+		want  codes.Code
+	}{
+		{"unknown token", "ssk_unknown", func(ctx context.Context) error {
+			_, err := server.client.GetDevice(ctx, &signingpb.GetDeviceRequest{Id: "id"})
+			return err
+		}, codes.Unauthenticated},
+		{"missing permission", viewer.Token, func(ctx context.Context) error {
+			_, err := server.client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{Algorithm: signingpb.Algorithm_ALGORITHM_ECC})
+			return err
+		}, codes.PermissionDenied},
+		{"unknown device", server.token, func(ctx context.Context) error {
+			_, err := server.client.GetDevice(ctx, &signingpb.GetDeviceRequest{Id: "id"})
+			return err
+		}, codes.NotFound},
+		{"unspecified algorithm", server.token, func(ctx context.Context) error {
+			_, err := server.client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{})
+			return err
+		}, codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		if err := test.call(server.context(t, test.token)); status.Code(err) != test.want {
+			t.Errorf("%s: error = %v, want code %s", test.name, err, test.want)
+		}
+	}
+}
+
+func TestSignTransactionRequiresDeviceGrant(t *testing.T) {
+	server := newTestServer(t)
+	device, err := server.client.CreateDevice(server.context(t, server.token), &signingpb.CreateDeviceRequest{
+		Algorithm: signingpb.Algorithm_ALGORITHM_ECC,
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	signer, err := server.apiKeys.CreateAPIKey("organization", "admin", "till", []string{"signer"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tests := []struct {
+		name   string
+		grants []string
+		want   codes.Code
+	}{
+		{"without grants", nil, codes.PermissionDenied},
+		{"other device granted", []string{"8f14e45f-ceea-467f-a0c6-7f5ab4a0b6f1"}, codes.PermissionDenied},
+		{"device granted", []string{device.Uuid}, codes.OK},
+		{"every device granted", []string{domain.AllDevices}, codes.OK},
+		{"grants revoked", []string{}, codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		if test.grants != nil {
+			if _, err = server.apiKeys.GrantDevices("organization", "admin", signer.ID, test.grants); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		_, err := server.client.SignTransaction(server.context(t, signer.Token), &signingpb.SignTransactionRequest{
+			DeviceId: device.Uuid,
+			Data:     "receipt",
+		})
+		if status.Code(err) != test.want {
+			t.Errorf("%s: error = %v, want code %s", test.name, err, test.want)
+		}
+	}
+}
+
+func TestStreamSignaturesResumes(t *testing.T) {
+	server := newTestServer(t)
+	ctx := server.context(t, server.token)
+	device, err := server.client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{Algorithm: signingpb.Algorithm_ALGORITHM_ECC})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sign := func() {
+		if _, err := server.client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: device.Uuid, Data: "data"}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	sign()
+	sign()
+
+	resumeAfter := int64(0)
+	stream, err := server.client.StreamSignatures(ctx, &signingpb.StreamSignaturesRequest{
+		DeviceId:                    device.Uuid,
+		ResumeAfterSignatureCounter: &resumeAfter,
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if event.SignatureCounter != 1 {
+		t.Errorf("replayed signature %d, want 1", event.SignatureCounter)
+	}
+
+	sign()
+	if err = server.dispatcher.Dispatch(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if event, err = stream.Recv(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if event.SignatureCounter != 2 || event.DeviceId != device.Uuid {
+		t.Errorf("live signature = %v, want counter 2", event)
+	}
+}
+
+func TestStreamSignaturesRejectsExpiredResumption(t *testing.T) {
+	server := newTestServer(t)
+	ctx := server.context(t, server.token)
+	device, err := server.client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{Algorithm: signingpb.Algorithm_ALGORITHM_ECC})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = server.client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: device.Uuid, Data: "data"}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	// an event of another device an hour after the window of the signatures closed
+	server.repo.SetHistoryRetention(time.Hour)
+	other := domain.Event{OrganizationID: "organization", DeviceID: "other", OccurredAt: time.Now().Add(2 * time.Hour)}
+	if err = server.repo.Create(context.Background(), domain.SignatureDevice{UUID: "other", OrganizationID: "organization"}, other); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, resumeAfter := range []int64{0, 1} {
+		stream, err := server.client.StreamSignatures(ctx, &signingpb.StreamSignaturesRequest{
+			DeviceId:                    device.Uuid,
+			ResumeAfterSignatureCounter: &resumeAfter,
+		})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err = stream.Recv(); status.Code(err) != codes.OutOfRange {
+			t.Errorf("resuming after %d: error = %v, want code %s", resumeAfter, err, codes.OutOfRange)
+		}
+	}
+}
+
+func TestServeEndsStreamsOnShutdown(t *testing.T) {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	devicesRepo := persistence.NewInMemoryDevicesRepository()
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	deviceService := domain.NewDeviceService(
+		devicesRepo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	apiKey, err := apiKeyService.CreateAPIKey("organization", "admin", "till", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	device, err := deviceService.CreateSignatureDevice(context.Background(), "organization", "admin", domain.ECC, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	eventStream := domain.NewEventStream(devicesRepo)
+	listener := bufconn.Listen(1024 * 1024)
+	serveCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		served <- NewServer("", deviceService, apiKeyService, eventStream).Serve(serveCtx, listener, 5*time.Second)
+	}()
+	connection, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer connection.Close()
+
+	// the stream is only known to be open once it replayed a signature
+	for i := 0; i < 2; i++ {
+		if _, err = deviceService.SignTransaction(context.Background(), "organization", device.UUID, "data"); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err = domain.NewEventDispatcher(devicesRepo, 10, eventStream).Dispatch(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	server := &testServer{client: signingpb.NewSigningServiceClient(connection), token: apiKey.Token}
+	resumeAfter := int64(0)
+	stream, err := server.client.StreamSignatures(server.context(t, server.token), &signingpb.StreamSignaturesRequest{
+		DeviceId:                    device.UUID,
+		ResumeAfterSignatureCounter: &resumeAfter,
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = stream.Recv(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	stop()
+	if _, err = stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("stream ended with %v, want code %s", err, codes.Unavailable)
+	}
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Errorf("Serve() error = %v, want a clean shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve() didn't return")
+	}
+}
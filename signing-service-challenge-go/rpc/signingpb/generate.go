@@ -0,0 +1,4 @@
+// Package signingpb holds the protobuf messages and gRPC stubs generated from signing.proto.
+package signingpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative signing.proto
@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/rpc/signingpb"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// issueTestCertificate issues a certificate for 127.0.0.1 signed by parent, a CA certificate if parent is nil
+func issueTestCertificate(t *testing.T, subject pkix.Name, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile string, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw}), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if keyFile != "" {
+		if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+}
+
+func TestServeTLS_MutualTLS(t *testing.T) {
+	auditLog := domain.NewAuditLog(persistence.NewInMemoryAuditRepository(), domain.SystemClock{})
+	apiKeyService := domain.NewAPIKeyService(persistence.NewInMemoryAPIKeysRepository(), auditLog, rand.Reader, domain.SystemClock{})
+	devicesRepo := persistence.NewInMemoryDevicesRepository()
+	deviceService := domain.NewDeviceService(
+		devicesRepo,
+		persistence.NewInMemoryIdempotencyRepository(),
+		auditLog,
+		domain.DefaultKeyPolicy,
+		rand.Reader,
+		domain.SystemClock{},
+	)
+	admin, err := apiKeyService.CreateAPIKey("organization", "admin", "till", []string{"admin"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bound := pkix.Name{CommonName: "till-1", Organization: []string{"organization"}}
+	if _, err = apiKeyService.BindCertificateSubject("organization", "admin", admin.ID, bound.String()); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	dir := t.TempDir()
+	files := api.TLSFiles{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "client-ca.pem"),
+	}
+	serverCA := issueTestCertificate(t, pkix.Name{CommonName: "server CA"}, nil)
+	issueTestCertificate(t, pkix.Name{CommonName: "127.0.0.1"}, serverCA).write(t, files.CertFile, files.KeyFile)
+	clientCA := issueTestCertificate(t, pkix.Name{CommonName: "client CA"}, nil)
+	clientCA.write(t, files.ClientCAFile, "")
+	client := issueTestCertificate(t, bound, clientCA)
+	reloader, err := api.NewCertificateReloader(files)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- NewServer("", deviceService, apiKeyService, domain.NewEventStream(devicesRepo)).
+			ServeTLS(ctx, listener, reloader.TLSConfig(), time.Second)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.certificate)
+	connect := func(certificates ...tls.Certificate) signingpb.SigningServiceClient {
+		config := &tls.Config{RootCAs: roots, Certificates: certificates}
+		connection, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		t.Cleanup(func() { connection.Close() })
+		return signingpb.NewSigningServiceClient(connection)
+	}
+	withCertificate := connect(tls.Certificate{Certificate: [][]byte{client.certificate.Raw}, PrivateKey: client.key})
+	withoutCertificate := connect()
+
+	tests := []struct {
+		name   string
+		client signingpb.SigningServiceClient
+		token  string
+		want   codes.Code
+	}{
+		{"client certificate", withCertificate, "", codes.OK},
+		{"bearer token over TLS", withoutCertificate, admin.Token, codes.OK},
+		{"neither", withoutCertificate, "", codes.Unauthenticated},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if test.token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+test.token)
+		}
+		_, err := test.client.ListDevices(ctx, &signingpb.ListDevicesRequest{})
+		cancel()
+		if status.Code(err) != test.want {
+			t.Errorf("%s: error = %v, want code %s", test.name, err, test.want)
+		}
+	}
+}